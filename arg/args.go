@@ -4,38 +4,107 @@ import (
 	"flag"
 	"fmt"
 	"kodb-import/config"
+	"kodb-import/dbDriver"
+	"kodb-import/logging"
+	"time"
 )
 
 // Args defines and handles the CLI input flags/arguments
 type Args struct {
 	Clean           bool
 	Import          bool
+	Plan            bool
+	Migrate         bool
+	Verify          bool
+	Diff            bool
+	ExportData      bool
+	ExportDir       string
 	ImportBatchSize int
+	BulkCopy        bool
+	ImportWorkers   int
+	CommitMode      string
+	Resume          bool
 	ConfigPath      string
 	DbUser          string
 	DbPass          string
 	SchemaDir       string
+	LogFormat       string
+	LogLevel        string
+	ConnectTimeout  time.Duration
+	BatchTimeout    time.Duration
+	StageTimeout    time.Duration
+	Timeout         time.Duration
 }
 
 // Validate ensures that the combination of arguments used is valid
 func (this Args) Validate() (err error) {
-	if !(this.Clean || this.Import) {
+	if !(this.Clean || this.Import || this.ExportDir != "" || this.Migrate || this.Verify || this.Diff || this.ExportData) {
 		flag.Usage()
 		return fmt.Errorf("no actionable arguments provided")
 	}
 
+	if this.ExportDir != "" && (this.Clean || this.Import) {
+		return fmt.Errorf("-export cannot be combined with -clean or -import")
+	}
+
+	if this.Verify && (this.ExportDir != "" || this.Plan) {
+		return fmt.Errorf("-verify cannot be combined with -export or -plan")
+	}
+
+	if this.Diff && (this.Clean || this.Import || this.ExportDir != "" || this.Migrate || this.Plan) {
+		return fmt.Errorf("-diff cannot be combined with -clean, -import, -export, -migrate, or -plan")
+	}
+
+	if this.Migrate && (this.Clean || this.Import || this.ExportDir != "") {
+		return fmt.Errorf("-migrate cannot be combined with -clean, -import, or -export")
+	}
+
+	if this.ExportData && (this.Clean || this.Import || this.ExportDir != "" || this.Migrate || this.Diff || this.Plan) {
+		return fmt.Errorf("-export-data cannot be combined with other jobs or -plan")
+	}
+
+	switch dbDriver.CommitMode(this.CommitMode) {
+	case dbDriver.CommitAll, dbDriver.CommitStage, dbDriver.CommitFile:
+	default:
+		return fmt.Errorf("invalid -commit value %q; expected all, stage, or file", this.CommitMode)
+	}
+
+	if this.ConnectTimeout < 0 || this.BatchTimeout < 0 || this.StageTimeout < 0 || this.Timeout < 0 {
+		return fmt.Errorf("timeouts cannot be negative")
+	}
+
+	if this.Resume && !this.Import {
+		return fmt.Errorf("-resume must be used with -import")
+	}
+
 	return nil
 }
 
 // GetArgs reads the CLI arguments using the go flag package
 func GetArgs() (a Args) {
-	_clean := flag.Bool("clean", false, "Clean drops any configured users and drops the databaseConfig.dbname database")
+	_clean := flag.Bool("clean", false, "Clean closes open sessions on and drops each configured database, then drops its configured logins; each object is reported as dropped, missing, or failed")
 	_import := flag.Bool("import", false, "Runs clean and imports the contents of OpenKO-db/ManualSetup, StoredProcedures, and Views")
+	migrate := flag.Bool("migrate", false, "Reports applied/pending migrations and runs the pending OpenKO-db/Migrations scripts, each in its own transaction, without a clean.  With -plan, pending migrations are only printed")
+	verify := flag.Bool("verify", false, "Compares table row counts against the OpenKO-db/ManualSetup data files and checks every view and stored procedure exists; exits non-zero on any mismatch.  Runs after -import when combined")
+	diff := flag.Bool("diff", false, "Compares the live database's tables, columns, views, and stored procedures with the OpenKO-db/ManualSetup scripts and logs the differences")
+	exportData := flag.Bool("export-data", false, "Writes every table's rows back to OpenKO-db/ManualSetup/6_InsertData_[Table].sql files, ordered by primary key")
+	plan := flag.Bool("plan", false, "Prints every statement -clean/-import would execute, and the connection it targets, without connecting to the database server")
+	exportDir := flag.String("export", "", "Writes the scripts -import would execute to numbered *.sql files and a combined kodb-import.sql script in the given directory, without connecting to the database server")
 	importBatchSize := flag.Int("batchSize", 16, "Batch sized used when importing table data.  Valid range [2-999], if invalid value specified will default to 16")
+	bulkCopy := flag.Bool("bulk", false, "Loads table data using TDS bulk copy instead of INSERT batches; tables with identity or unsupported column types fall back to INSERT batches.  Omit to use INSERT batches for every table")
+	importWorkers := flag.Int("workers", 1, "Number of table data files imported concurrently, each on its own connection and transaction; each table is committed as soon as it's loaded.  With -commit all, any failure from then on drops the database and its logins, so the import stays all-or-nothing")
+	commitMode := flag.String("commit", string(dbDriver.CommitAll), "When import work is committed: all (at the end), stage (after each stage), or file (after each *.sql file).  A transient error re-runs the work since the last commit.  stage and file record progress in a checkpoint file for -resume")
+	resume := flag.Bool("resume", false, "Continues a failed -import from its checkpoint file, skipping clean and any stages/files already committed")
 	configPath := flag.String("config", config.DefaultConfigFileName, "Path to config file, inclusive of the filename")
 	dbUser := flag.String("dbuser", "", "Database connection user override")
-	dbPass := flag.String("dbpass", "", "Database connection password override")
-	schemaDir := flag.String("schema", "", "OpenKO-db schema directory override; in most cases you'll just want to use the default git submodule location")
+	dbPass := flag.String("dbpass", "", "Database connection password override, or where to read it from: env:NAME, file:/path, or prompt")
+	logFormat := flag.String("log-format", logging.FormatText, "Log output format: text (key=value lines) or json (one object per line)")
+	logLevel := flag.String("log-level", "info", "Minimum log level: debug, info, warn, or error.  debug logs every batch and the SQL sent by gorm")
+	connectTimeout := flag.Duration("connect-timeout", 0, "Limits how long opening a database connection may take, e.g. 30s.  Overrides databaseConfig.timeouts.connect")
+	batchTimeout := flag.Duration("batch-timeout", 0, "Limits how long a single batch may execute, e.g. 5m.  Overrides databaseConfig.timeouts.batch")
+	stageTimeout := flag.Duration("stage-timeout", 0, "Limits how long a single import stage may take, e.g. 30m.  Overrides databaseConfig.timeouts.stage")
+	timeout := flag.Duration("timeout", 0, "Deadline for the whole run, e.g. 1h.  Overrides databaseConfig.timeouts.overall")
+	schemaDir := flag.String("schema", "", "OpenKO-db schema directory, or .zip/.tar.gz archive of it, override; in most cases you'll just want to use the default git submodule location")
 
 	flag.Parse()
 
@@ -47,6 +116,30 @@ func GetArgs() (a Args) {
 		a.Import = *_import
 	}
 
+	if migrate != nil {
+		a.Migrate = *migrate
+	}
+
+	if verify != nil {
+		a.Verify = *verify
+	}
+
+	if diff != nil {
+		a.Diff = *diff
+	}
+
+	if exportData != nil {
+		a.ExportData = *exportData
+	}
+
+	if plan != nil {
+		a.Plan = *plan
+	}
+
+	if exportDir != nil {
+		a.ExportDir = *exportDir
+	}
+
 	if configPath != nil {
 		a.ConfigPath = *configPath
 		config.ConfigPath = *configPath
@@ -68,5 +161,45 @@ func GetArgs() (a Args) {
 		a.ImportBatchSize = *importBatchSize
 	}
 
+	if importWorkers != nil {
+		a.ImportWorkers = *importWorkers
+	}
+
+	if commitMode != nil {
+		a.CommitMode = *commitMode
+	}
+
+	if resume != nil {
+		a.Resume = *resume
+	}
+
+	if bulkCopy != nil {
+		a.BulkCopy = *bulkCopy
+	}
+
+	if logFormat != nil {
+		a.LogFormat = *logFormat
+	}
+
+	if logLevel != nil {
+		a.LogLevel = *logLevel
+	}
+
+	if connectTimeout != nil {
+		a.ConnectTimeout = *connectTimeout
+	}
+
+	if batchTimeout != nil {
+		a.BatchTimeout = *batchTimeout
+	}
+
+	if stageTimeout != nil {
+		a.StageTimeout = *stageTimeout
+	}
+
+	if timeout != nil {
+		a.Timeout = *timeout
+	}
+
 	return a
 }
@@ -0,0 +1,128 @@
+package artifacts
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// ArchiveExts are the schemaDir extensions read as a packaged OpenKO-db archive instead of a directory
+var ArchiveExts = []string{".zip", ".tar.gz", ".tgz"}
+
+var (
+	// archiveMu guards archivePath and archiveFs; the archive is read once and kept in memory
+	archiveMu   sync.Mutex
+	archivePath string
+	archiveFs   fs.FS
+)
+
+// IsArchive returns true when the schema path names a packaged archive (see ArchiveExts)
+func IsArchive(schemaPath string) bool {
+	lowerPath := strings.ToLower(schemaPath)
+	for _, ext := range ArchiveExts {
+		if strings.HasSuffix(lowerPath, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// openArchive reads a .zip or .tar.gz OpenKO-db archive into memory without extracting it.  Archives with a single
+// top-level directory, like GitHub's "download archive" (OpenKO-db-main/...), are rooted at that directory
+func openArchive(archiveFile string) (fsys fs.FS, err error) {
+	archiveMu.Lock()
+	defer archiveMu.Unlock()
+	if archivePath == archiveFile && archiveFs != nil {
+		return archiveFs, nil
+	}
+
+	data, err := os.ReadFile(archiveFile)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(strings.ToLower(archiveFile), ".zip") {
+		data, err = tarGzToZip(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", archiveFile, err)
+		}
+	}
+	zipFs, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", archiveFile, err)
+	}
+
+	fsys, err = stripArchivePrefix(zipFs)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", archiveFile, err)
+	}
+	archivePath, archiveFs = archiveFile, fsys
+	return fsys, nil
+}
+
+// tarGzToZip repacks the regular files of a .tar.gz archive into an uncompressed, in-memory zip archive, so both
+// formats are read through zip.Reader's fs.FS
+func tarGzToZip(data []byte) (zipData []byte, err error) {
+	gzReader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer gzReader.Close()
+
+	buf := bytes.Buffer{}
+	zipWriter := zip.NewWriter(&buf)
+	tarReader := tar.NewReader(gzReader)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		// directories are implied by the file paths; pax headers and links aren't needed
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Clean(strings.TrimPrefix(header.Name, "./"))
+		if !fs.ValidPath(name) {
+			return nil, fmt.Errorf("invalid file name %q", header.Name)
+		}
+
+		w, err := zipWriter.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: header.ModTime})
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.Copy(w, tarReader)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = zipWriter.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// stripArchivePrefix returns the archive's single top-level directory, or the archive itself when it has several
+// top-level entries
+func stripArchivePrefix(fsys fs.FS) (fs.FS, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 1 && entries[0].IsDir() {
+		return fs.Sub(fsys, entries[0].Name())
+	}
+	return fsys, nil
+}
@@ -0,0 +1,125 @@
+package artifacts
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// archiveFiles are the files written to each test archive
+var archiveFiles = map[string]string{
+	"Templates/CreateDatabase.sqltemplate": "CREATE DATABASE [{{.DbName}}]\nGO\n",
+	"ManualSetup/5_CreateTable_ITEM.sql":   "CREATE TABLE [dbo].[ITEM] ([Num] int)\nGO\n",
+}
+
+// writeZip writes archiveFiles under prefix to a zip archive, with directory entries like GitHub's archives
+func writeZip(t *testing.T, archiveFile string, prefix string) {
+	t.Helper()
+	buf := bytes.Buffer{}
+	w := zip.NewWriter(&buf)
+	if prefix != "" {
+		_, _ = w.Create(prefix)
+	}
+	for name, text := range archiveFiles {
+		f, err := w.Create(prefix + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = f.Write([]byte(text))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(archiveFile, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeTarGz writes archiveFiles under prefix to a tar.gz archive, with the pax global header GitHub's archives start with
+func writeTarGz(t *testing.T, archiveFile string, prefix string) {
+	t.Helper()
+	buf := bytes.Buffer{}
+	gz := gzip.NewWriter(&buf)
+	w := tar.NewWriter(gz)
+	_ = w.WriteHeader(&tar.Header{Typeflag: tar.TypeXGlobalHeader, Name: "pax_global_header", PAXRecords: map[string]string{"comment": "0123abc"}})
+	if prefix != "" {
+		_ = w.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: prefix, Mode: 0755})
+	}
+	for name, text := range archiveFiles {
+		err := w.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: prefix + name, Mode: 0644, Size: int64(len(text))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write([]byte(text))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(archiveFile, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenArchive(t *testing.T) {
+	tests := []struct {
+		name   string
+		file   string
+		prefix string
+		write  func(t *testing.T, archiveFile string, prefix string)
+	}{
+		{name: "zip with top-level folder", file: "OpenKO-db-main.zip", prefix: "OpenKO-db-main/", write: writeZip},
+		{name: "zip without top-level folder", file: "OpenKO-db.ZIP", write: writeZip},
+		{name: "tar.gz with top-level folder", file: "OpenKO-db-main.tar.gz", prefix: "OpenKO-db-main/", write: writeTarGz},
+		{name: "tgz with ./ entries", file: "OpenKO-db.tgz", prefix: "./", write: writeTarGz},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archiveFile := filepath.Join(t.TempDir(), tt.file)
+			tt.write(t, archiveFile, tt.prefix)
+			if !IsArchive(archiveFile) {
+				t.Fatalf("IsArchive(%s) = false", tt.file)
+			}
+
+			fsys, err := openArchive(archiveFile)
+			if err != nil {
+				t.Fatalf("openArchive() error = %v", err)
+			}
+			for name, want := range archiveFiles {
+				got, err := fs.ReadFile(fsys, name)
+				if err != nil {
+					t.Fatalf("ReadFile(%s) error = %v", name, err)
+				}
+				if string(got) != want {
+					t.Errorf("ReadFile(%s) = %q, want %q", name, got, want)
+				}
+			}
+			matches, err := fs.Glob(fsys, "ManualSetup/5_CreateTable_*.sql")
+			if err != nil || len(matches) != 1 {
+				t.Errorf("Glob() = %v, %v, want the table script", matches, err)
+			}
+		})
+	}
+}
+
+func TestIsArchive(t *testing.T) {
+	for path, want := range map[string]bool{
+		"./OpenKO-db":               false,
+		"./OpenKO-db.zip":           true,
+		"OpenKO-db-main.tar.gz":     true,
+		"/releases/OpenKO-db.TGZ":   true,
+		"./OpenKO-db.tar":           false,
+		"./OpenKO-db.zip/Templates": false,
+	} {
+		if got := IsArchive(path); got != want {
+			t.Errorf("IsArchive(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
@@ -1,25 +1,35 @@
 package artifacts
 
 import (
-	"fmt"
 	"kodb-import/config"
-	"kodb-import/mssql"
-	"os"
+	"kodb-import/dbDriver"
 	"path/filepath"
+
+	"github.com/Open-KO/kodb-godef/enums/dbType"
 )
 
 // the artifacts package contains reference constants and helpers that map to the OpenKO-db project
 // This package shouldn't import any other packages in this project to avoid circular dependencies.
-// Exception: config package
+// Exceptions: config and dbDriver packages
 
 const (
 
-	// directory constants for using the OpenKO-db project
-	TemplatesDir   = "Templates"
+	// directory constants for using the OpenKO-db project; templates are found in DbDriver.GetTemplatesDir()
 	ViewsDir       = "Views"
 	StoredProcsDir = "StoredProcedures"
 	ManualSetupDir = "ManualSetup"
 
+	// MigrationsDir contains the numbered [Version]_[Description].sql migration scripts run by -migrate
+	MigrationsDir = "Migrations"
+
+	// ManualSetup sub-directories for the non-game databases; the game database uses ManualSetupDir directly
+	LoginManualSetupDir = "ManualSetup/Login"
+	LogManualSetupDir   = "ManualSetup/Log"
+
+	// Migrations sub-directories for the non-game databases; the game database uses MigrationsDir directly
+	LoginMigrationsDir = "Migrations/Login"
+	LogMigrationsDir   = "Migrations/Log"
+
 	// template files used to generate several structural exports
 
 	CreateDatabaseTemplate = "CreateDatabase.sqltemplate"
@@ -37,44 +47,71 @@ const (
 	CreateTableDataFileNameFmt       = "6_InsertData_%s.sql"
 	CreateViewFileNameFmt            = "7_CreateView_%s.sql"
 	CreateStoredProcedureFileNameFmt = "8_CreateStoredProc_%s.sql"
+
+	// RecordMigrationsFileName is the script that records the migrations a fresh import already includes
+	RecordMigrationsFileName = "9_RecordMigrations.sql"
 )
 
-// GetCreateDatabaseScript loads the CreateDatabase template, substitutes variables, and returns the sql script as a string
-func GetCreateDatabaseScript(driver *mssql.MssqlDbDriver) (script string, err error) {
-	sqlFmtBytes, err := os.ReadFile(filepath.Join(config.GetConfig().GenConfig.SchemaDir, TemplatesDir, CreateDatabaseTemplate))
-	if err != nil {
-		return "", err
+// GetManualSetupDir returns the directory on disk containing the *.sql files for the driver's database.  The
+// GenDbConfig.ManualSetupDir override is used when set, otherwise the default directory for the DbType is used.
+// Scripts are read through GetSchemaFS at GetManualSetupFsDir; this path is for writing them back to disk
+func GetManualSetupDir(driver dbDriver.DbDriver) string {
+	return filepath.Join(config.GetConfig().GenConfig.SchemaDir, getManualSetupDir(driver))
+}
+
+// getManualSetupDir returns the schemaDir-relative directory containing the *.sql files for the driver's database
+func getManualSetupDir(driver dbDriver.DbDriver) string {
+	dir := driver.GetGenDbConfig().ManualSetupDir
+	if dir == "" {
+		switch driver.GetDbType() {
+		case dbType.ACCOUNT:
+			dir = LoginManualSetupDir
+		case dbType.LOG:
+			dir = LogManualSetupDir
+		default:
+			dir = ManualSetupDir
+		}
 	}
 
-	return fmt.Sprintf(string(sqlFmtBytes), driver.GenDbConfig.Name), nil
+	return dir
 }
 
-// GetCreateLoginScript loads the CreateLogin template, substitutes variables, and returns the sql script as a string
-func GetCreateLoginScript(driver *mssql.MssqlDbDriver, loginIndex int) (script string, err error) {
-	sqlFmtBytes, err := os.ReadFile(filepath.Join(config.GetConfig().GenConfig.SchemaDir, TemplatesDir, CreateLoginTemplate))
-	if err != nil {
-		return "", err
+// GetMigrationsFsDir returns the directory within GetSchemaFS containing the migration scripts for the driver's
+// database type
+func GetMigrationsFsDir(driver dbDriver.DbDriver) string {
+	switch driver.GetDbType() {
+	case dbType.ACCOUNT:
+		return LoginMigrationsDir
+	case dbType.LOG:
+		return LogMigrationsDir
 	}
 
-	return fmt.Sprintf(string(sqlFmtBytes), driver.GenDbConfig.Logins[loginIndex].Name, driver.GenDbConfig.Name, driver.GenDbConfig.Logins[loginIndex].Pass), nil
+	return MigrationsDir
 }
 
-// GetCreateUserScript loads the CreateUser template, substitutes variables, and returns the sql script as a string
-func GetCreateUserScript(driver *mssql.MssqlDbDriver, userIndex int) (script string, err error) {
-	sqlFmtBytes, err := os.ReadFile(filepath.Join(config.GetConfig().GenConfig.SchemaDir, TemplatesDir, CreateUserTemplate))
-	if err != nil {
-		return "", err
-	}
+// GetCreateDatabaseScript loads the CreateDatabase template, substitutes variables, and returns the sql script as a string
+func GetCreateDatabaseScript(driver dbDriver.DbDriver) (script string, err error) {
+	data := newTemplateData(driver)
+	return renderTemplate(driver, CreateDatabaseTemplate, data)
+}
 
-	return fmt.Sprintf(string(sqlFmtBytes), driver.GenDbConfig.Users[userIndex].Name, driver.GenDbConfig.Users[userIndex].Schema, driver.GenDbConfig.Name), nil
+// GetCreateLoginScript loads the CreateLogin template, substitutes variables, and returns the sql script as a string
+func GetCreateLoginScript(driver dbDriver.DbDriver, loginIndex int) (script string, err error) {
+	data := newTemplateData(driver)
+	data.Login = driver.GetGenDbConfig().Logins[loginIndex]
+	return renderTemplate(driver, CreateLoginTemplate, data)
 }
 
-// GetCreateSchemaScript loads the CreateSchema template, substitutes variables, and returns the sql script as a string
-func GetCreateSchemaScript(driver *mssql.MssqlDbDriver, schemaIndex int) (script string, err error) {
-	sqlFmtBytes, err := os.ReadFile(filepath.Join(config.GetConfig().GenConfig.SchemaDir, TemplatesDir, CreateSchemaTemplate))
-	if err != nil {
-		return "", err
-	}
+// GetCreateUserScript loads the CreateUser template, substitutes variables, and returns the sql script as a string
+func GetCreateUserScript(driver dbDriver.DbDriver, userIndex int) (script string, err error) {
+	data := newTemplateData(driver)
+	data.User = driver.GetGenDbConfig().Users[userIndex]
+	return renderTemplate(driver, CreateUserTemplate, data)
+}
 
-	return fmt.Sprintf(string(sqlFmtBytes), driver.GenDbConfig.Schemas[schemaIndex], driver.GenDbConfig.Name), nil
+// GetCreateSchemaScript loads the CreateSchema template, substitutes variables, and returns the sql script as a string
+func GetCreateSchemaScript(driver dbDriver.DbDriver, schemaIndex int) (script string, err error) {
+	data := newTemplateData(driver)
+	data.Schema = driver.GetGenDbConfig().Schemas[schemaIndex]
+	return renderTemplate(driver, CreateSchemaTemplate, data)
 }
@@ -0,0 +1,54 @@
+package artifacts
+
+import (
+	"fmt"
+	"io/fs"
+	"kodb-import/config"
+	"kodb-import/dbDriver"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+var (
+	// EmbeddedSchema is the OpenKO-db snapshot compiled into the binary, rooted at the OpenKO-db directory.  It's only
+	// set in builds with the embedschema tag (see embedSchema.go); nil otherwise
+	EmbeddedSchema fs.FS
+	// EmbeddedSchemaVersion identifies the embedded snapshot, e.g. the OpenKO-db commit it was built from
+	EmbeddedSchemaVersion string
+)
+
+// GetSchemaFS returns the OpenKO-db tree the scripts and templates are read from.  A genConfig.schemaDir archive (see
+// IsArchive) is read in memory.  A genConfig.schemaDir directory is used when it exists and isn't empty (an
+// uninitialized git submodule is an empty directory), otherwise the EmbeddedSchema is used
+func GetSchemaFS() (fsys fs.FS, err error) {
+	dir := config.GetConfig().GenConfig.SchemaDir
+	if IsArchive(dir) {
+		return openArchive(dir)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err == nil && len(entries) > 0 {
+		return os.DirFS(dir), nil
+	}
+
+	if EmbeddedSchema != nil {
+		return EmbeddedSchema, nil
+	}
+	return nil, fmt.Errorf("schema directory %s doesn't exist or is empty; run `git submodule update --init --recursive`, set -schema, or use a build with the embedded schema (-tags embedschema)", dir)
+}
+
+// IsSchemaEmbedded returns true when GetSchemaFS falls back to the EmbeddedSchema
+func IsSchemaEmbedded() bool {
+	dir := config.GetConfig().GenConfig.SchemaDir
+	if IsArchive(dir) {
+		return false
+	}
+	entries, err := os.ReadDir(dir)
+	return (err != nil || len(entries) == 0) && EmbeddedSchema != nil
+}
+
+// GetManualSetupFsDir returns GetManualSetupDir as a path within GetSchemaFS
+func GetManualSetupFsDir(driver dbDriver.DbDriver) string {
+	return path.Clean(filepath.ToSlash(getManualSetupDir(driver)))
+}
@@ -0,0 +1,106 @@
+package artifacts
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"kodb-import/config"
+	"kodb-import/dbDriver"
+	"path"
+	"path/filepath"
+	"text/template"
+	"text/template/parse"
+)
+
+// TemplateData is the data model the *.sqltemplate files are executed with, using text/template syntax, e.g.:
+//
+//	CREATE LOGIN [{{.Login.Name}}] WITH PASSWORD=N'{{.Login.Pass}}', DEFAULT_DATABASE=[{{.DbName}}]
+//
+// Login, User, and Schema are only set for the template that creates them.  Referencing a field that doesn't exist
+// is an error, and so is a template without any {{ actions, such as a legacy fmt template with %s verbs; see
+// ValidateTemplates.
+type TemplateData struct {
+	// DbName is the name of the database being created, e.g. KN_online
+	DbName string
+	// DbType is the database's type: ACCOUNT, GAME, or LOG
+	DbType string
+	// Login is the server login being created by CreateLogin
+	Login config.LoginConfig
+	// User is the database user being created by CreateUser
+	User config.UserConfig
+	// Schema is the schema being created by CreateSchema
+	Schema string
+	// Config is the full configuration of the database being created
+	Config config.GenDbConfig
+}
+
+// newTemplateData returns the TemplateData common to every template for the driver's database
+func newTemplateData(driver dbDriver.DbDriver) TemplateData {
+	return TemplateData{
+		DbName: driver.GetGenDbConfig().Name,
+		DbType: string(driver.GetDbType()),
+		Config: driver.GetGenDbConfig(),
+	}
+}
+
+// renderTemplate loads the named template from the driver's templates directory and executes it; see executeTemplate
+func renderTemplate(driver dbDriver.DbDriver, name string, data TemplateData) (script string, err error) {
+	fsys, err := GetSchemaFS()
+	if err != nil {
+		return "", err
+	}
+	templatePath := path.Join(filepath.ToSlash(driver.GetTemplatesDir()), name)
+	text, err := fs.ReadFile(fsys, templatePath)
+	if err != nil {
+		return "", err
+	}
+
+	return executeTemplate(templatePath, string(text), data)
+}
+
+// executeTemplate executes the template text with data.  A template without any actions is an error: it's most likely
+// a legacy fmt template, whose %s verbs would otherwise end up in the script
+func executeTemplate(path string, text string, data TemplateData) (script string, err error) {
+	tmpl, err := template.New(filepath.Base(path)).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	if !hasActions(tmpl.Tree.Root) {
+		return "", fmt.Errorf("%s: no {{ }} actions; fmt %%s templates aren't supported, use the fields of artifacts.TemplateData, e.g. {{.DbName}}", path)
+	}
+	buf := bytes.Buffer{}
+	err = tmpl.Execute(&buf, data)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	return buf.String(), nil
+}
+
+// hasActions returns true if the parsed template contains anything other than text and comments
+func hasActions(root *parse.ListNode) bool {
+	for _, node := range root.Nodes {
+		switch node.Type() {
+		case parse.NodeText, parse.NodeComment:
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// ValidateTemplates renders each of the driver's *.sqltemplate files with a fully populated TemplateData, so a
+// template that doesn't parse, has no actions, or references an unknown field fails before anything is executed.
+// Every template is checked, including the ones the database's configuration doesn't use
+func ValidateTemplates(driver dbDriver.DbDriver) (err error) {
+	data := newTemplateData(driver)
+	data.Login = config.LoginConfig{Name: "login", Pass: "pass"}
+	data.User = config.UserConfig{Name: "user", Schema: "schema"}
+	data.Schema = "schema"
+	for _, name := range []string{CreateDatabaseTemplate, CreateSchemaTemplate, CreateUserTemplate, CreateLoginTemplate} {
+		_, err = renderTemplate(driver, name, data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
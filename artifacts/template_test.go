@@ -0,0 +1,71 @@
+package artifacts
+
+import (
+	"kodb-import/config"
+	"strings"
+	"testing"
+)
+
+func TestExecuteTemplate(t *testing.T) {
+	data := TemplateData{
+		DbName: "KN_online",
+		DbType: "GAME",
+		Login:  config.LoginConfig{Name: "knight", Pass: "secret"},
+		Config: config.GenDbConfig{Name: "KN_online", Schemas: []string{"knight"}},
+	}
+
+	tests := []struct {
+		name    string
+		text    string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "named fields",
+			text: "USE [{{.DbName}}]\nGO\nCREATE LOGIN [{{.Login.Name}}] WITH PASSWORD=N'{{.Login.Pass}}', DEFAULT_DATABASE=[{{.DbName}}]",
+			want: "USE [KN_online]\nGO\nCREATE LOGIN [knight] WITH PASSWORD=N'secret', DEFAULT_DATABASE=[KN_online]",
+		},
+		{
+			name: "full database config",
+			text: "-- {{.DbType}}{{range .Config.Schemas}} [{{.}}]{{end}}",
+			want: "-- GAME [knight]",
+		},
+		{
+			name:    "unknown field",
+			text:    "CREATE LOGIN [{{.LoginName}}]",
+			wantErr: "can't evaluate field LoginName",
+		},
+		{
+			name:    "invalid syntax",
+			text:    "CREATE LOGIN [{{.Login.Name]",
+			wantErr: "CreateLogin.sqltemplate",
+		},
+		{
+			name:    "legacy fmt verbs",
+			text:    "CREATE DATABASE [%s]\nGO\n",
+			wantErr: "no {{ }} actions",
+		},
+		{
+			name:    "comments aren't actions",
+			text:    "{{/* legacy */}}CREATE DATABASE [%s]",
+			wantErr: "no {{ }} actions",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := executeTemplate("Templates/CreateLogin.sqltemplate", tt.text, data)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("executeTemplate() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("executeTemplate() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("executeTemplate() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,8 +3,10 @@ package config
 import (
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -29,21 +31,53 @@ type KodbConfig struct {
 	GenConfig      GenConfig      `yaml:"genConfig"`
 }
 
-// DatabaseConfig contains the connection configuration for an MSSQL server instance
+// DatabaseConfig contains the connection configuration for a database server instance
 type DatabaseConfig struct {
+	// Type selects the server backend: mssql (default) or postgres.  postgres only supports -clean, since OpenKO-db's
+	// templates and scripts are T-SQL
+	Type     string `yaml:"type"`
 	Host     string `yaml:"host"`
 	Port     int    `yaml:"port"`
 	Instance string `yaml:"instance"`
 	User     string `yaml:"user"`
 	Password string `yaml:"password"`
+	// Timeouts limit how long the tool waits on the server; zero values wait forever
+	Timeouts TimeoutsConfig `yaml:"timeouts"`
+	// Retry controls how transient server errors are retried
+	Retry RetryConfig `yaml:"retry"`
+	// IgnorableErrors are the mssql error numbers ignored by import and clean, e.g. 3701 (cannot drop an object that
+	// doesn't exist) and 15151 (cannot drop a login that doesn't exist).  Only failed DROP batches are ignored.  When
+	// empty, the mssql package's DefaultIgnorableErrNumbers are used
+	IgnorableErrors []int32 `yaml:"ignorableErrors"`
+}
+
+// RetryConfig contains the retry policy for transient errors such as deadlocks and dropped connections
+type RetryConfig struct {
+	// Attempts is the number of times a statement is tried, including the first; 1 disables retries.  When 0, the
+	// default (dbDriver.DefaultRetryAttempts) is used
+	Attempts int `yaml:"attempts"`
+	// MaxDelay caps the exponential backoff between attempts.  When 0, the default (dbDriver.DefaultRetryMaxDelay) is used
+	MaxDelay time.Duration `yaml:"maxDelay"`
+}
+
+// TimeoutsConfig contains the timeouts applied to database work, as Go durations (30s, 5m, 1h)
+type TimeoutsConfig struct {
+	// Connect limits how long opening a connection may take
+	Connect time.Duration `yaml:"connect"`
+	// Batch limits how long a single batch may execute
+	Batch time.Duration `yaml:"batch"`
+	// Stage limits how long a single import stage may take
+	Stage time.Duration `yaml:"stage"`
+	// Overall is the deadline for the whole run
+	Overall time.Duration `yaml:"overall"`
 }
 
 // GenConfig contains the configuration used to generate/export our application databases
 type GenConfig struct {
-	SchemaDir string `yaml:"schemaDir"`
-	// TODO:  When implementing multi-db, we'll make this into an array of loginDb, gameDb, and logDb
-	//	to allow more flexible generation
-	GameDbs []GenDbConfig `yaml:"gameDb"`
+	SchemaDir string        `yaml:"schemaDir"`
+	LoginDbs  []GenDbConfig `yaml:"loginDb"`
+	GameDbs   []GenDbConfig `yaml:"gameDb"`
+	LogDbs    []GenDbConfig `yaml:"logDb"`
 }
 
 // GenDbConfig contains the configuration for an individual application database
@@ -52,6 +86,9 @@ type GenDbConfig struct {
 	Schemas []string      `yaml:"schemas"`
 	Logins  []LoginConfig `yaml:"logins"`
 	Users   []UserConfig  `yaml:"users"`
+	// ManualSetupDir optionally overrides the schemaDir-relative directory the database's *.sql files are read from.
+	// When blank, the default directory for the database type is used; see artifacts.GetManualSetupDir
+	ManualSetupDir string `yaml:"manualSetupDir"`
 }
 
 // LoginConfig contains the configuration of a single database login credential
@@ -97,5 +134,22 @@ func loadConfig() {
 	if err != nil {
 		log.Panic(fmt.Errorf("failed to parse config.yaml: %v", err))
 	}
+	if configInstance == nil {
+		configInstance = &KodbConfig{}
+	}
 
+	for _, path := range configInstance.plaintextPasswords() {
+		slog.Warn("plaintext password in config file; use env:NAME, file:/path, prompt, or a KODB_* environment variable instead", "field", path)
+	}
+
+	applied, unknown, err := applyEnvOverrides(configInstance, os.Environ())
+	if err != nil {
+		log.Panic(fmt.Errorf("failed to apply environment overrides: %v", err))
+	}
+	for _, name := range applied {
+		slog.Info("config overridden by environment", "variable", name)
+	}
+	for _, name := range unknown {
+		slog.Warn("environment variable doesn't match a config field", "variable", name)
+	}
 }
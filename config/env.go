@@ -0,0 +1,143 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// EnvPrefix starts the name of every environment variable that overrides a config field
+	EnvPrefix = "KODB_"
+)
+
+// durationType is time.Duration's reflect.Type; durations are parsed from strings like 30s rather than as integers
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// applyEnvOverrides sets every config field named by a KODB_* variable in environ.  The variable name is EnvPrefix
+// followed by the field's yaml path in upper case, joined by underscores, with the index of list entries:
+//
+//	KODB_DATABASECONFIG_PASSWORD=env:SA_PASSWORD
+//	KODB_DATABASECONFIG_TIMEOUTS_CONNECT=30s
+//	KODB_GENCONFIG_GAMEDB_0_LOGINS_0_PASS=file:/run/secrets/knight
+//
+// Lists of values, like schemas and ignorableErrors, are comma separated.  Only list entries that exist in the config
+// file can be overridden.  Returns the names of the variables applied, and of the KODB_* variables that don't name a
+// field
+func applyEnvOverrides(conf *KodbConfig, environ []string) (applied []string, unknown []string, err error) {
+	env := map[string]string{}
+	for _, kv := range environ {
+		name, value, _ := strings.Cut(kv, "=")
+		if strings.HasPrefix(name, EnvPrefix) {
+			env[name] = value
+		}
+	}
+
+	known := map[string]bool{}
+	err = walkEnvFields(reflect.ValueOf(conf).Elem(), strings.TrimSuffix(EnvPrefix, "_"), func(field reflect.Value, name string) error {
+		known[name] = true
+		value, ok := env[name]
+		if !ok {
+			return nil
+		}
+		err := setEnvValue(field, value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		applied = append(applied, name)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for name := range env {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	return applied, unknown, nil
+}
+
+// walkEnvFields calls fn with each settable field below v and its environment variable name
+func walkEnvFields(v reflect.Value, name string, fn func(field reflect.Value, name string) error) error {
+	switch {
+	case v.Kind() == reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			tag, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("yaml"), ",")
+			if tag == "" || tag == "-" || !v.Field(i).CanSet() {
+				continue
+			}
+			err := walkEnvFields(v.Field(i), name+"_"+strings.ToUpper(tag), fn)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Struct:
+		for i := 0; i < v.Len(); i++ {
+			err := walkEnvFields(v.Index(i), name+"_"+strconv.Itoa(i), fn)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fn(v, name)
+	}
+}
+
+// setEnvValue parses value into field; lists are comma separated
+func setEnvValue(field reflect.Value, value string) error {
+	if field.Kind() != reflect.Slice {
+		return setScalar(field, value)
+	}
+
+	parts := strings.Split(value, ",")
+	if strings.TrimSpace(value) == "" {
+		parts = nil
+	}
+	list := reflect.MakeSlice(field.Type(), len(parts), len(parts))
+	for i := range parts {
+		err := setScalar(list.Index(i), strings.TrimSpace(parts[i]))
+		if err != nil {
+			return err
+		}
+	}
+	field.Set(list)
+	return nil
+}
+
+// setScalar parses value into a string, bool, integer, or time.Duration field
+func setScalar(field reflect.Value, value string) error {
+	if field.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
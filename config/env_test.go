@@ -0,0 +1,92 @@
+package config
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApplyEnvOverrides(t *testing.T) {
+	conf := &KodbConfig{
+		DatabaseConfig: DatabaseConfig{Host: "localhost", Port: 1433, Password: "secret"},
+		GenConfig: GenConfig{
+			SchemaDir: "./OpenKO-db",
+			GameDbs: []GenDbConfig{{
+				Name:    "KN_online",
+				Schemas: []string{"knight"},
+				Logins:  []LoginConfig{{Name: "knight", Pass: "knight"}},
+			}},
+		},
+	}
+	environ := []string{
+		"PATH=/usr/bin",
+		"KODB_DATABASECONFIG_HOST=db.example.com",
+		"KODB_DATABASECONFIG_PORT=14330",
+		"KODB_DATABASECONFIG_PASSWORD=env:SA_PASSWORD",
+		"KODB_DATABASECONFIG_TIMEOUTS_CONNECT=30s",
+		"KODB_DATABASECONFIG_RETRY_ATTEMPTS=5",
+		"KODB_DATABASECONFIG_IGNORABLEERRORS=3701, 15151,15025",
+		"KODB_GENCONFIG_GAMEDB_0_SCHEMAS=knight,web",
+		"KODB_GENCONFIG_GAMEDB_0_LOGINS_0_PASS=file:/run/secrets/knight",
+		"KODB_GENCONFIG_GAMEDB_1_NAME=KN_online2",
+		"KODB_DATABASECONFIG_PASSWROD=typo",
+	}
+
+	applied, unknown, err := applyEnvOverrides(conf, environ)
+	if err != nil {
+		t.Fatalf("applyEnvOverrides() error = %v", err)
+	}
+
+	want := DatabaseConfig{
+		Host:            "db.example.com",
+		Port:            14330,
+		Password:        "env:SA_PASSWORD",
+		Timeouts:        TimeoutsConfig{Connect: 30 * time.Second},
+		Retry:           RetryConfig{Attempts: 5},
+		IgnorableErrors: []int32{3701, 15151, 15025},
+	}
+	if !reflect.DeepEqual(conf.DatabaseConfig, want) {
+		t.Errorf("DatabaseConfig = %+v, want %+v", conf.DatabaseConfig, want)
+	}
+	if got := conf.GenConfig.GameDbs[0].Schemas; !reflect.DeepEqual(got, []string{"knight", "web"}) {
+		t.Errorf("schemas = %v, want [knight web]", got)
+	}
+	if got := conf.GenConfig.GameDbs[0].Logins[0].Pass; got != "file:/run/secrets/knight" {
+		t.Errorf("login pass = %q, want the file source", got)
+	}
+	if conf.GenConfig.SchemaDir != "./OpenKO-db" {
+		t.Errorf("schemaDir = %q, want it unchanged", conf.GenConfig.SchemaDir)
+	}
+	if len(applied) != 8 {
+		t.Errorf("applied = %v, want 8 variables", applied)
+	}
+
+	// list entries that aren't in the config file can't be added, and typos are reported
+	slices.Sort(unknown)
+	wantUnknown := []string{"KODB_DATABASECONFIG_PASSWROD", "KODB_GENCONFIG_GAMEDB_1_NAME"}
+	if !reflect.DeepEqual(unknown, wantUnknown) {
+		t.Errorf("unknown = %v, want %v", unknown, wantUnknown)
+	}
+}
+
+func TestApplyEnvOverridesInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     string
+		wantErr string
+	}{
+		{name: "integer", env: "KODB_DATABASECONFIG_PORT=abc", wantErr: "KODB_DATABASECONFIG_PORT"},
+		{name: "duration", env: "KODB_DATABASECONFIG_TIMEOUTS_BATCH=5", wantErr: "KODB_DATABASECONFIG_TIMEOUTS_BATCH"},
+		{name: "integer list", env: "KODB_DATABASECONFIG_IGNORABLEERRORS=3701,x", wantErr: "KODB_DATABASECONFIG_IGNORABLEERRORS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := applyEnvOverrides(&KodbConfig{}, []string{tt.env})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("applyEnvOverrides() error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
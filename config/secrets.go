@@ -0,0 +1,118 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+const (
+	// SecretEnvPrefix reads a password from the named environment variable, e.g. env:SA_PASSWORD
+	SecretEnvPrefix = "env:"
+	// SecretFilePrefix reads a password from a file, e.g. file:/run/secrets/sa_password; a trailing newline is trimmed
+	SecretFilePrefix = "file:"
+	// SecretPrompt asks for the password on the terminal without echoing it
+	SecretPrompt = "prompt"
+)
+
+// promptPassword reads a password from the terminal without echo; replaced by tests
+var promptPassword = func(label string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("%s: can't prompt for the password, stdin isn't a terminal", label)
+	}
+	fmt.Fprintf(os.Stderr, "%s: ", label)
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", label, err)
+	}
+	return string(password), nil
+}
+
+// IsSecretSource returns true when a password value names where to read the password from (env:NAME, file:/path, or
+// prompt) rather than being the password itself
+func IsSecretSource(value string) bool {
+	return strings.HasPrefix(value, SecretEnvPrefix) || strings.HasPrefix(value, SecretFilePrefix) || value == SecretPrompt
+}
+
+// ResolveSecret returns the password a secret source names; values that aren't a secret source (see IsSecretSource)
+// are returned as-is.  label describes the password when prompting or reporting an error
+func ResolveSecret(value string, label string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, SecretEnvPrefix):
+		name := strings.TrimPrefix(value, SecretEnvPrefix)
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("%s: environment variable %s is not set", label, name)
+		}
+		return secret, nil
+	case strings.HasPrefix(value, SecretFilePrefix):
+		secret, err := os.ReadFile(strings.TrimPrefix(value, SecretFilePrefix))
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", label, err)
+		}
+		return strings.TrimRight(string(secret), "\r\n"), nil
+	case value == SecretPrompt:
+		return promptPassword(label)
+	}
+	return value, nil
+}
+
+// ResolveSecrets replaces the database password and every login password that names a secret source with the
+// password it points to; see ResolveSecret
+func (this *KodbConfig) ResolveSecrets() (err error) {
+	label := "databaseConfig.password"
+	if this.DatabaseConfig.User != "" {
+		label += fmt.Sprintf(" (user %s)", this.DatabaseConfig.User)
+	}
+	this.DatabaseConfig.Password, err = ResolveSecret(this.DatabaseConfig.Password, label)
+	if err != nil {
+		return err
+	}
+
+	return this.GenConfig.eachLogin(func(login *LoginConfig, path string) (err error) {
+		login.Pass, err = ResolveSecret(login.Pass, fmt.Sprintf("%s.pass (login %s)", path, login.Name))
+		return err
+	})
+}
+
+// plaintextPasswords returns the yaml path of every password that's set to the password itself rather than a
+// secret source
+func (this *KodbConfig) plaintextPasswords() (paths []string) {
+	if this.DatabaseConfig.Password != "" && !IsSecretSource(this.DatabaseConfig.Password) {
+		paths = append(paths, "databaseConfig.password")
+	}
+	_ = this.GenConfig.eachLogin(func(login *LoginConfig, path string) error {
+		if login.Pass != "" && !IsSecretSource(login.Pass) {
+			paths = append(paths, path+".pass")
+		}
+		return nil
+	})
+	return paths
+}
+
+// eachLogin calls fn with every configured login and its yaml path, e.g. genConfig.gameDb[0].logins[0]
+func (this *GenConfig) eachLogin(fn func(login *LoginConfig, path string) error) error {
+	dbLists := []struct {
+		Key string
+		Dbs []GenDbConfig
+	}{
+		{"loginDb", this.LoginDbs},
+		{"gameDb", this.GameDbs},
+		{"logDb", this.LogDbs},
+	}
+	for _, list := range dbLists {
+		for i := range list.Dbs {
+			for j := range list.Dbs[i].Logins {
+				err := fn(&list.Dbs[i].Logins[j], fmt.Sprintf("genConfig.%s[%d].logins[%d]", list.Key, i, j))
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
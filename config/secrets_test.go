@@ -0,0 +1,73 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveSecrets(t *testing.T) {
+	t.Setenv("KODB_TEST_SA_PASSWORD", "sa-secret")
+	secretFile := filepath.Join(t.TempDir(), "knight")
+	if err := os.WriteFile(secretFile, []byte("knight-secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	prompts := []string{}
+	defer func(prompt func(string) (string, error)) { promptPassword = prompt }(promptPassword)
+	promptPassword = func(label string) (string, error) {
+		prompts = append(prompts, label)
+		return "prompted", nil
+	}
+
+	conf := &KodbConfig{
+		DatabaseConfig: DatabaseConfig{User: "sa", Password: "env:KODB_TEST_SA_PASSWORD"},
+		GenConfig: GenConfig{
+			LoginDbs: []GenDbConfig{{Logins: []LoginConfig{{Name: "knight_login", Pass: "file:" + secretFile}}}},
+			GameDbs:  []GenDbConfig{{Logins: []LoginConfig{{Name: "knight", Pass: "prompt"}, {Name: "web", Pass: "plain"}}}},
+		},
+	}
+	if got := conf.plaintextPasswords(); !reflect.DeepEqual(got, []string{"genConfig.gameDb[0].logins[1].pass"}) {
+		t.Errorf("plaintextPasswords() = %v, want the gameDb web login", got)
+	}
+
+	err := conf.ResolveSecrets()
+	if err != nil {
+		t.Fatalf("ResolveSecrets() error = %v", err)
+	}
+	if conf.DatabaseConfig.Password != "sa-secret" {
+		t.Errorf("databaseConfig.password = %q, want the env value", conf.DatabaseConfig.Password)
+	}
+	if got := conf.GenConfig.LoginDbs[0].Logins[0].Pass; got != "knight-secret" {
+		t.Errorf("loginDb pass = %q, want the file contents without the newline", got)
+	}
+	if got := conf.GenConfig.GameDbs[0].Logins[0].Pass; got != "prompted" {
+		t.Errorf("gameDb pass = %q, want the prompted value", got)
+	}
+	if got := conf.GenConfig.GameDbs[0].Logins[1].Pass; got != "plain" {
+		t.Errorf("plaintext pass = %q, want it unchanged", got)
+	}
+	if !reflect.DeepEqual(prompts, []string{"genConfig.gameDb[0].logins[0].pass (login knight)"}) {
+		t.Errorf("prompts = %v, want one for the gameDb login", prompts)
+	}
+}
+
+func TestResolveSecretErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantErr string
+	}{
+		{name: "unset variable", value: "env:KODB_TEST_UNSET_PASSWORD", wantErr: "KODB_TEST_UNSET_PASSWORD is not set"},
+		{name: "missing file", value: "file:" + filepath.Join(t.TempDir(), "missing"), wantErr: "databaseConfig.password"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ResolveSecret(tt.value, "databaseConfig.password")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ResolveSecret() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package dbDriver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kodb-import/config"
+	"kodb-import/logging"
+
+	"github.com/Open-KO/kodb-godef/enums/dbType"
+	"gorm.io/gorm"
+)
+
+// Base implements the connection and transaction management shared by every DbDriver.  Implementations embed it
+// and set Dialector and SysDbName.
+type Base struct {
+	DbConfig    config.DatabaseConfig
+	GenDbConfig config.GenDbConfig
+	DbType      dbType.DbType
+	// IsPlan when true, jobs print the statements they would execute instead of connecting to the server
+	IsPlan bool
+	// CommitMode determines when jobs commit the top-level transaction fence
+	CommitMode CommitMode
+	// SysDbName is the server's system database, used for database/login creation
+	SysDbName string
+	// Dialector returns the gorm dialector used to open a connection to the named database
+	Dialector func(dbName string) gorm.Dialector
+
+	conn       *gorm.DB
+	masterConn *gorm.DB
+	tx         *gorm.DB
+}
+
+// NewBase returns a Base populated with the application's DatabaseConfig and the given GenDbConfig
+func NewBase(genDbConfig config.GenDbConfig, databaseType dbType.DbType, sysDbName string) Base {
+	return Base{
+		DbConfig:    config.GetConfig().DatabaseConfig,
+		GenDbConfig: genDbConfig,
+		DbType:      databaseType,
+		CommitMode:  CommitAll,
+		SysDbName:   sysDbName,
+	}
+}
+
+// GetGenDbConfig returns the configuration of the application database this driver generates
+func (this *Base) GetGenDbConfig() config.GenDbConfig {
+	return this.GenDbConfig
+}
+
+// GetDbType returns the type of application database this driver generates
+func (this *Base) GetDbType() dbType.DbType {
+	return this.DbType
+}
+
+// IsPlanMode returns true when jobs should print statements instead of connecting to the server
+func (this *Base) IsPlanMode() bool {
+	return this.IsPlan
+}
+
+// GetCommitMode returns when jobs should commit the top-level transaction fence
+func (this *Base) GetCommitMode() CommitMode {
+	return this.CommitMode
+}
+
+// GetRetryConfig returns the policy used to retry transient errors
+func (this *Base) GetRetryConfig() config.RetryConfig {
+	return this.DbConfig.Retry
+}
+
+// GetTimeoutsConfig returns the timeouts applied to database work
+func (this *Base) GetTimeoutsConfig() config.TimeoutsConfig {
+	return this.DbConfig.Timeouts
+}
+
+// GetSysDbName returns the name of the server's system database
+func (this *Base) GetSysDbName() string {
+	return this.SysDbName
+}
+
+// GetConnection returns a *gorm.DB instance for the application database
+func (this *Base) GetConnection() (*gorm.DB, error) {
+	// if there's an existing connection, re-use it
+	if this.conn != nil {
+		// if there's an open session, use it
+		if this.tx != nil {
+			return this.tx, nil
+		}
+		return this.conn, nil
+	}
+
+	gormConfig := &gorm.Config{
+		Logger: logging.NewGormLogger(),
+	}
+
+	// only keep the connection once it's open, so a retry after a failed open tries again
+	conn, err := gorm.Open(this.Dialector(this.GenDbConfig.Name), gormConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open connection to %s: %w", this.GenDbConfig.Name, err)
+	}
+	this.conn = conn
+
+	return this.conn, nil
+}
+
+// GetMasterConnection returns a *gorm.DB instance for the server's system database
+func (this *Base) GetMasterConnection() (*gorm.DB, error) {
+	// if there's an existing connection, re-use it
+	if this.masterConn != nil {
+		return this.masterConn, nil
+	}
+
+	gormConfig := &gorm.Config{
+		Logger:                 logging.NewGormLogger(),
+		SkipDefaultTransaction: true,
+	}
+
+	// open a connection against the master db
+	conn, err := gorm.Open(this.Dialector(this.SysDbName), gormConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open connection to %s: %w", this.SysDbName, err)
+	}
+	this.masterConn = conn
+
+	return this.masterConn, nil
+}
+
+func (this *Base) GetDb() *gorm.DB {
+	return this.conn
+}
+
+// GetTx returns the top-level transaction fence for this driver
+func (this *Base) GetTx() (tx *gorm.DB, err error) {
+	if this.conn == nil {
+		this.conn, err = this.GetConnection()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if this.tx == nil {
+		tx = this.conn.Begin()
+		if tx.Error != nil {
+			return nil, tx.Error
+		}
+		this.tx = tx
+	}
+
+	return this.tx, nil
+}
+
+// BeginTx opens a new transaction on its own pooled connection, independent of the top-level transaction fence.
+// The caller is responsible for committing or rolling it back
+func (this *Base) BeginTx() (tx *gorm.DB, err error) {
+	if this.conn == nil {
+		this.conn, err = this.GetConnection()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tx = this.conn.Begin()
+	return tx, tx.Error
+}
+
+// CommitIndependentTx commits a transaction opened by BeginTx
+func (this *Base) CommitIndependentTx(tx *gorm.DB) error {
+	return tx.Commit().Error
+}
+
+// RollbackIndependentTx rolls back a transaction opened by BeginTx
+func (this *Base) RollbackIndependentTx(tx *gorm.DB) error {
+	return tx.Rollback().Error
+}
+
+// HasTx returns true when the top-level transaction fence is open
+func (this *Base) HasTx() bool {
+	return this.tx != nil
+}
+
+// CommitTx attempts to commit the top level transaction fence for this driver.  The next call to GetTx opens a new
+// transaction fence
+func (this *Base) CommitTx() error {
+	if this.tx != nil {
+		err := this.tx.Commit().Error
+		this.tx = nil
+		return err
+	}
+	return fmt.Errorf("no transaction to commit")
+}
+
+// RollbackTx attempts to rollback the top level transaction fence for this driver.  The next call to GetTx opens a
+// new transaction fence
+func (this *Base) RollbackTx() error {
+	if this.tx != nil {
+		err := this.tx.Rollback().Error
+		this.tx = nil
+		return err
+	}
+	return fmt.Errorf("no transaction to rollback")
+}
+
+// CloseConnection nulls the connection pointer pointer; gorm doesn't require manual connection closes
+func (this *Base) CloseConnection() {
+	this.conn = nil
+}
+
+// ExecBatch executes a single batch on the given connection; the batch is cancelled with ctx, or once it has run
+// for the configured batch timeout
+func (this *Base) ExecBatch(ctx context.Context, conn *gorm.DB, sql string) error {
+	timeout := this.DbConfig.Timeouts.Batch
+	if timeout <= 0 {
+		return conn.WithContext(ctx).Exec(sql).Error
+	}
+
+	batchCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := conn.WithContext(batchCtx).Exec(sql).Error
+	if err != nil && ctx.Err() == nil && errors.Is(batchCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("batch timed out after %s: %w", timeout, context.DeadlineExceeded)
+	}
+	return err
+}
@@ -0,0 +1,123 @@
+package dbDriver
+
+import (
+	"context"
+	"kodb-import/config"
+	"log/slog"
+
+	"github.com/Open-KO/kodb-godef/enums/dbType"
+	"gorm.io/gorm"
+)
+
+// the dbDriver package defines the interface jobs use to talk to a database backend; the implementations live in
+// their own packages (mssql, postgres).  This package shouldn't import any of the implementations.
+
+const (
+	// MssqlType selects the mssql package implementation; the default
+	MssqlType = "mssql"
+	// PostgresType selects the postgres package implementation
+	PostgresType = "postgres"
+)
+
+// CommitMode determines how often work on the top-level transaction fence is committed
+type CommitMode string
+
+const (
+	// CommitAll commits everything at once when the driver's work is done; the default
+	CommitAll CommitMode = "all"
+	// CommitStage commits after each import stage (schemas, users, tables, ...)
+	CommitStage CommitMode = "stage"
+	// CommitFile commits after each *.sql file
+	CommitFile CommitMode = "file"
+)
+
+// Batch is a single batch of a sql script, as sent to the server in one round trip
+type Batch struct {
+	// Sql is the batch text without any batch terminator
+	Sql string
+	// Line is the 1-based line number in the source file the batch starts on
+	Line int
+	// Repeat is the number of times the batch should be executed (GO [count]); 1 unless specified
+	Repeat int
+	// Rows is the number of data dump rows the batch inserts; 0 for batches that aren't data dump rows
+	Rows int
+}
+
+// DbDriver is implemented by each supported database backend.  A driver is configured per application database
+// and owns that database's connections and top-level transaction fence.
+type DbDriver interface {
+	// GetGenDbConfig returns the configuration of the application database this driver generates
+	GetGenDbConfig() config.GenDbConfig
+	// GetDbType returns the type of application database this driver generates
+	GetDbType() dbType.DbType
+	// IsPlanMode returns true when jobs should print statements instead of connecting to the server
+	IsPlanMode() bool
+	// GetCommitMode returns when jobs should commit the top-level transaction fence
+	GetCommitMode() CommitMode
+
+	// GetConnection returns a connection to the application database, or the open top-level transaction
+	GetConnection() (*gorm.DB, error)
+	// GetMasterConnection returns an untransacted connection to the server's system database
+	GetMasterConnection() (*gorm.DB, error)
+	// GetTx returns the top-level transaction fence, opening it if needed
+	GetTx() (*gorm.DB, error)
+	// BeginTx opens a new transaction independent of the top-level transaction fence
+	BeginTx() (*gorm.DB, error)
+	// CommitIndependentTx commits a transaction opened by BeginTx
+	CommitIndependentTx(tx *gorm.DB) error
+	// RollbackIndependentTx rolls back a transaction opened by BeginTx
+	RollbackIndependentTx(tx *gorm.DB) error
+	// HasTx returns true when the top-level transaction fence is open
+	HasTx() bool
+	// CommitTx commits the top-level transaction fence
+	CommitTx() error
+	// RollbackTx rolls back the top-level transaction fence
+	RollbackTx() error
+	// CloseConnection releases the driver's connections
+	CloseConnection()
+
+	// GetSysDbName returns the name of the server's system database (master, postgres)
+	GetSysDbName() string
+	// GetTemplatesDir returns the OpenKO-db directory, relative to the schemaDir, containing this backend's templates
+	GetTemplatesDir() string
+	// QuoteIdentifier quotes a single identifier for use in sql
+	QuoteIdentifier(name string) string
+	// SplitBatches breaks a script into the batches that are executed one at a time
+	SplitBatches(sql string) ([]Batch, error)
+	// ExecBatch executes a single batch on the given connection; the batch is cancelled with ctx
+	ExecBatch(ctx context.Context, conn *gorm.DB, sql string) error
+	// GetDropDatabaseSql returns the statement that closes the named database's sessions and drops it; dropping a
+	// database that doesn't exist fails with an error IsIgnorableErr accepts
+	GetDropDatabaseSql(dbName string) string
+	// GetDropLoginSql returns the statement that drops the named server login; dropping a login that doesn't exist
+	// fails with an error IsIgnorableErr accepts
+	GetDropLoginSql(loginName string) string
+	// IsIgnorableErr returns true for errors from dropping objects that don't exist; sql is the batch that failed
+	IsIgnorableErr(err error, sql string) bool
+	// IsTransientErr returns true for errors that are expected to clear up on their own, such as deadlocks, dropped
+	// connections, and a server that's still starting up
+	IsTransientErr(err error) bool
+	// GetRetryConfig returns the policy used to retry transient errors; see Retry
+	GetRetryConfig() config.RetryConfig
+	// GetTimeoutsConfig returns the timeouts applied to database work; ExecBatch applies the batch timeout itself
+	GetTimeoutsConfig() config.TimeoutsConfig
+}
+
+// EndTx ends the driver's top-level transaction fence once its jobs are done: the fence is committed when err is nil,
+// otherwise it's rolled back so the failed work isn't left open.  Returns err, or the commit's error
+func EndTx(driver DbDriver, err error) error {
+	if !driver.HasTx() {
+		return err
+	}
+	if err == nil {
+		return driver.CommitTx()
+	}
+
+	rErr := driver.RollbackTx()
+	if rErr != nil {
+		slog.Error("failed to rollback transaction", "db", driver.GetGenDbConfig().Name, "error", rErr)
+	} else {
+		slog.Info("transaction rolled back", "db", driver.GetGenDbConfig().Name)
+	}
+	return err
+}
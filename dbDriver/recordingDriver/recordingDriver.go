@@ -0,0 +1,256 @@
+package recordingDriver
+
+import (
+	"context"
+	"fmt"
+	"kodb-import/config"
+	"kodb-import/dbDriver"
+	"kodb-import/mssql"
+	"sync"
+
+	"github.com/Open-KO/kodb-godef/enums/dbType"
+	"gorm.io/gorm"
+)
+
+// the recordingDriver package contains an in-memory DbDriver used to test jobs without a database server.  It behaves
+// like the mssql driver (T-SQL batches, drop statements, ignorable errors) but records each statement instead of
+// executing it.
+
+const (
+	// BeginSql is recorded when a transaction is opened
+	BeginSql = "BEGIN TRANSACTION"
+	// CommitSql is recorded when a transaction is committed
+	CommitSql = "COMMIT"
+	// RollbackSql is recorded when a transaction is rolled back
+	RollbackSql = "ROLLBACK"
+)
+
+// Statement is a single statement or transaction boundary recorded by RecordingDriver
+type Statement struct {
+	// Target is the database the statement was executed against
+	Target string
+	// Tx is the id of the transaction the statement was executed in; 0 when untransacted
+	Tx int
+	// Sql is the executed batch, or one of BeginSql, CommitSql, or RollbackSql
+	Sql string
+}
+
+// String returns the statement as "target: sql", or "target tx[id]: sql" when transacted
+func (this Statement) String() string {
+	if this.Tx == 0 {
+		return fmt.Sprintf("%s: %s", this.Target, this.Sql)
+	}
+	return fmt.Sprintf("%s tx%d: %s", this.Target, this.Tx, this.Sql)
+}
+
+// RecordingDriver is a DbDriver that records every statement instead of executing it.  Commits and rollbacks are
+// recorded like batches, so Errors and ErrorQueue can fail them too
+type RecordingDriver struct {
+	mssql.MssqlDbDriver
+	// Statements are the recorded statements, in execution order
+	Statements []Statement
+	// Errors maps a batch to the error returned when it's executed; batches not in the map succeed
+	Errors map[string]error
+	// ErrorQueue maps a batch to the errors returned by its next executions, in order; once a batch's queue is empty
+	// Errors is used.  Used to simulate transient errors that clear up on a retry
+	ErrorQueue map[string][]error
+	// OnExec when set, is called with each batch after it's recorded
+	OnExec func(sql string)
+
+	mu         sync.Mutex
+	conns      map[*gorm.DB]Statement
+	conn       *gorm.DB
+	masterConn *gorm.DB
+	tx         *gorm.DB
+	txSeq      int
+	// ended are the transactions opened by BeginTx that have been committed or rolled back
+	ended map[*gorm.DB]bool
+}
+
+// NewRecordingDriver returns a RecordingDriver for the given database configuration.  Unlike the real drivers, no
+// application configuration is loaded
+func NewRecordingDriver(dbConfig config.GenDbConfig, databaseType dbType.DbType) *RecordingDriver {
+	return &RecordingDriver{
+		MssqlDbDriver: mssql.MssqlDbDriver{
+			Base: dbDriver.Base{
+				GenDbConfig: dbConfig,
+				DbType:      databaseType,
+				CommitMode:  dbDriver.CommitAll,
+				SysDbName:   mssql.DefaultSysDbName,
+			},
+		},
+		Errors:     map[string]error{},
+		ErrorQueue: map[string][]error{},
+		conns:      map[*gorm.DB]Statement{},
+		ended:      map[*gorm.DB]bool{},
+	}
+}
+
+// GetSql returns the String() of each recorded statement
+func (this *RecordingDriver) GetSql() []string {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	sql := make([]string, len(this.Statements))
+	for i := range this.Statements {
+		sql[i] = this.Statements[i].String()
+	}
+	return sql
+}
+
+// newConn returns a placeholder connection that records statements against target and tx
+func (this *RecordingDriver) newConn(target string, tx int) *gorm.DB {
+	conn := &gorm.DB{}
+	this.conns[conn] = Statement{Target: target, Tx: tx}
+	return conn
+}
+
+// record appends a statement executed on conn
+func (this *RecordingDriver) record(conn *gorm.DB, sql string) error {
+	stmt, ok := this.conns[conn]
+	if !ok {
+		return fmt.Errorf("unknown connection")
+	}
+	stmt.Sql = sql
+	this.Statements = append(this.Statements, stmt)
+	return nil
+}
+
+// GetConnection returns the application database connection, or the open top-level transaction
+func (this *RecordingDriver) GetConnection() (*gorm.DB, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.tx != nil {
+		return this.tx, nil
+	}
+	if this.conn == nil {
+		this.conn = this.newConn(this.GenDbConfig.Name, 0)
+	}
+	return this.conn, nil
+}
+
+// GetMasterConnection returns the untransacted system database connection
+func (this *RecordingDriver) GetMasterConnection() (*gorm.DB, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.masterConn == nil {
+		this.masterConn = this.newConn(this.SysDbName, 0)
+	}
+	return this.masterConn, nil
+}
+
+// GetTx returns the top-level transaction fence, recording BeginSql when it's opened
+func (this *RecordingDriver) GetTx() (*gorm.DB, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.tx == nil {
+		this.txSeq++
+		this.tx = this.newConn(this.GenDbConfig.Name, this.txSeq)
+		_ = this.record(this.tx, BeginSql)
+	}
+	return this.tx, nil
+}
+
+// BeginTx records BeginSql on a new transaction independent of the top-level transaction fence
+func (this *RecordingDriver) BeginTx() (*gorm.DB, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.txSeq++
+	tx := this.newConn(this.GenDbConfig.Name, this.txSeq)
+	_ = this.record(tx, BeginSql)
+	return tx, nil
+}
+
+// CommitIndependentTx records CommitSql on a transaction opened by BeginTx
+func (this *RecordingDriver) CommitIndependentTx(tx *gorm.DB) error {
+	return this.endIndependentTx(tx, CommitSql)
+}
+
+// RollbackIndependentTx records RollbackSql on a transaction opened by BeginTx
+func (this *RecordingDriver) RollbackIndependentTx(tx *gorm.DB) error {
+	return this.endIndependentTx(tx, RollbackSql)
+}
+
+// endIndependentTx records sql on a transaction opened by BeginTx and closes it
+func (this *RecordingDriver) endIndependentTx(tx *gorm.DB, sql string) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if stmt, ok := this.conns[tx]; !ok || stmt.Tx == 0 || tx == this.tx || this.ended[tx] {
+		return fmt.Errorf("no transaction to end")
+	}
+	this.ended[tx] = true
+	err := this.record(tx, sql)
+	if err != nil {
+		return err
+	}
+	return this.nextErr(sql)
+}
+
+// HasTx returns true when the top-level transaction fence is open
+func (this *RecordingDriver) HasTx() bool {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.tx != nil
+}
+
+// CommitTx records CommitSql and closes the top-level transaction fence
+func (this *RecordingDriver) CommitTx() error {
+	return this.endTx(CommitSql)
+}
+
+// RollbackTx records RollbackSql and closes the top-level transaction fence
+func (this *RecordingDriver) RollbackTx() error {
+	return this.endTx(RollbackSql)
+}
+
+// endTx records sql on the top-level transaction fence and closes it
+func (this *RecordingDriver) endTx(sql string) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.tx == nil {
+		return fmt.Errorf("no transaction to end")
+	}
+	err := this.record(this.tx, sql)
+	this.tx = nil
+	if err != nil {
+		return err
+	}
+	return this.nextErr(sql)
+}
+
+// CloseConnection releases the application database connection
+func (this *RecordingDriver) CloseConnection() {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.conn = nil
+}
+
+// ExecBatch records the batch, then returns the next error in its ErrorQueue or its entry in Errors.  Like a real
+// connection, nothing is executed once ctx is done
+func (this *RecordingDriver) ExecBatch(ctx context.Context, conn *gorm.DB, sql string) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	this.mu.Lock()
+	err := this.record(conn, sql)
+	if err != nil {
+		this.mu.Unlock()
+		return err
+	}
+	err = this.nextErr(sql)
+	this.mu.Unlock()
+
+	if this.OnExec != nil {
+		this.OnExec(sql)
+	}
+	return err
+}
+
+// nextErr returns the next error in the batch's ErrorQueue, or its entry in Errors; the caller holds mu
+func (this *RecordingDriver) nextErr(sql string) (err error) {
+	err = this.Errors[sql]
+	if queue := this.ErrorQueue[sql]; len(queue) > 0 {
+		err, this.ErrorQueue[sql] = queue[0], queue[1:]
+	}
+	return err
+}
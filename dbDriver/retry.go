@@ -0,0 +1,77 @@
+package dbDriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"syscall"
+	"time"
+)
+
+const (
+	// DefaultRetryAttempts is the number of attempts used when config.RetryConfig.Attempts isn't set
+	DefaultRetryAttempts = 3
+	// DefaultRetryMaxDelay is the backoff cap used when config.RetryConfig.MaxDelay isn't set
+	DefaultRetryMaxDelay = 30 * time.Second
+
+	// retryBaseDelay is the delay before the first retry; it's doubled for each retry after that
+	retryBaseDelay = 500 * time.Millisecond
+)
+
+// Retry calls fn until it succeeds, returns an error that isn't transient (see DbDriver.IsTransientErr), the
+// driver's retry attempts are used up, or ctx is done.  Attempts are spaced with exponential backoff.  fn must be
+// safe to call again; it's responsible for reopening any transaction a failed attempt lost
+func Retry(ctx context.Context, driver DbDriver, fn func() error) (err error) {
+	return RetryIf(ctx, driver, driver.IsTransientErr, fn)
+}
+
+// RetryIf is Retry for callers that only retry some transient errors; fn is called again while isRetryable(err)
+func RetryIf(ctx context.Context, driver DbDriver, isRetryable func(err error) bool, fn func() error) (err error) {
+	policy := driver.GetRetryConfig()
+	attempts := policy.Attempts
+	if attempts <= 0 {
+		attempts = DefaultRetryAttempts
+	}
+	maxDelay := policy.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = DefaultRetryMaxDelay
+	}
+
+	delay := retryBaseDelay
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || attempt >= attempts || !isRetryable(err) {
+			return err
+		}
+
+		delay = min(delay, maxDelay)
+		slog.Warn("transient error, retrying", "db", driver.GetGenDbConfig().Name, "attempt", attempt, "attempts", attempts, "delay", delay, "error", err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
+
+// IsTransientNetErr checks for connection errors that are expected to clear up on their own: refused or reset
+// connections, and network timeouts.  Cancellation and the tool's own timeouts aren't transient
+func IsTransientNetErr(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNABORTED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
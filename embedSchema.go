@@ -0,0 +1,33 @@
+//go:build embedschema
+
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"kodb-import/artifacts"
+)
+
+// Builds with the embedschema tag compile the OpenKO-db Templates and ManualSetup directories into the binary, so it
+// works without the git submodule checked out.  The snapshot is the commit the submodule is checked out at when
+// building:
+//
+//	git submodule update --init --recursive
+//	go build -tags embedschema -ldflags "-X main.embeddedSchemaVersion=$(git -C OpenKO-db rev-parse --short HEAD)"
+//
+// A genConfig.schemaDir that exists on disk still overrides the embedded copy; see artifacts.GetSchemaFS
+
+//go:embed OpenKO-db/Templates OpenKO-db/ManualSetup
+var embeddedSchema embed.FS
+
+// embeddedSchemaVersion identifies the embedded OpenKO-db snapshot; set with -ldflags "-X main.embeddedSchemaVersion=..."
+var embeddedSchemaVersion = "unknown"
+
+func init() {
+	schema, err := fs.Sub(embeddedSchema, "OpenKO-db")
+	if err != nil {
+		panic(err)
+	}
+	artifacts.EmbeddedSchema = schema
+	artifacts.EmbeddedSchemaVersion = embeddedSchemaVersion
+}
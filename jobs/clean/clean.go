@@ -2,45 +2,92 @@ package clean
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"kodb-import/mssql"
-	"strings"
+	"kodb-import/dbDriver"
+	"log/slog"
+
+	"gorm.io/gorm"
 )
 
+// Outcome is what happened to a single object Clean tried to drop
+type Outcome string
+
 const (
-	dropUserSqlFmt = "DROP LOGIN [%s]"
-	dropDbSqlFmt   = "DROP DATABASE IF EXISTS [%s]"
+	// Dropped objects existed and were dropped
+	Dropped Outcome = "dropped"
+	// Missing objects didn't exist; the drop's error was ignorable (see DbDriver.IsIgnorableErr)
+	Missing Outcome = "missing"
+	// Failed objects couldn't be dropped
+	Failed Outcome = "failed"
 )
 
-// Clean will remove any existing [schemaConfig.gameDb.name] database and [schemaConfig.gameDb.users] from an mssql instance
-func Clean(ctx context.Context, driver *mssql.MssqlDbDriver) (err error) {
-	fmt.Println("-- Clean --")
-	conn, err := driver.GetMasterConnection()
-	if err != nil {
-		return err
+// Clean will remove any existing [schemaConfig.gameDb.name] database and [schemaConfig.gameDb.logins] from the
+// driver's server.  The database's open sessions are closed first, so a running game server doesn't block the drop;
+// database users are dropped with the database.  Every object is attempted and reported as dropped, missing, or
+// failed, and an error is returned if any of them failed
+func Clean(ctx context.Context, driver dbDriver.DbDriver) (err error) {
+	log := slog.With("db", driver.GetGenDbConfig().Name)
+	log.Info("clean started")
+	if driver.IsPlanMode() {
+		planClean(driver)
+		return nil
 	}
 
-	fmt.Printf("Dropping %s database... ", driver.GenDbConfig.Name)
-	err = conn.Exec(fmt.Sprintf(dropDbSqlFmt, driver.GenDbConfig.Name)).Error
+	// transient errors (see dbDriver.Retry) are retried; the drop statements are safe to repeat
+	var conn *gorm.DB
+	err = dbDriver.Retry(ctx, driver, func() (err error) {
+		conn, err = driver.GetMasterConnection()
+		return err
+	})
 	if err != nil {
 		return err
 	}
-	fmt.Println(" Done")
-
-	// If the users we're about to create exist in the system database, drop them
-	for _, user := range driver.GenDbConfig.Users {
-		fmt.Printf("Dropping user %s... ", user.Name)
-		err = conn.Exec(fmt.Sprintf(dropUserSqlFmt, user.Name)).Error
-		if err != nil {
-			// ignore failed drop error - user may not exist.
-			if !strings.HasPrefix(err.Error(), "mssql: Cannot drop the login") {
-				return err
-			}
-			fmt.Print(" Not found.")
-			err = nil
+
+	counts := map[Outcome]int{}
+	var errs []error
+	drop := func(object string, name string, sql string) {
+		err := dbDriver.Retry(ctx, driver, func() error {
+			return driver.ExecBatch(ctx, conn, sql)
+		})
+		switch {
+		case err == nil:
+			counts[Dropped]++
+			log.Info(object+" dropped", object, name)
+		case driver.IsIgnorableErr(err, sql):
+			counts[Missing]++
+			log.Info(object+" missing", object, name)
+		default:
+			counts[Failed]++
+			errs = append(errs, fmt.Errorf("failed to drop %s %s: %w", object, name, err))
+			log.Error(object+" failed", object, name, "error", err)
+		}
+	}
+
+	drop("database", driver.GetGenDbConfig().Name, driver.GetDropDatabaseSql(driver.GetGenDbConfig().Name))
+
+	// logins are server-level objects, so they outlive the database
+	for _, login := range driver.GetGenDbConfig().Logins {
+		if ctx.Err() != nil {
+			log.Warn("clean cancelled", "login", login.Name)
+			errs = append(errs, fmt.Errorf("clean cancelled before dropping login %s: %w", login.Name, ctx.Err()))
+			return errors.Join(errs...)
 		}
-		fmt.Println(" Done")
+		drop("login", login.Name, driver.GetDropLoginSql(login.Name))
 	}
 
-	return err
+	log.Info("clean completed", string(Dropped), counts[Dropped], string(Missing), counts[Missing], string(Failed), counts[Failed])
+	if len(errs) > 0 {
+		return fmt.Errorf("clean failed to drop %d object(s): %w", len(errs), errors.Join(errs...))
+	}
+	return nil
+}
+
+// planClean prints the statements Clean would execute without connecting to the server
+func planClean(driver dbDriver.DbDriver) {
+	fmt.Printf("[plan] target: %s\n", driver.GetSysDbName())
+	fmt.Printf("[plan]   %s\n", driver.GetDropDatabaseSql(driver.GetGenDbConfig().Name))
+	for _, login := range driver.GetGenDbConfig().Logins {
+		fmt.Printf("[plan]   %s\n", driver.GetDropLoginSql(login.Name))
+	}
 }
@@ -0,0 +1,126 @@
+package clean
+
+import (
+	"context"
+	"kodb-import/config"
+	"kodb-import/dbDriver/recordingDriver"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Open-KO/kodb-godef/enums/dbType"
+	mssqldb "github.com/microsoft/go-mssqldb"
+)
+
+// dropDbSql is the batch that closes KN_online's sessions and drops it
+const dropDbSql = "IF DB_ID(N'KN_online') IS NOT NULL ALTER DATABASE [KN_online] SET SINGLE_USER WITH ROLLBACK IMMEDIATE;\nDROP DATABASE [KN_online]"
+
+// newTestDriver returns a recording driver for a database with two logins that retries without waiting.  The users
+// are named differently from the logins; only logins are dropped from the server
+func newTestDriver() *recordingDriver.RecordingDriver {
+	driver := recordingDriver.NewRecordingDriver(config.GenDbConfig{
+		Name: "KN_online",
+		Logins: []config.LoginConfig{
+			{Name: "knight_game", Pass: "knight"},
+			{Name: "knight_web", Pass: "knight"},
+		},
+		Users: []config.UserConfig{
+			{Name: "knight", Schema: "knight"},
+		},
+	}, dbType.GAME)
+	driver.DbConfig.Retry = config.RetryConfig{Attempts: 3, MaxDelay: time.Millisecond}
+	return driver
+}
+
+func TestClean(t *testing.T) {
+	tests := []struct {
+		name       string
+		errors     map[string]error
+		errorQueue map[string][]error
+		want       []string
+		wantErr    bool
+	}{
+		{
+			name: "drops database and logins",
+			want: []string{
+				"master: " + dropDbSql,
+				"master: DROP LOGIN [knight_game]",
+				"master: DROP LOGIN [knight_web]",
+			},
+		},
+		{
+			name: "missing database and login are ignored",
+			errors: map[string]error{
+				dropDbSql:                  mssqldb.Error{Number: 3701, State: 1, Class: 11, Message: "Cannot drop the database 'KN_online', because it does not exist or you do not have permission."},
+				"DROP LOGIN [knight_game]": mssqldb.Error{Number: 15151, State: 1, Class: 16, Message: "Cannot drop the login 'knight_game', because it does not exist or you do not have permission."},
+			},
+			want: []string{
+				"master: " + dropDbSql,
+				"master: DROP LOGIN [knight_game]",
+				"master: DROP LOGIN [knight_web]",
+			},
+		},
+		{
+			name: "transient errors are retried",
+			errorQueue: map[string][]error{
+				dropDbSql:                 {mssqldb.Error{Number: 1205, Message: "Transaction (Process ID 52) was deadlocked on lock resources with another process and has been chosen as the deadlock victim. Rerun the transaction."}},
+				"DROP LOGIN [knight_web]": {syscall.ECONNRESET},
+			},
+			want: []string{
+				"master: " + dropDbSql,
+				"master: " + dropDbSql,
+				"master: DROP LOGIN [knight_game]",
+				"master: DROP LOGIN [knight_web]",
+				"master: DROP LOGIN [knight_web]",
+			},
+		},
+		{
+			name: "failed database drop still drops the logins",
+			errors: map[string]error{
+				dropDbSql: mssqldb.Error{Number: 5061, State: 1, Class: 16, Message: "ALTER DATABASE failed because a lock could not be placed on database 'KN_online'. Try again later."},
+			},
+			want: []string{
+				"master: " + dropDbSql,
+				"master: DROP LOGIN [knight_game]",
+				"master: DROP LOGIN [knight_web]",
+			},
+			wantErr: true,
+		},
+		{
+			name: "failed login drop is reported",
+			errors: map[string]error{
+				"DROP LOGIN [knight_game]": mssqldb.Error{Number: 15434, State: 1, Class: 16, Message: "Could not drop login 'knight_game' as the user is currently logged in."},
+			},
+			want: []string{
+				"master: " + dropDbSql,
+				"master: DROP LOGIN [knight_game]",
+				"master: DROP LOGIN [knight_web]",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driver := newTestDriver()
+			for sql, err := range tt.errors {
+				driver.Errors[sql] = err
+			}
+			for sql, errs := range tt.errorQueue {
+				driver.ErrorQueue[sql] = errs
+			}
+
+			err := Clean(context.Background(), driver)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Clean() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := driver.GetSql(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Clean() sql =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+			if driver.HasTx() {
+				t.Errorf("Clean() opened a transaction")
+			}
+		})
+	}
+}
@@ -0,0 +1,321 @@
+package diff
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"kodb-import/artifacts"
+	"kodb-import/jobs/migrate"
+	"kodb-import/mssql"
+	"log/slog"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	selectColumnsSql = "SELECT c.TABLE_SCHEMA, c.TABLE_NAME, c.COLUMN_NAME, c.DATA_TYPE, c.CHARACTER_MAXIMUM_LENGTH, " +
+		"c.NUMERIC_PRECISION, c.NUMERIC_SCALE, c.IS_NULLABLE " +
+		"FROM INFORMATION_SCHEMA.COLUMNS c JOIN INFORMATION_SCHEMA.TABLES t " +
+		"ON t.TABLE_SCHEMA = c.TABLE_SCHEMA AND t.TABLE_NAME = c.TABLE_NAME " +
+		"WHERE t.TABLE_TYPE = 'BASE TABLE' ORDER BY c.TABLE_SCHEMA, c.TABLE_NAME, c.ORDINAL_POSITION"
+	selectModulesSql = "SELECT s.name AS SchemaName, o.name AS Name, o.type AS Type, m.definition AS Definition " +
+		"FROM sys.sql_modules m JOIN sys.objects o ON o.object_id = m.object_id " +
+		"JOIN sys.schemas s ON s.schema_id = o.schema_id WHERE o.type IN ('V', 'P')"
+)
+
+// Change is how an object differs between OpenKO-db and the live database
+type Change string
+
+const (
+	// Added objects exist only in OpenKO-db; an import would add them
+	Added Change = "added"
+	// Removed objects exist only in the database
+	Removed Change = "removed"
+	// Changed objects exist in both, with different definitions
+	Changed Change = "changed"
+)
+
+var (
+	// ignoredTables are managed by this tool rather than OpenKO-db
+	ignoredTables = []string{strings.ToLower(migrate.SchemaVersionTableName)}
+)
+
+// infoSchemaColumn is a row of INFORMATION_SCHEMA.COLUMNS
+type infoSchemaColumn struct {
+	TableSchema            string `gorm:"column:TABLE_SCHEMA"`
+	TableName              string `gorm:"column:TABLE_NAME"`
+	ColumnName             string `gorm:"column:COLUMN_NAME"`
+	DataType               string `gorm:"column:DATA_TYPE"`
+	CharacterMaximumLength *int   `gorm:"column:CHARACTER_MAXIMUM_LENGTH"`
+	NumericPrecision       *int   `gorm:"column:NUMERIC_PRECISION"`
+	NumericScale           *int   `gorm:"column:NUMERIC_SCALE"`
+	IsNullable             string `gorm:"column:IS_NULLABLE"`
+}
+
+// sqlModule is a view or stored procedure definition from sys.sql_modules
+type sqlModule struct {
+	SchemaName string
+	Name       string
+	Type       string
+	Definition string
+}
+
+// moduleCheck maps an artifact file name format to the sys.objects type it creates
+type moduleCheck struct {
+	FileNameFmt string
+	Type        string
+	Kind        string
+}
+
+// Diff compares the live database's tables, columns, views, and stored procedures with the 5_CreateTable_*,
+// 7_CreateView_*, and 8_CreateStoredProc_* scripts in OpenKO-db.  Each difference is logged with its kind, object,
+// and Change relative to OpenKO-db.
+func Diff(ctx context.Context, driver *mssql.MssqlDbDriver) (err error) {
+	log := slog.With("db", driver.GetGenDbConfig().Name)
+	log.Info("diff started")
+	conn, err := driver.GetConnection()
+	if err != nil {
+		return err
+	}
+	fsys, err := artifacts.GetSchemaFS()
+	if err != nil {
+		return err
+	}
+	dir := artifacts.GetManualSetupFsDir(driver)
+	differences := 0
+
+	// tables and columns
+	repoTables, err := readRepoTables(fsys, dir)
+	if err != nil {
+		return err
+	}
+
+	liveColumns := []infoSchemaColumn{}
+	err = conn.Raw(selectColumnsSql).Scan(&liveColumns).Error
+	if err != nil {
+		return err
+	}
+	differences += diffTables(log, repoTables, getLiveTables(liveColumns))
+
+	// views and stored procedures
+	liveModules := []sqlModule{}
+	err = conn.Raw(selectModulesSql).Scan(&liveModules).Error
+	if err != nil {
+		return err
+	}
+
+	checks := []moduleCheck{
+		{artifacts.CreateViewFileNameFmt, "V", "view"},
+		{artifacts.CreateStoredProcedureFileNameFmt, "P", "procedure"},
+	}
+	for _, check := range checks {
+		repoModules, err := readRepoModules(fsys, dir, check.FileNameFmt)
+		if err != nil {
+			return err
+		}
+		differences += diffModules(log, check, repoModules, liveModules)
+	}
+
+	log.Info("diff completed", "differences", differences)
+	return nil
+}
+
+// getLiveTables groups INFORMATION_SCHEMA columns into tables, keyed by lower-case schema.table, with their types
+// normalized the same way as ParseCreateTables
+func getLiveTables(columns []infoSchemaColumn) (tables map[string]*mssql.TableDef) {
+	tables = map[string]*mssql.TableDef{}
+	for _, c := range columns {
+		key := strings.ToLower(c.TableSchema + "." + c.TableName)
+		if tables[key] == nil {
+			tables[key] = &mssql.TableDef{Schema: c.TableSchema, Name: c.TableName}
+		}
+		tables[key].Columns = append(tables[key].Columns, mssql.ColumnDef{
+			Name:       c.ColumnName,
+			Type:       mssql.NormalizeType(c.DataType, getTypeArgs(c)),
+			IsNullable: c.IsNullable == "YES",
+		})
+	}
+	return tables
+}
+
+// diffTables logs the tables and columns that differ between OpenKO-db and the live database
+func diffTables(log *slog.Logger, repoTables map[string]*mssql.TableDef, liveTables map[string]*mssql.TableDef) (differences int) {
+	for _, key := range sortedKeys(repoTables, liveTables) {
+		repoTable, liveTable := repoTables[key], liveTables[key]
+		switch {
+		case liveTable == nil:
+			log.Info("difference", "change", Added, "kind", "table", "object", repoTable.FullName())
+			differences++
+		case repoTable == nil:
+			if slices.Contains(ignoredTables, key) {
+				continue
+			}
+			log.Info("difference", "change", Removed, "kind", "table", "object", liveTable.FullName())
+			differences++
+		default:
+			differences += diffColumns(log, *repoTable, *liveTable)
+		}
+	}
+	return differences
+}
+
+// diffModules logs the modules of check's type that differ between OpenKO-db and sys.sql_modules; definitions are
+// compared after mssql.NormalizeSql
+func diffModules(log *slog.Logger, check moduleCheck, repoModules map[string]string, liveModules []sqlModule) (differences int) {
+	liveByName := map[string]sqlModule{}
+	for _, m := range liveModules {
+		if strings.TrimSpace(m.Type) == check.Type {
+			liveByName[strings.ToLower(m.Name)] = m
+		}
+	}
+
+	for _, key := range sortedKeys(repoModules, liveByName) {
+		repoDef, inRepo := repoModules[key]
+		live, inDb := liveByName[key]
+		switch {
+		case !inDb:
+			log.Info("difference", "change", Added, "kind", check.Kind, "object", key)
+			differences++
+		case !inRepo:
+			log.Info("difference", "change", Removed, "kind", check.Kind, "object", live.SchemaName+"."+live.Name)
+			differences++
+		case mssql.NormalizeSql(repoDef) != mssql.NormalizeSql(live.Definition):
+			log.Info("difference", "change", Changed, "kind", check.Kind, "object", live.SchemaName+"."+live.Name)
+			differences++
+		}
+	}
+	return differences
+}
+
+// diffColumns logs the column differences between the OpenKO-db and live definitions of a table
+func diffColumns(log *slog.Logger, repoTable mssql.TableDef, liveTable mssql.TableDef) (differences int) {
+	repoColumns := map[string]mssql.ColumnDef{}
+	for _, c := range repoTable.Columns {
+		repoColumns[strings.ToLower(c.Name)] = c
+	}
+	liveColumns := map[string]mssql.ColumnDef{}
+	for _, c := range liveTable.Columns {
+		liveColumns[strings.ToLower(c.Name)] = c
+	}
+
+	for _, key := range sortedKeys(repoColumns, liveColumns) {
+		repoColumn, inRepo := repoColumns[key]
+		liveColumn, inDb := liveColumns[key]
+		switch {
+		case !inDb:
+			log.Info("difference", "change", Added, "kind", "column", "object", repoTable.FullName()+"."+repoColumn.Name, "repo", formatColumn(repoColumn))
+			differences++
+		case !inRepo:
+			log.Info("difference", "change", Removed, "kind", "column", "object", liveTable.FullName()+"."+liveColumn.Name, "live", formatColumn(liveColumn))
+			differences++
+		case repoColumn.Type == "computed":
+			// computed column expressions aren't compared
+		case repoColumn.Type != liveColumn.Type || repoColumn.IsNullable != liveColumn.IsNullable:
+			log.Info("difference", "change", Changed, "kind", "column", "object", liveTable.FullName()+"."+liveColumn.Name, "repo", formatColumn(repoColumn), "live", formatColumn(liveColumn))
+			differences++
+		}
+	}
+
+	return differences
+}
+
+// readRepoTables parses every 5_CreateTable_*.sql script in the schema directory dir, keyed by lower-case schema.table
+func readRepoTables(fsys fs.FS, dir string) (tables map[string]*mssql.TableDef, err error) {
+	files, err := fs.Glob(fsys, path.Join(dir, fmt.Sprintf(artifacts.CreateTableFileNameFmt, "*")))
+	if err != nil {
+		return nil, err
+	}
+
+	tables = map[string]*mssql.TableDef{}
+	for _, file := range files {
+		sqlBytes, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		defs, err := mssql.ParseCreateTables(string(sqlBytes))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path.Base(file), err)
+		}
+		for i := range defs {
+			tables[strings.ToLower(defs[i].FullName())] = &defs[i]
+		}
+	}
+
+	return tables, nil
+}
+
+// readRepoModules reads the CREATE batch of every view/procedure script matching fileNameFmt, keyed by lower-case
+// object name
+func readRepoModules(fsys fs.FS, dir string, fileNameFmt string) (modules map[string]string, err error) {
+	files, err := fs.Glob(fsys, path.Join(dir, fmt.Sprintf(fileNameFmt, "*")))
+	if err != nil {
+		return nil, err
+	}
+
+	prefix, suffix, _ := strings.Cut(fileNameFmt, "%s")
+	modules = map[string]string{}
+	for _, file := range files {
+		sqlBytes, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		batches, err := mssql.SplitBatches(string(sqlBytes))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path.Base(file), err)
+		}
+
+		name := strings.TrimSuffix(strings.TrimPrefix(path.Base(file), prefix), suffix)
+		// the module definition is the batch that creates it; drops, USE, and SET batches are skipped
+		for i := range batches {
+			normalized := mssql.NormalizeSql(batches[i].Sql)
+			if strings.HasPrefix(normalized, "create view") || strings.HasPrefix(normalized, "create procedure") {
+				modules[strings.ToLower(name)] = batches[i].Sql
+				break
+			}
+		}
+	}
+
+	return modules, nil
+}
+
+// getTypeArgs returns the type arguments of an INFORMATION_SCHEMA column in CREATE TABLE syntax
+func getTypeArgs(c infoSchemaColumn) string {
+	switch strings.ToLower(c.DataType) {
+	case "decimal", "numeric":
+		if c.NumericPrecision != nil && c.NumericScale != nil {
+			return fmt.Sprintf("%d,%d", *c.NumericPrecision, *c.NumericScale)
+		}
+	default:
+		if c.CharacterMaximumLength != nil {
+			return strconv.Itoa(*c.CharacterMaximumLength)
+		}
+	}
+	return ""
+}
+
+// formatColumn returns a column's type and nullability
+func formatColumn(c mssql.ColumnDef) string {
+	if c.IsNullable {
+		return c.Type + " NULL"
+	}
+	return c.Type + " NOT NULL"
+}
+
+// sortedKeys returns the union of both maps' keys, sorted
+func sortedKeys[A any, B any](a map[string]A, b map[string]B) (keys []string) {
+	seen := map[string]bool{}
+	for k := range a {
+		seen[k] = true
+	}
+	for k := range b {
+		seen[k] = true
+	}
+	for k := range seen {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,289 @@
+package diff
+
+import (
+	"bytes"
+	"kodb-import/mssql"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const (
+	// createItemSql is the OpenKO-db definition of the ITEM table the INFORMATION_SCHEMA rows are compared with
+	createItemSql = "USE [KN_online]\nGO\n" +
+		"CREATE TABLE [dbo].[ITEM](\n" +
+		"\t[Num] [int] IDENTITY(1,1) NOT NULL,\n" +
+		"\t[strName] [varchar](50) NULL,\n" +
+		"\t[strDesc] [nvarchar](max) NOT NULL,\n" +
+		"\t[Price] [decimal](10, 2) NULL,\n" +
+		"\t[Total] AS ([Price]*(2)),\n" +
+		" CONSTRAINT [PK_ITEM] PRIMARY KEY CLUSTERED ([Num] ASC)\n" +
+		") ON [PRIMARY]\nGO\n"
+	createViewItemSql = "CREATE VIEW [dbo].[VIEW_ITEM]\nAS\nSELECT [Num], [strName] FROM [dbo].[ITEM] WHERE [strName] <> 'Sword'\n"
+	createGetItemSql  = "CREATE PROCEDURE [dbo].[GET_ITEM]\n\t@Num int\nAS\nSELECT * FROM [dbo].[ITEM] WHERE [Num] = @Num\n"
+)
+
+// newTestLog returns a logger that writes each record's attributes, without its time, level, or message, to the
+// returned buffer
+func newTestLog() (*slog.Logger, *bytes.Buffer) {
+	buf := &bytes.Buffer{}
+	handler := slog.NewTextHandler(buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey || a.Key == slog.LevelKey || a.Key == slog.MessageKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	return slog.New(handler), buf
+}
+
+// getLogLines returns the logged records, one per line
+func getLogLines(buf *bytes.Buffer) (lines []string) {
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+// getItemColumns returns the INFORMATION_SCHEMA rows of a live ITEM table that matches createItemSql
+func getItemColumns() []infoSchemaColumn {
+	return []infoSchemaColumn{
+		{TableSchema: "dbo", TableName: "ITEM", ColumnName: "Num", DataType: "int", NumericPrecision: intPtr(10), NumericScale: intPtr(0), IsNullable: "NO"},
+		{TableSchema: "dbo", TableName: "ITEM", ColumnName: "strName", DataType: "varchar", CharacterMaximumLength: intPtr(50), IsNullable: "YES"},
+		{TableSchema: "dbo", TableName: "ITEM", ColumnName: "strDesc", DataType: "nvarchar", CharacterMaximumLength: intPtr(-1), IsNullable: "NO"},
+		{TableSchema: "dbo", TableName: "ITEM", ColumnName: "Price", DataType: "decimal", NumericPrecision: intPtr(10), NumericScale: intPtr(2), IsNullable: "YES"},
+		{TableSchema: "dbo", TableName: "ITEM", ColumnName: "Total", DataType: "decimal", NumericPrecision: intPtr(21), NumericScale: intPtr(2), IsNullable: "YES"},
+	}
+}
+
+func TestDiffTables(t *testing.T) {
+	fsys := fstest.MapFS{"ManualSetup/5_CreateTable_ITEM.sql": {Data: []byte(createItemSql)}}
+	tests := []struct {
+		name string
+		// live changes the matching INFORMATION_SCHEMA rows of getItemColumns
+		live func(columns []infoSchemaColumn) []infoSchemaColumn
+		want []string
+	}{
+		{
+			name: "identical",
+			live: func(columns []infoSchemaColumn) []infoSchemaColumn { return columns },
+		},
+		{
+			name: "names differ in case",
+			live: func(columns []infoSchemaColumn) []infoSchemaColumn {
+				for i := range columns {
+					columns[i].TableName = "item"
+				}
+				columns[1].ColumnName = "STRNAME"
+				return columns
+			},
+		},
+		{
+			name: "length changed",
+			live: func(columns []infoSchemaColumn) []infoSchemaColumn {
+				columns[1].CharacterMaximumLength = intPtr(60)
+				return columns
+			},
+			want: []string{`change=changed kind=column object=dbo.ITEM.strName repo="varchar(50) NULL" live="varchar(60) NULL"`},
+		},
+		{
+			name: "max length changed",
+			live: func(columns []infoSchemaColumn) []infoSchemaColumn {
+				columns[2].CharacterMaximumLength = intPtr(4000)
+				return columns
+			},
+			want: []string{`change=changed kind=column object=dbo.ITEM.strDesc repo="nvarchar(max) NOT NULL" live="nvarchar(4000) NOT NULL"`},
+		},
+		{
+			name: "precision changed",
+			live: func(columns []infoSchemaColumn) []infoSchemaColumn {
+				columns[3].NumericPrecision = intPtr(12)
+				return columns
+			},
+			want: []string{`change=changed kind=column object=dbo.ITEM.Price repo="decimal(10,2) NULL" live="decimal(12,2) NULL"`},
+		},
+		{
+			name: "nullability changed",
+			live: func(columns []infoSchemaColumn) []infoSchemaColumn {
+				columns[0].IsNullable = "YES"
+				return columns
+			},
+			want: []string{`change=changed kind=column object=dbo.ITEM.Num repo="int NOT NULL" live="int NULL"`},
+		},
+		{
+			name: "computed column type",
+			live: func(columns []infoSchemaColumn) []infoSchemaColumn {
+				columns[4].NumericPrecision = intPtr(38)
+				return columns
+			},
+		},
+		{
+			name: "column added and removed",
+			live: func(columns []infoSchemaColumn) []infoSchemaColumn {
+				columns[3].ColumnName = "Weight"
+				return columns
+			},
+			want: []string{
+				`change=added kind=column object=dbo.ITEM.Price repo="decimal(10,2) NULL"`,
+				`change=removed kind=column object=dbo.ITEM.Weight live="decimal(10,2) NULL"`,
+			},
+		},
+		{
+			name: "table added and removed",
+			live: func(columns []infoSchemaColumn) []infoSchemaColumn {
+				return []infoSchemaColumn{{TableSchema: "dbo", TableName: "ZONE", ColumnName: "id", DataType: "int", IsNullable: "NO"}}
+			},
+			want: []string{
+				"change=added kind=table object=dbo.ITEM",
+				"change=removed kind=table object=dbo.ZONE",
+			},
+		},
+		{
+			name: "schema version table",
+			live: func(columns []infoSchemaColumn) []infoSchemaColumn {
+				return append(columns, infoSchemaColumn{TableSchema: "dbo", TableName: "SchemaVersion", ColumnName: "Version", DataType: "int", IsNullable: "NO"})
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repoTables, err := readRepoTables(fsys, "ManualSetup")
+			if err != nil {
+				t.Fatalf("readRepoTables() error = %v", err)
+			}
+			log, buf := newTestLog()
+
+			got := diffTables(log, repoTables, getLiveTables(tt.live(getItemColumns())))
+			if got != len(tt.want) {
+				t.Errorf("diffTables() = %d, want %d", got, len(tt.want))
+			}
+			if lines := getLogLines(buf); !reflect.DeepEqual(lines, tt.want) {
+				t.Errorf("diffTables() logged\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestDiffModules(t *testing.T) {
+	views := moduleCheck{Type: "V", Kind: "view"}
+	procs := moduleCheck{Type: "P", Kind: "procedure"}
+	tests := []struct {
+		name  string
+		check moduleCheck
+		repo  map[string]string
+		live  []sqlModule
+		want  []string
+	}{
+		{
+			name:  "identical",
+			check: views,
+			repo:  map[string]string{"view_item": createViewItemSql},
+			live:  []sqlModule{{SchemaName: "dbo", Name: "VIEW_ITEM", Type: "V ", Definition: createViewItemSql}},
+		},
+		{
+			name:  "whitespace, case, and comments",
+			check: views,
+			repo:  map[string]string{"view_item": createViewItemSql},
+			live: []sqlModule{{SchemaName: "dbo", Name: "VIEW_ITEM", Type: "V ", Definition: "-- items without swords\r\n" +
+				"create view [dbo].[VIEW_ITEM] as\r\n    select [Num], [strName] /* shown */ from [dbo].[ITEM]\r\n    where [strName] <> 'Sword'"}},
+		},
+		{
+			name:  "create or alter",
+			check: views,
+			repo:  map[string]string{"view_item": createViewItemSql},
+			live:  []sqlModule{{SchemaName: "dbo", Name: "VIEW_ITEM", Type: "V ", Definition: strings.Replace(createViewItemSql, "CREATE", "CREATE OR ALTER", 1)}},
+		},
+		{
+			name:  "proc",
+			check: procs,
+			repo:  map[string]string{"get_item": createGetItemSql},
+			live:  []sqlModule{{SchemaName: "dbo", Name: "GET_ITEM", Type: "P ", Definition: strings.Replace(createGetItemSql, "PROCEDURE", "PROC", 1)}},
+		},
+		{
+			name:  "string literal changed",
+			check: views,
+			repo:  map[string]string{"view_item": createViewItemSql},
+			live:  []sqlModule{{SchemaName: "dbo", Name: "VIEW_ITEM", Type: "V ", Definition: strings.Replace(createViewItemSql, "'Sword'", "'SWORD'", 1)}},
+			want:  []string{"change=changed kind=view object=dbo.VIEW_ITEM"},
+		},
+		{
+			name:  "quoted identifier changed",
+			check: views,
+			repo:  map[string]string{"view_item": createViewItemSql},
+			live:  []sqlModule{{SchemaName: "dbo", Name: "VIEW_ITEM", Type: "V ", Definition: strings.Replace(createViewItemSql, "[strName] FROM", "[STRNAME] FROM", 1)}},
+			want:  []string{"change=changed kind=view object=dbo.VIEW_ITEM"},
+		},
+		{
+			name:  "added and removed",
+			check: procs,
+			repo:  map[string]string{"get_item": createGetItemSql},
+			live:  []sqlModule{{SchemaName: "dbo", Name: "GET_ZONE", Type: "P ", Definition: "CREATE PROCEDURE [dbo].[GET_ZONE] AS SELECT 1"}},
+			want: []string{
+				"change=added kind=procedure object=get_item",
+				"change=removed kind=procedure object=dbo.GET_ZONE",
+			},
+		},
+		{
+			name:  "other type",
+			check: views,
+			live:  []sqlModule{{SchemaName: "dbo", Name: "GET_ITEM", Type: "P ", Definition: createGetItemSql}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log, buf := newTestLog()
+
+			got := diffModules(log, tt.check, tt.repo, tt.live)
+			if got != len(tt.want) {
+				t.Errorf("diffModules() = %d, want %d", got, len(tt.want))
+			}
+			if lines := getLogLines(buf); !reflect.DeepEqual(lines, tt.want) {
+				t.Errorf("diffModules() logged\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestReadRepoModules(t *testing.T) {
+	fsys := fstest.MapFS{
+		"ManualSetup/7_CreateView_VIEW_ITEM.sql": {Data: []byte("USE [KN_online]\nGO\n" +
+			"IF OBJECT_ID(N'[dbo].[VIEW_ITEM]') IS NOT NULL DROP VIEW [dbo].[VIEW_ITEM]\nGO\n" +
+			"SET ANSI_NULLS ON\nGO\n" +
+			"/* item view */\n" + createViewItemSql + "GO\n")},
+		"ManualSetup/8_CreateStoredProc_GET_ITEM.sql": {Data: []byte(createGetItemSql + "GO\n")},
+	}
+	tests := []struct {
+		name        string
+		fileNameFmt string
+		want        map[string]string
+	}{
+		{"views", "7_CreateView_%s.sql", map[string]string{"view_item": createViewItemSql}},
+		{"stored procedures", "8_CreateStoredProc_%s.sql", map[string]string{"get_item": createGetItemSql}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readRepoModules(fsys, "ManualSetup", tt.fileNameFmt)
+			if err != nil {
+				t.Fatalf("readRepoModules() error = %v", err)
+			}
+			// only the CREATE batch is kept; USE, DROP, and SET batches are skipped
+			if len(got) != len(tt.want) {
+				t.Fatalf("readRepoModules() = %q, want %q", got, tt.want)
+			}
+			for name := range tt.want {
+				if mssql.NormalizeSql(got[name]) != mssql.NormalizeSql(tt.want[name]) {
+					t.Errorf("readRepoModules()[%s] = %q, want %q", name, got[name], tt.want[name])
+				}
+			}
+		})
+	}
+}
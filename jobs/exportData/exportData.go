@@ -0,0 +1,298 @@
+package exportData
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"kodb-import/artifacts"
+	"kodb-import/jobs/migrate"
+	"kodb-import/mssql"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	selectTablesSql = "SELECT s.name AS SchemaName, t.name AS Name FROM sys.tables t " +
+		"JOIN sys.schemas s ON s.schema_id = t.schema_id WHERE t.is_ms_shipped = 0 ORDER BY t.name"
+	selectColumnsSql = "SELECT c.name AS Name, TYPE_NAME(c.system_type_id) AS Type, " +
+		"CAST(CASE WHEN ic.column_id IS NULL THEN 0 ELSE 1 END AS bit) AS IsPrimaryKey, ISNULL(ic.key_ordinal, 0) AS KeyOrdinal, " +
+		"c.is_identity AS IsIdentity " +
+		"FROM sys.columns c " +
+		"LEFT JOIN sys.indexes i ON i.object_id = c.object_id AND i.is_primary_key = 1 " +
+		"LEFT JOIN sys.index_columns ic ON ic.object_id = i.object_id AND ic.index_id = i.index_id AND ic.column_id = c.column_id " +
+		"WHERE c.object_id = OBJECT_ID(?) AND c.is_computed = 0 ORDER BY c.column_id"
+
+	// defaultSchemaName tables are written to 6_InsertData_[Table].sql; tables in other schemas include the schema name
+	defaultSchemaName = "dbo"
+)
+
+var (
+	// ignoredTables are managed by this tool rather than OpenKO-db
+	ignoredTables = []string{migrate.SchemaVersionTableName}
+)
+
+// table is a user table in the database
+type table struct {
+	SchemaName string
+	Name       string
+}
+
+// column is an insertable column of a table
+type column struct {
+	Name         string
+	Type         string
+	IsPrimaryKey bool
+	KeyOrdinal   int
+	IsIdentity   bool
+}
+
+// ExportData writes the contents of every table in the database to 6_InsertData_[Table].sql files in the
+// database's ManualSetup directory, in the format the import's data dump path consumes: one INSERT header line,
+// then one tuple per line ordered by primary key.  Tables outside the dbo schema are written to
+// 6_InsertData_[Schema].[Table].sql.  Tables with an identity column have the INSERT wrapped in SET IDENTITY_INSERT
+// ON/OFF lines, so the import inserts the exported identity values as is.  Existing header lines are kept when they
+// still match the table so round trips produce clean diffs.  Empty tables have their data file removed.
+func ExportData(ctx context.Context, driver *mssql.MssqlDbDriver) (err error) {
+	log := slog.With("db", driver.GetGenDbConfig().Name)
+	log.Info("export data started")
+	start := time.Now()
+	conn, err := driver.GetConnection()
+	if err != nil {
+		return err
+	}
+
+	tables := []table{}
+	err = conn.Raw(selectTablesSql).Scan(&tables).Error
+	if err != nil {
+		return err
+	}
+
+	dir := artifacts.GetManualSetupDir(driver)
+	for _, t := range tables {
+		if slices.ContainsFunc(ignoredTables, func(name string) bool { return strings.EqualFold(name, t.SchemaName+"."+t.Name) }) {
+			continue
+		}
+
+		path := filepath.Join(dir, fmt.Sprintf(artifacts.CreateTableDataFileNameFmt, getFileTableName(t)))
+		rowCount, err := exportTable(conn, t, path)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %v", t.SchemaName, t.Name, err)
+		}
+		log.Info("table exported", "kind", "table", "object", t.SchemaName+"."+t.Name, "file", filepath.Base(path), "rows", rowCount)
+	}
+
+	log.Info("export data completed", "tables", len(tables), "duration", time.Since(start))
+	return nil
+}
+
+// exportTable writes a single table's rows to path
+func exportTable(conn *gorm.DB, t table, path string) (rowCount int, err error) {
+	qualifiedName := fmt.Sprintf("[%s].[%s]", t.SchemaName, t.Name)
+	columns := []column{}
+	err = conn.Raw(selectColumnsSql, qualifiedName).Scan(&columns).Error
+	if err != nil {
+		return 0, err
+	}
+
+	names := make([]string, len(columns))
+	for i := range columns {
+		names[i] = "[" + columns[i].Name + "]"
+	}
+
+	rows, err := conn.Raw(fmt.Sprintf("SELECT %s FROM %s ORDER BY %s", strings.Join(names, ", "), qualifiedName, getOrderBy(columns))).Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	tuples := []string{}
+	values := make([]any, len(columns))
+	ptrs := make([]any, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for rows.Next() {
+		err = rows.Scan(ptrs...)
+		if err != nil {
+			return 0, err
+		}
+
+		literals := make([]string, len(columns))
+		for i := range values {
+			literals[i], err = formatValue(values[i], columns[i].Type)
+			if err != nil {
+				return 0, fmt.Errorf("column %s: %v", columns[i].Name, err)
+			}
+		}
+		tuples = append(tuples, "("+strings.Join(literals, ", ")+")")
+	}
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(tuples) == 0 {
+		err = os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return 0, err
+		}
+		return 0, nil
+	}
+
+	hasIdentity := slices.ContainsFunc(columns, func(c column) bool { return c.IsIdentity })
+	header := getHeader(path, qualifiedName, columns)
+	sb := strings.Builder{}
+	if hasIdentity {
+		sb.WriteString(fmt.Sprintf("SET IDENTITY_INSERT %s ON\n", qualifiedName))
+	}
+	sb.WriteString(header + "\n")
+	sb.WriteString(strings.Join(tuples, ",\n") + "\n")
+	if hasIdentity {
+		sb.WriteString(fmt.Sprintf("SET IDENTITY_INSERT %s OFF\n", qualifiedName))
+	}
+
+	return len(tuples), os.WriteFile(path, []byte(sb.String()), 0644)
+}
+
+// getFileTableName returns the table's name as used in its data file name; the schema is included when it isn't dbo,
+// so tables with the same name in different schemas don't overwrite each other
+func getFileTableName(t table) string {
+	if strings.EqualFold(t.SchemaName, defaultSchemaName) {
+		return t.Name
+	}
+	return t.SchemaName + "." + t.Name
+}
+
+// getHeader returns the INSERT header line for the table.  The existing file's header is reused when it lists the
+// same columns in the same order, or when it lists no columns and its rows have one value per column.  A header
+// without a column list isn't reused for tables with an identity column, since SET IDENTITY_INSERT requires one
+func getHeader(path string, qualifiedName string, columns []column) string {
+	names := make([]string, len(columns))
+	for i := range columns {
+		names[i] = columns[i].Name
+	}
+
+	sqlBytes, err := os.ReadFile(path)
+	if err == nil {
+		dump, pErr := mssql.ParseDataDump(filepath.Base(path), string(sqlBytes))
+		var inserts []*mssql.DumpInsert
+		if pErr == nil {
+			inserts = dump.Inserts()
+		}
+		if len(inserts) == 1 {
+			insert := inserts[0]
+			if len(insert.Columns) > 0 && slices.EqualFunc(insert.Columns, names, strings.EqualFold) {
+				return insert.Header
+			}
+			hasIdentity := slices.ContainsFunc(columns, func(c column) bool { return c.IsIdentity })
+			if len(insert.Columns) == 0 && !hasIdentity && hasValueCount(dump, len(columns)) {
+				return insert.Header
+			}
+		}
+	}
+
+	quoted := make([]string, len(names))
+	for i := range names {
+		quoted[i] = "[" + names[i] + "]"
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES", qualifiedName, strings.Join(quoted, ", "))
+}
+
+// hasValueCount returns true if every row of the dump has count values
+func hasValueCount(dump *mssql.DataDump, count int) bool {
+	for i := range dump.Records {
+		if dump.Records[i].Kind == mssql.DumpRow && len(dump.Records[i].Values) != count {
+			return false
+		}
+	}
+	return true
+}
+
+// getOrderBy returns a deterministic ORDER BY list: the primary key when there is one, otherwise every column
+func getOrderBy(columns []column) string {
+	keys := []column{}
+	for i := range columns {
+		if columns[i].IsPrimaryKey {
+			keys = append(keys, columns[i])
+		}
+	}
+	slices.SortFunc(keys, func(a, b column) int { return a.KeyOrdinal - b.KeyOrdinal })
+	if len(keys) == 0 {
+		keys = columns
+	}
+
+	order := []string{}
+	for i := range keys {
+		// blob columns can't be sorted
+		switch strings.ToLower(keys[i].Type) {
+		case "text", "ntext", "image":
+			continue
+		}
+		order = append(order, "["+keys[i].Name+"]")
+	}
+	if len(order) == 0 {
+		return "(SELECT NULL)"
+	}
+	return strings.Join(order, ", ")
+}
+
+// formatValue formats a scanned value as a T-SQL literal for the column type
+func formatValue(value any, sqlType string) (literal string, err error) {
+	if value == nil {
+		return "NULL", nil
+	}
+	sqlType = strings.ToLower(sqlType)
+
+	switch v := value.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case bool:
+		if v {
+			return "1", nil
+		}
+		return "0", nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32), nil
+	case string:
+		return quoteString(v, sqlType), nil
+	case time.Time:
+		switch sqlType {
+		case "date":
+			return "'" + v.Format("2006-01-02") + "'", nil
+		case "datetime2":
+			return "'" + v.Format("2006-01-02 15:04:05.9999999") + "'", nil
+		case "datetimeoffset":
+			return "'" + v.Format("2006-01-02 15:04:05.9999999 -07:00") + "'", nil
+		case "time":
+			return "'" + v.Format("15:04:05.9999999") + "'", nil
+		}
+		return "'" + v.Format("2006-01-02 15:04:05.000") + "'", nil
+	case []byte:
+		switch sqlType {
+		case "decimal", "numeric", "money", "smallmoney":
+			return string(v), nil
+		case "char", "varchar", "text", "nchar", "nvarchar", "ntext":
+			return quoteString(string(v), sqlType), nil
+		}
+		return "0x" + strings.ToUpper(hex.EncodeToString(v)), nil
+	}
+
+	return "", fmt.Errorf("unsupported value type %T for %s", value, sqlType)
+}
+
+// quoteString returns a string literal, N-prefixed for unicode column types
+func quoteString(s string, sqlType string) string {
+	literal := "'" + strings.ReplaceAll(s, "'", "''") + "'"
+	if strings.HasPrefix(sqlType, "n") {
+		return "N" + literal
+	}
+	return literal
+}
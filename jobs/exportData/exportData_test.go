@@ -0,0 +1,124 @@
+package exportData
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFormatValue(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 123456700, time.FixedZone("", -(5*60+30)*60))
+	tests := []struct {
+		name    string
+		value   any
+		sqlType string
+		want    string
+	}{
+		{name: "null", value: nil, sqlType: "int", want: "NULL"},
+		{name: "int", value: int64(-42), sqlType: "int", want: "-42"},
+		{name: "bit", value: true, sqlType: "bit", want: "1"},
+		{name: "float", value: float64(1.5), sqlType: "float", want: "1.5"},
+		{name: "varchar", value: "it's", sqlType: "varchar", want: "'it''s'"},
+		{name: "nvarchar", value: "Kılıç", sqlType: "nvarchar", want: "N'Kılıç'"},
+		{name: "decimal", value: []byte("12.3400"), sqlType: "decimal", want: "12.3400"},
+		{name: "varbinary", value: []byte{0x0a, 0xff}, sqlType: "varbinary", want: "0x0AFF"},
+		{name: "date", value: ts, sqlType: "date", want: "'2024-01-02'"},
+		{name: "datetime", value: ts, sqlType: "datetime", want: "'2024-01-02 03:04:05.123'"},
+		{name: "datetime2", value: ts, sqlType: "datetime2", want: "'2024-01-02 03:04:05.1234567'"},
+		{name: "datetimeoffset keeps its offset", value: ts, sqlType: "datetimeoffset", want: "'2024-01-02 03:04:05.1234567 -05:30'"},
+		{name: "time", value: ts, sqlType: "time", want: "'03:04:05.1234567'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := formatValue(tt.value, tt.sqlType)
+			if err != nil {
+				t.Fatalf("formatValue() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("formatValue() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetFileTableName(t *testing.T) {
+	tests := []struct {
+		table table
+		want  string
+	}{
+		{table: table{SchemaName: "dbo", Name: "ITEM"}, want: "ITEM"},
+		{table: table{SchemaName: "knight", Name: "ITEM"}, want: "knight.ITEM"},
+	}
+
+	for _, tt := range tests {
+		if got := getFileTableName(tt.table); got != tt.want {
+			t.Errorf("getFileTableName(%+v) = %s, want %s", tt.table, got, tt.want)
+		}
+	}
+}
+
+func TestGetHeader(t *testing.T) {
+	columns := []column{{Name: "Num", IsIdentity: true}, {Name: "strName"}}
+	plainColumns := []column{{Name: "Num"}, {Name: "strName"}}
+	newHeader := "INSERT INTO [dbo].[ITEM] ([Num], [strName]) VALUES"
+	tests := []struct {
+		name    string
+		file    string
+		columns []column
+		want    string
+	}{
+		{name: "no existing file", columns: columns, want: newHeader},
+		{
+			name:    "same columns keep the file's header",
+			file:    "INSERT [dbo].[ITEM] ([num],[strName]) VALUES\n(1, 'a')\n",
+			columns: columns,
+			want:    "INSERT [dbo].[ITEM] ([num],[strName]) VALUES",
+		},
+		{
+			name:    "same columns around IDENTITY_INSERT",
+			file:    "SET IDENTITY_INSERT [dbo].[ITEM] ON\nINSERT INTO ITEM (Num, strName) VALUES\n(1, 'a')\nSET IDENTITY_INSERT [dbo].[ITEM] OFF\n",
+			columns: columns,
+			want:    "INSERT INTO ITEM (Num, strName) VALUES",
+		},
+		{
+			name:    "changed columns",
+			file:    "INSERT INTO [dbo].[ITEM] ([strName], [Num]) VALUES\n('a', 1)\n",
+			columns: columns,
+			want:    newHeader,
+		},
+		{
+			name:    "no column list with one value per column",
+			file:    "INSERT INTO [dbo].[ITEM] VALUES\n(1, 'a'),\n(2, 'b')\n",
+			columns: plainColumns,
+			want:    "INSERT INTO [dbo].[ITEM] VALUES",
+		},
+		{
+			name:    "no column list with a different value count",
+			file:    "INSERT INTO [dbo].[ITEM] VALUES\n(1, 'a', 0)\n",
+			columns: plainColumns,
+			want:    newHeader,
+		},
+		{
+			name:    "no column list on an identity table",
+			file:    "INSERT INTO [dbo].[ITEM] VALUES\n(1, 'a')\n",
+			columns: columns,
+			want:    newHeader,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "6_InsertData_ITEM.sql")
+			if tt.file != "" {
+				if err := os.WriteFile(path, []byte(tt.file), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := getHeader(path, "[dbo].[ITEM]", tt.columns); got != tt.want {
+				t.Errorf("getHeader() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package importDb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"kodb-import/mssql"
+	"log/slog"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	mssqldb "github.com/microsoft/go-mssqldb"
+	"gorm.io/gorm"
+)
+
+const (
+	// bulkColumnsSql returns the column names and system types of a table, in column order
+	bulkColumnsSql = "SELECT c.name AS Name, TYPE_NAME(c.system_type_id) AS Type, c.is_identity AS IsIdentity " +
+		"FROM sys.columns c WHERE c.object_id = OBJECT_ID(?) ORDER BY c.column_id"
+)
+
+var (
+	// IsBulkCopy when true, table data is loaded with TDS bulk copy instead of INSERT batches
+	IsBulkCopy = false
+
+	// dateTimeLayouts are the literal formats accepted for date/time columns
+	dateTimeLayouts = []string{
+		"2006-01-02 15:04:05.999999999",
+		"2006-01-02T15:04:05.999999999",
+		"2006-01-02 15:04",
+		"2006-01-02",
+		"20060102 15:04:05.999999999",
+		"20060102",
+	}
+)
+
+// bulkColumn describes a destination table column for bulk copy
+type bulkColumn struct {
+	Name       string
+	Type       string
+	IsIdentity bool
+}
+
+// bulkCopyDump streams the rows of a parsed data dump to the server using TDS bulk copy; any other statements in the
+// dump are executed in order.  isLoaded is false when a table can't be bulk copied (identity or unsupported column
+// types, expression values); the caller should fall back to INSERT batches in that case.  The copy is cancelled with
+// ctx, or once it has run for timeout, if timeout is positive
+func bulkCopyDump(ctx context.Context, gormConn *gorm.DB, dump *mssql.DataDump, timeout time.Duration) (isLoaded bool, err error) {
+	sqlTx, ok := gormConn.Statement.ConnPool.(*sql.Tx)
+	if !ok {
+		return false, fmt.Errorf("bulk copy requires an open transaction")
+	}
+
+	// resolve and check every table before sending anything so a fallback doesn't leave partial data behind
+	inserts := dump.Inserts()
+	insertColumns := map[*mssql.DumpInsert][]bulkColumn{}
+	for _, insert := range inserts {
+		tableColumns := []bulkColumn{}
+		err = gormConn.WithContext(ctx).Raw(bulkColumnsSql, insert.Table).Scan(&tableColumns).Error
+		if err != nil {
+			return false, err
+		}
+		if len(tableColumns) == 0 {
+			return false, fmt.Errorf("%s:%d: table %s not found", dump.Name, insert.Line, insert.Table)
+		}
+
+		columns, err := getBulkColumns(tableColumns, insert.Columns)
+		if err != nil {
+			return false, fmt.Errorf("%s:%d: %w", dump.Name, insert.Line, err)
+		}
+		insertColumns[insert] = columns
+	}
+	if !isBulkCopyable(dump, insertColumns) {
+		return false, nil
+	}
+
+	var stmt *sql.Stmt
+	var stmtInsert *mssql.DumpInsert
+	// copyCtx limits the copy to the batch timeout
+	copyCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		copyCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	// copyErr annotates an error from the copy, reporting the batch timeout like ExecBatch does
+	copyErr := func(line int, err error) error {
+		if ctx.Err() == nil && errors.Is(copyCtx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("%s:%d: bulk copy timed out after %s: %w", dump.Name, line, timeout, context.DeadlineExceeded)
+		}
+		return fmt.Errorf("%s:%d: %w", dump.Name, line, err)
+	}
+	// an Exec without arguments flushes the remaining rows to the server
+	flush := func() error {
+		if stmt == nil {
+			return nil
+		}
+		_, fErr := stmt.ExecContext(copyCtx)
+		stmt.Close()
+		stmt = nil
+		if fErr != nil {
+			return copyErr(stmtInsert.Line, fErr)
+		}
+		return nil
+	}
+	defer func() {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}()
+
+	for i := range dump.Records {
+		record := dump.Records[i]
+		if record.Kind == mssql.DumpStatement {
+			err = flush()
+			if err != nil {
+				return false, err
+			}
+			err = gormConn.WithContext(copyCtx).Exec(record.Sql).Error
+			if err != nil {
+				return false, copyErr(record.Line, err)
+			}
+			continue
+		}
+
+		columns := insertColumns[record.Insert]
+		if record.Insert != stmtInsert {
+			err = flush()
+			if err != nil {
+				return false, err
+			}
+			names := make([]string, len(columns))
+			for j := range columns {
+				names[j] = columns[j].Name
+			}
+			stmt, err = sqlTx.PrepareContext(copyCtx, mssqldb.CopyIn(record.Insert.Table, mssqldb.BulkOptions{KeepNulls: true, Tablock: true}, names...))
+			if err != nil {
+				return false, copyErr(record.Insert.Line, err)
+			}
+			stmtInsert = record.Insert
+		}
+
+		if len(record.Values) != len(columns) {
+			return false, fmt.Errorf("%s:%d: row has %d values, expected %d", dump.Name, record.Line, len(record.Values), len(columns))
+		}
+		row := make([]any, len(columns))
+		for j := range record.Values {
+			row[j], err = toBulkValue(record.Values[j], columns[j].Type)
+			if err != nil {
+				return false, fmt.Errorf("%s:%d: column %s: %w", dump.Name, record.Line, columns[j].Name, err)
+			}
+		}
+
+		_, err = stmt.ExecContext(copyCtx, row...)
+		if err != nil {
+			return false, copyErr(record.Line, err)
+		}
+	}
+
+	err = flush()
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// isBulkCopyable returns false when any of the dump's rows can't be bulk copied into its resolved columns: identity or
+// unsupported column types, or expression values
+func isBulkCopyable(dump *mssql.DataDump, insertColumns map[*mssql.DumpInsert][]bulkColumn) bool {
+	for _, insert := range dump.Inserts() {
+		columns := insertColumns[insert]
+		for i := range columns {
+			if columns[i].IsIdentity || !isBulkType(columns[i].Type) {
+				slog.Info("column can't be bulk copied, using INSERT batches", "file", filepath.Base(dump.Name), "table", insert.Table, "column", columns[i].Name, "type", columns[i].Type)
+				return false
+			}
+		}
+	}
+	for i := range dump.Records {
+		for _, value := range dump.Records[i].Values {
+			if value.Kind == mssql.ExprLiteral {
+				slog.Info("expression values can't be bulk copied, using INSERT batches", "file", filepath.Base(dump.Name), "line", dump.Records[i].Line)
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// getBulkColumns orders the table's columns to match the dump's column list; all columns are used when the dump
+// doesn't specify a list
+func getBulkColumns(tableColumns []bulkColumn, columnNames []string) (columns []bulkColumn, err error) {
+	if len(columnNames) == 0 {
+		return tableColumns, nil
+	}
+
+	for _, name := range columnNames {
+		found := false
+		for i := range tableColumns {
+			if strings.EqualFold(tableColumns[i].Name, name) {
+				columns = append(columns, tableColumns[i])
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("column %s not found", name)
+		}
+	}
+
+	return columns, nil
+}
+
+// isBulkType returns true for the column types toBulkValue and go-mssqldb's bulk copy support
+func isBulkType(sqlType string) bool {
+	switch strings.ToLower(sqlType) {
+	case "tinyint", "smallint", "int", "bigint", "bit", "float", "real", "decimal", "numeric",
+		"char", "varchar", "nchar", "nvarchar", "text", "ntext",
+		"binary", "varbinary", "smalldatetime", "datetime", "datetime2", "date":
+		return true
+	}
+	return false
+}
+
+// toBulkValue converts a literal into the Go type go-mssqldb's bulk copy expects for the column type
+func toBulkValue(lit mssql.Literal, sqlType string) (value any, err error) {
+	if lit.Kind == mssql.NullLiteral {
+		return nil, nil
+	}
+
+	switch strings.ToLower(sqlType) {
+	case "tinyint", "smallint", "int", "bigint":
+		return strconv.ParseInt(lit.Text, 10, 64)
+	case "bit":
+		// like the server: any non-zero number is 1, and the strings 'TRUE'/'FALSE' are accepted
+		if b, pErr := strconv.ParseBool(strings.ToLower(lit.Text)); pErr == nil && lit.Kind == mssql.StringLiteral {
+			return b, nil
+		}
+		f, pErr := strconv.ParseFloat(lit.Text, 64)
+		if pErr != nil {
+			return nil, fmt.Errorf("unrecognized bit literal: %s", lit.Text)
+		}
+		return f != 0, nil
+	case "float", "real":
+		return strconv.ParseFloat(lit.Text, 64)
+	case "decimal", "numeric":
+		return lit.Text, nil
+	case "binary", "varbinary":
+		if lit.Kind != mssql.BinaryLiteral {
+			return nil, fmt.Errorf("expected a 0x binary literal")
+		}
+		return hex.DecodeString(lit.Text)
+	case "smalldatetime", "datetime", "datetime2", "date":
+		for i := range dateTimeLayouts {
+			t, pErr := time.Parse(dateTimeLayouts[i], lit.Text)
+			if pErr == nil {
+				return t, nil
+			}
+		}
+		return nil, fmt.Errorf("unrecognized date/time literal: %s", lit.Text)
+	default:
+		return lit.Text, nil
+	}
+}
@@ -0,0 +1,375 @@
+package importDb
+
+import (
+	"context"
+	"database/sql"
+	sqldriver "database/sql/driver"
+	"errors"
+	"io"
+	"kodb-import/dbDriver"
+	"kodb-import/mssql"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlserver"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestToBulkValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		sqlType string
+		want    any
+	}{
+		{name: "null", value: "NULL", sqlType: "int", want: nil},
+		{name: "null string", value: "NULL", sqlType: "varchar", want: nil},
+		{name: "int", value: "42", sqlType: "int", want: int64(42)},
+		{name: "negative smallint", value: "-7", sqlType: "smallint", want: int64(-7)},
+		{name: "bigint", value: "9223372036854775807", sqlType: "bigint", want: int64(9223372036854775807)},
+		{name: "type names are case insensitive", value: "1", sqlType: "TINYINT", want: int64(1)},
+		{name: "bit true", value: "1", sqlType: "bit", want: true},
+		{name: "bit false", value: "0", sqlType: "bit", want: false},
+		{name: "bit non-zero", value: "2", sqlType: "bit", want: true},
+		{name: "bit string", value: "'TRUE'", sqlType: "bit", want: true},
+		{name: "float", value: "1.5e2", sqlType: "float", want: float64(150)},
+		{name: "real", value: "-0.25", sqlType: "real", want: float64(-0.25)},
+		{name: "decimal keeps its precision", value: "12345678901234567890.123456789", sqlType: "decimal", want: "12345678901234567890.123456789"},
+		{name: "numeric", value: "-0.10", sqlType: "numeric", want: "-0.10"},
+		{name: "varchar", value: "'Sword'", sqlType: "varchar", want: "Sword"},
+		{name: "empty string isn't null", value: "''", sqlType: "varchar", want: ""},
+		{name: "nvarchar N'' string", value: "N'Kılıç'", sqlType: "nvarchar", want: "Kılıç"},
+		{name: "escaped quotes", value: "N'it''s'", sqlType: "nvarchar", want: "it's"},
+		{name: "multi-line string", value: "'a\r\nb'", sqlType: "text", want: "a\r\nb"},
+		{name: "char keeps padding", value: "'ab  '", sqlType: "char", want: "ab  "},
+		{name: "binary", value: "0x0A0bFF", sqlType: "varbinary", want: []byte{0x0A, 0x0B, 0xFF}},
+		{name: "empty binary", value: "0x", sqlType: "binary", want: []byte{}},
+		{name: "datetime", value: "'2024-01-02 03:04:05.123'", sqlType: "datetime", want: time.Date(2024, 1, 2, 3, 4, 5, 123000000, time.UTC)},
+		{name: "datetime ISO 8601", value: "'2024-01-02T03:04:05'", sqlType: "datetime2", want: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{name: "smalldatetime", value: "'2024-01-02 03:04'", sqlType: "smalldatetime", want: time.Date(2024, 1, 2, 3, 4, 0, 0, time.UTC)},
+		{name: "date", value: "'20240102'", sqlType: "date", want: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lit := parseTestValue(t, tt.value)
+			got, err := toBulkValue(lit, tt.sqlType)
+			if err != nil {
+				t.Fatalf("toBulkValue(%q, %s) error = %v", tt.value, tt.sqlType, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("toBulkValue(%q, %s) = %#v, want %#v", tt.value, tt.sqlType, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToBulkValueErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		sqlType string
+	}{
+		{name: "int out of range", value: "9223372036854775808", sqlType: "bigint"},
+		{name: "int from a decimal", value: "1.5", sqlType: "int"},
+		{name: "int from a string", value: "'abc'", sqlType: "int"},
+		{name: "bit from a word", value: "'yes'", sqlType: "bit"},
+		{name: "float from a string", value: "'abc'", sqlType: "float"},
+		{name: "binary from a string", value: "'0A0B'", sqlType: "varbinary"},
+		{name: "odd length binary", value: "0xABC", sqlType: "varbinary"},
+		{name: "unrecognized date", value: "'02/01/2024'", sqlType: "datetime"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lit := parseTestValue(t, tt.value)
+			got, err := toBulkValue(lit, tt.sqlType)
+			if err == nil {
+				t.Errorf("toBulkValue(%q, %s) = %#v, want error", tt.value, tt.sqlType, got)
+			}
+		})
+	}
+}
+
+func TestIsBulkCopyable(t *testing.T) {
+	columns := []bulkColumn{{Name: "Num", Type: "int"}, {Name: "strName", Type: "varchar"}}
+	tests := []struct {
+		name    string
+		row     string
+		columns []bulkColumn
+		want    bool
+	}{
+		{
+			name:    "literal values",
+			row:     "(1, N'Sword')",
+			columns: columns,
+			want:    true,
+		},
+		{
+			name:    "null values",
+			row:     "(1, NULL)",
+			columns: columns,
+			want:    true,
+		},
+		{
+			name:    "expression value falls back",
+			row:     "(1, CAST(N'Sword' AS varchar(50)))",
+			columns: columns,
+			want:    false,
+		},
+		{
+			name:    "identity column falls back",
+			row:     "(1, N'Sword')",
+			columns: []bulkColumn{{Name: "Num", Type: "int", IsIdentity: true}, {Name: "strName", Type: "varchar"}},
+			want:    false,
+		},
+		{
+			name:    "unsupported column type falls back",
+			row:     "(1, N'Sword')",
+			columns: []bulkColumn{{Name: "Num", Type: "int"}, {Name: "strName", Type: "sql_variant"}},
+			want:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dump, err := mssql.ParseDataDump("f.sql", "INSERT INTO [dbo].[ITEM] ([Num], [strName]) VALUES\n"+tt.row+"\n")
+			if err != nil {
+				t.Fatalf("ParseDataDump() error = %v", err)
+			}
+			insertColumns := map[*mssql.DumpInsert][]bulkColumn{dump.Inserts()[0]: tt.columns}
+			if got := isBulkCopyable(dump, insertColumns); got != tt.want {
+				t.Errorf("isBulkCopyable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetBulkColumns(t *testing.T) {
+	tableColumns := []bulkColumn{{Name: "Num", Type: "int"}, {Name: "strName", Type: "varchar"}, {Name: "Data", Type: "varbinary"}}
+
+	got, err := getBulkColumns(tableColumns, nil)
+	if err != nil || !reflect.DeepEqual(got, tableColumns) {
+		t.Errorf("getBulkColumns() without a column list = %v, %v, want every column", got, err)
+	}
+
+	// the dump's column order wins, and names are matched case insensitively
+	want := []bulkColumn{{Name: "Data", Type: "varbinary"}, {Name: "Num", Type: "int"}}
+	got, err = getBulkColumns(tableColumns, []string{"data", "Num"})
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("getBulkColumns() = %v, %v, want %v", got, err, want)
+	}
+
+	_, err = getBulkColumns(tableColumns, []string{"Num", "Missing"})
+	if err == nil {
+		t.Errorf("getBulkColumns() with an unknown column error = nil, want error")
+	}
+}
+
+// parseTestValue parses a single data dump value, the way a row's values are parsed for bulk copy
+func parseTestValue(t *testing.T, value string) mssql.Literal {
+	t.Helper()
+	dump, err := mssql.ParseDataDump("f.sql", "INSERT INTO T VALUES\n("+value+")\n")
+	if err != nil {
+		t.Fatalf("ParseDataDump(%q) error = %v", value, err)
+	}
+	if len(dump.Records) != 1 || len(dump.Records[0].Values) != 1 {
+		t.Fatalf("ParseDataDump(%q) = %+v, want a single value", value, dump.Records)
+	}
+	return dump.Records[0].Values[0]
+}
+
+// bulkTestSql is a data dump bulk copied by the bulkCopyDump tests
+const bulkTestSql = "INSERT INTO [dbo].[ITEM] ([Num], [strName]) VALUES\n(1, 'Sword'),\n(2, 'Shield')\n"
+
+// bulkTestConnector is a database/sql connector that stands in for the server in the bulkCopyDump tests.  Column
+// queries return ITEM's columns; every other statement is passed to exec
+type bulkTestConnector struct {
+	exec func(ctx context.Context, query string, args []sqldriver.NamedValue) error
+}
+
+func (this *bulkTestConnector) Connect(context.Context) (sqldriver.Conn, error) {
+	return &bulkTestConn{connector: this}, nil
+}
+
+func (this *bulkTestConnector) Driver() sqldriver.Driver {
+	return nil
+}
+
+type bulkTestConn struct {
+	connector *bulkTestConnector
+}
+
+func (this *bulkTestConn) Prepare(query string) (sqldriver.Stmt, error) {
+	return &bulkTestStmt{conn: this, query: query}, nil
+}
+
+func (this *bulkTestConn) Close() error {
+	return nil
+}
+
+func (this *bulkTestConn) Begin() (sqldriver.Tx, error) {
+	return this, nil
+}
+
+func (this *bulkTestConn) Commit() error {
+	return nil
+}
+
+func (this *bulkTestConn) Rollback() error {
+	return nil
+}
+
+type bulkTestStmt struct {
+	conn  *bulkTestConn
+	query string
+}
+
+func (this *bulkTestStmt) Close() error {
+	return nil
+}
+
+func (this *bulkTestStmt) NumInput() int {
+	return -1
+}
+
+func (this *bulkTestStmt) Exec([]sqldriver.Value) (sqldriver.Result, error) {
+	return nil, sqldriver.ErrSkip
+}
+
+func (this *bulkTestStmt) Query([]sqldriver.Value) (sqldriver.Rows, error) {
+	return nil, sqldriver.ErrSkip
+}
+
+func (this *bulkTestStmt) ExecContext(ctx context.Context, args []sqldriver.NamedValue) (sqldriver.Result, error) {
+	err := this.conn.connector.exec(ctx, this.query, args)
+	if err != nil {
+		return nil, err
+	}
+	return sqldriver.RowsAffected(0), nil
+}
+
+func (this *bulkTestStmt) QueryContext(context.Context, []sqldriver.NamedValue) (sqldriver.Rows, error) {
+	return &bulkTestRows{rows: [][]sqldriver.Value{{"Num", "int", false}, {"strName", "varchar", false}}}, nil
+}
+
+type bulkTestRows struct {
+	rows [][]sqldriver.Value
+}
+
+func (this *bulkTestRows) Columns() []string {
+	return []string{"Name", "Type", "IsIdentity"}
+}
+
+func (this *bulkTestRows) Close() error {
+	return nil
+}
+
+func (this *bulkTestRows) Next(dest []sqldriver.Value) error {
+	if len(this.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, this.rows[0])
+	this.rows = this.rows[1:]
+	return nil
+}
+
+// runBulkTestCopy bulk copies bulkTestSql in a transaction on a connection to connector, the way runScriptOnTx does
+func runBulkTestCopy(ctx context.Context, t *testing.T, connector *bulkTestConnector, timeout time.Duration) error {
+	t.Helper()
+	db, err := gorm.Open(sqlserver.New(sqlserver.Config{Conn: sql.OpenDB(connector)}), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("gorm.Open() error = %v", err)
+	}
+	dump, err := mssql.ParseDataDump("6_InsertData_ITEM.sql", bulkTestSql)
+	if err != nil {
+		t.Fatalf("ParseDataDump() error = %v", err)
+	}
+
+	tx := db.Begin()
+	isLoaded, err := bulkCopyDump(ctx, tx, dump, timeout)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if !isLoaded {
+		t.Fatalf("bulkCopyDump() isLoaded = false, want true")
+	}
+	return tx.Commit().Error
+}
+
+func TestBulkCopyDumpRetry(t *testing.T) {
+	driver := newTestDriver(t)
+	flushes := 0
+	connector := &bulkTestConnector{exec: func(ctx context.Context, query string, args []sqldriver.NamedValue) error {
+		// the copy is sent to the server when its rows are flushed by an Exec without arguments
+		if len(args) == 0 {
+			flushes++
+			if flushes == 1 {
+				return deadlockErr
+			}
+		}
+		return nil
+	}}
+
+	attempts := 0
+	err := dbDriver.Retry(context.Background(), driver, func() error {
+		attempts++
+		return runBulkTestCopy(context.Background(), t, connector, 0)
+	})
+	if err != nil {
+		t.Fatalf("Retry() error = %v", err)
+	}
+	if attempts != 2 {
+		t.Errorf("Retry() attempts = %d, want the deadlocked copy retried once", attempts)
+	}
+}
+
+func TestBulkCopyDumpDeadlockIsTransient(t *testing.T) {
+	driver := newTestDriver(t)
+	connector := &bulkTestConnector{exec: func(ctx context.Context, query string, args []sqldriver.NamedValue) error {
+		if len(args) == 0 {
+			return deadlockErr
+		}
+		return nil
+	}}
+
+	err := runBulkTestCopy(context.Background(), t, connector, 0)
+	if err == nil || !strings.HasPrefix(err.Error(), "6_InsertData_ITEM.sql:1: ") {
+		t.Fatalf("bulkCopyDump() error = %v, want the file and line of the INSERT", err)
+	}
+	if !driver.IsTransientErr(err) {
+		t.Errorf("IsTransientErr(%v) = false, want true", err)
+	}
+}
+
+func TestBulkCopyDumpCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	connector := &bulkTestConnector{exec: func(ctx context.Context, query string, args []sqldriver.NamedValue) error {
+		// SIGINT arrives while the first row is being sent
+		cancel()
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+
+	err := runBulkTestCopy(ctx, t, connector, time.Minute)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("bulkCopyDump() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestBulkCopyDumpTimeout(t *testing.T) {
+	connector := &bulkTestConnector{exec: func(ctx context.Context, query string, args []sqldriver.NamedValue) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+
+	err := runBulkTestCopy(context.Background(), t, connector, 10*time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "bulk copy timed out after 10ms") {
+		t.Errorf("bulkCopyDump() error = %v, want the batch timeout", err)
+	}
+}
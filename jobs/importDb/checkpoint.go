@@ -0,0 +1,181 @@
+package importDb
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// checkpointFileNameFmt is the name of a database's checkpoint file in CheckpointDir
+	checkpointFileNameFmt = "kodb-import-%s.checkpoint.yaml"
+)
+
+var (
+	// CheckpointDir is the directory checkpoint files are written to.  Checkpoints are written when the driver commits
+	// per stage or per file, and deleted once the import finishes
+	CheckpointDir = "."
+
+	// IsResume when true, ImportDb skips the stages and files recorded as committed in the database's checkpoint file
+	IsResume = false
+)
+
+// checkpointKey is the context key used to pass the active checkpoint to the stage functions
+type checkpointKey struct{}
+
+// FailedScript records where an import stopped
+type FailedScript struct {
+	Stage string `yaml:"stage"`
+	File  string `yaml:"file"`
+	Error string `yaml:"error"`
+}
+
+// Checkpoint records the stages and files of an import that have been committed to the server
+type Checkpoint struct {
+	DbName string        `yaml:"dbName"`
+	Stages []string      `yaml:"stages"`
+	Files  []string      `yaml:"files"`
+	Failed *FailedScript `yaml:"failed,omitempty"`
+
+	path  string
+	stage string
+	// isReadOnly checkpoints are consulted but never written; used by -plan
+	isReadOnly bool
+}
+
+// newCheckpoint returns an empty checkpoint for the database
+func newCheckpoint(dbName string) *Checkpoint {
+	return &Checkpoint{
+		DbName: dbName,
+		path:   filepath.Join(CheckpointDir, fmt.Sprintf(checkpointFileNameFmt, dbName)),
+	}
+}
+
+// loadCheckpoint reads the database's checkpoint file
+func loadCheckpoint(dbName string) (cp *Checkpoint, err error) {
+	cp = newCheckpoint(dbName)
+	cpBytes, err := os.ReadFile(cp.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no checkpoint to resume from; %s does not exist", cp.path)
+		}
+		return nil, err
+	}
+
+	err = yaml.Unmarshal(cpBytes, cp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", cp.path, err)
+	}
+
+	return cp, nil
+}
+
+// save writes the checkpoint to disk
+func (this *Checkpoint) save() error {
+	if this == nil || this.isReadOnly {
+		return nil
+	}
+
+	cpBytes, err := yaml.Marshal(this)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(this.path, cpBytes, 0644)
+}
+
+// remove deletes the checkpoint file once the import has finished
+func (this *Checkpoint) remove() error {
+	if this == nil || this.isReadOnly {
+		return nil
+	}
+
+	err := os.Remove(this.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// isStageDone returns true when the stage was committed by a previous run
+func (this *Checkpoint) isStageDone(stage string) bool {
+	return this != nil && slices.Contains(this.Stages, stage)
+}
+
+// isFileDone returns true when the script was committed by a previous run
+func (this *Checkpoint) isFileDone(script Script) bool {
+	return this != nil && slices.Contains(this.Files, filepath.Base(script.Name))
+}
+
+// pending returns the scripts that haven't been committed by a previous run
+func (this *Checkpoint) pending(sqlScripts []Script) (scripts []Script) {
+	if this == nil {
+		return sqlScripts
+	}
+
+	for i := range sqlScripts {
+		if this.isFileDone(sqlScripts[i]) {
+			slog.Info("script skipped; committed by a previous run", "db", this.DbName, "file", filepath.Base(sqlScripts[i].Name))
+			continue
+		}
+		scripts = append(scripts, sqlScripts[i])
+	}
+
+	return scripts
+}
+
+// completeFiles records committed scripts
+func (this *Checkpoint) completeFiles(sqlScripts ...Script) error {
+	if this == nil {
+		return nil
+	}
+
+	for i := range sqlScripts {
+		this.Files = append(this.Files, filepath.Base(sqlScripts[i].Name))
+	}
+	return this.save()
+}
+
+// completeStage records a committed stage
+func (this *Checkpoint) completeStage(stage string) error {
+	if this == nil {
+		return nil
+	}
+
+	this.Stages = append(this.Stages, stage)
+	this.Failed = nil
+	return this.save()
+}
+
+// fail records where the import stopped
+func (this *Checkpoint) fail(file string, err error) {
+	if this == nil {
+		return
+	}
+
+	this.Failed = &FailedScript{
+		Stage: this.stage,
+		File:  filepath.Base(file),
+		Error: err.Error(),
+	}
+	sErr := this.save()
+	if sErr != nil {
+		slog.Error("failed to save checkpoint", "db", this.DbName, "path", this.path, "error", sErr)
+	}
+}
+
+// withCheckpoint returns a copy of ctx carrying the checkpoint
+func withCheckpoint(ctx context.Context, cp *Checkpoint) context.Context {
+	return context.WithValue(ctx, checkpointKey{}, cp)
+}
+
+// getCheckpoint returns the checkpoint carried by ctx, or nil when checkpoints aren't in use
+func getCheckpoint(ctx context.Context) *Checkpoint {
+	cp, _ := ctx.Value(checkpointKey{}).(*Checkpoint)
+	return cp
+}
@@ -0,0 +1,225 @@
+package importDb
+
+import (
+	"context"
+	"errors"
+	"kodb-import/dbDriver"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	mssqldb "github.com/microsoft/go-mssqldb"
+)
+
+// createProcSql is the batch of testdata/OpenKO-db's procs stage
+const createProcSql = "CREATE PROCEDURE [dbo].[GET_ITEM] AS SELECT 1"
+
+// setResume sets IsResume for the duration of the test
+func setResume(t *testing.T, isResume bool) {
+	t.Helper()
+	IsResume = isResume
+	t.Cleanup(func() { IsResume = false })
+}
+
+func TestImportDbResume(t *testing.T) {
+	driver := newTestDriver(t)
+	driver.CommitMode = dbDriver.CommitFile
+	driver.Errors[createProcSql] = mssqldb.Error{Number: 2714, State: 3, Class: 16, LineNo: 1, Message: "There is already an object named 'GET_ITEM' in the database."}
+
+	// processDb rolls back the failed file's transaction
+	err := dbDriver.EndTx(driver, ImportDb(context.Background(), driver))
+	if err == nil {
+		t.Fatalf("ImportDb() error = nil, want error")
+	}
+
+	// every stage before procs was committed, and the checkpoint records where the import stopped
+	cp, err := loadCheckpoint(driver.GetGenDbConfig().Name)
+	if err != nil {
+		t.Fatalf("loadCheckpoint() error = %v", err)
+	}
+	wantStages := []string{"databases", "schemas", "users", "logins", "tables", "data", "views"}
+	if !reflect.DeepEqual(cp.Stages, wantStages) {
+		t.Errorf("checkpoint stages = %v, want %v", cp.Stages, wantStages)
+	}
+	if len(cp.Files) == 0 || !strings.HasPrefix(cp.Files[len(cp.Files)-1], "7_CreateView_") {
+		t.Errorf("checkpoint files = %v, want the committed files through 7_CreateView_VIEW_ITEM.sql", cp.Files)
+	}
+	if cp.Failed == nil || cp.Failed.Stage != "procs" || cp.Failed.File != "8_CreateStoredProc_GET_ITEM.sql" || !strings.Contains(cp.Failed.Error, "GET_ITEM") {
+		t.Errorf("checkpoint failed = %+v, want the procs script", cp.Failed)
+	}
+
+	// the resumed import continues from the failed script
+	setResume(t, true)
+	dir := CheckpointDir
+	driver = newTestDriver(t)
+	driver.CommitMode = dbDriver.CommitFile
+	CheckpointDir = dir
+	err = ImportDb(context.Background(), driver)
+	if err != nil {
+		t.Fatalf("ImportDb() resume error = %v", err)
+	}
+	want := []string{
+		"KN_online tx1: BEGIN TRANSACTION",
+		"KN_online tx1: " + createProcSql,
+		"KN_online tx1: COMMIT",
+		"KN_online tx2: BEGIN TRANSACTION",
+		"KN_online tx2: " + createVersionTableSql,
+		"KN_online tx2: " + recordMigrationSql,
+		"KN_online tx2: COMMIT",
+	}
+	if got := driver.GetSql(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ImportDb() resume sql =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// the checkpoint is removed once the import finishes
+	if _, err = os.Stat(cp.path); !os.IsNotExist(err) {
+		t.Errorf("checkpoint %s still exists after a successful import; stat error = %v", cp.path, err)
+	}
+}
+
+func TestImportDbResumeFiles(t *testing.T) {
+	driver := newTestDriver(t)
+	driver.CommitMode = dbDriver.CommitFile
+	// the tables stage stopped after its only file was committed
+	cp := newCheckpoint(driver.GetGenDbConfig().Name)
+	cp.Stages = []string{"databases", "schemas", "users", "logins"}
+	cp.Files = []string{"5_CreateTable_ITEM.sql"}
+	err := cp.save()
+	if err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+	setResume(t, true)
+
+	err = ImportDb(context.Background(), driver)
+	if err != nil {
+		t.Fatalf("ImportDb() error = %v", err)
+	}
+
+	// the committed file is skipped, then the remaining stages run
+	got := driver.GetSql()
+	for _, stmt := range got {
+		if strings.Contains(stmt, "CREATE TABLE [dbo].[ITEM]") || strings.Contains(stmt, "CREATE DATABASE") || strings.Contains(stmt, "CREATE LOGIN") {
+			t.Errorf("ImportDb() ran %q, committed by the previous run", stmt)
+		}
+	}
+	if len(got) == 0 || got[1] != "KN_online tx1: "+identityOnSql {
+		t.Errorf("ImportDb() sql =\n%s\nwant the data stage first", strings.Join(got, "\n"))
+	}
+}
+
+func TestImportDbPlanCheckpoint(t *testing.T) {
+	driver := newTestDriver(t)
+	driver.CommitMode = dbDriver.CommitFile
+	driver.IsPlan = true
+	path := newCheckpoint(driver.GetGenDbConfig().Name).path
+
+	err := ImportDb(context.Background(), driver)
+	if err != nil {
+		t.Fatalf("ImportDb() error = %v", err)
+	}
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("-plan wrote checkpoint %s; stat error = %v", path, err)
+	}
+
+	// a planned resume reads the checkpoint without changing or removing it
+	cp := newCheckpoint(driver.GetGenDbConfig().Name)
+	cp.Stages = []string{"databases", "schemas"}
+	cp.Failed = &FailedScript{Stage: "users", File: "3_CreateUser_knight.sql", Error: "failed"}
+	err = cp.save()
+	if err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+	before, _ := os.ReadFile(path)
+	setResume(t, true)
+
+	err = ImportDb(context.Background(), driver)
+	if err != nil {
+		t.Fatalf("ImportDb() resume error = %v", err)
+	}
+	after, err := os.ReadFile(path)
+	if err != nil || string(after) != string(before) {
+		t.Errorf("-plan -resume changed checkpoint %s to\n%s\nerror = %v", path, after, err)
+	}
+}
+
+func TestLoadCheckpointMissing(t *testing.T) {
+	CheckpointDir = t.TempDir()
+
+	_, err := loadCheckpoint("KN_online")
+	if err == nil || !strings.Contains(err.Error(), "no checkpoint to resume from") {
+		t.Errorf("loadCheckpoint() error = %v, want no checkpoint", err)
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	CheckpointDir = t.TempDir()
+	scripts := []Script{{Name: "dir/5_CreateTable_ITEM.sql"}, {Name: "dir/5_CreateTable_ZONE.sql"}}
+
+	cp := newCheckpoint("KN_online")
+	cp.stage = "tables"
+	if got := cp.pending(scripts); !reflect.DeepEqual(got, scripts) {
+		t.Errorf("pending() = %v, want every script", got)
+	}
+
+	err := cp.completeFiles(scripts[0])
+	if err != nil {
+		t.Fatalf("completeFiles() error = %v", err)
+	}
+	if got := cp.pending(scripts); !reflect.DeepEqual(got, scripts[1:]) {
+		t.Errorf("pending() = %v, want %v", got, scripts[1:])
+	}
+	cp.fail(scripts[1].Name, errors.New("Msg 2714"))
+
+	// the saved checkpoint has the committed file by name, and where the import stopped
+	loaded, err := loadCheckpoint("KN_online")
+	if err != nil {
+		t.Fatalf("loadCheckpoint() error = %v", err)
+	}
+	if !reflect.DeepEqual(loaded.Files, []string{"5_CreateTable_ITEM.sql"}) {
+		t.Errorf("loaded files = %v, want 5_CreateTable_ITEM.sql", loaded.Files)
+	}
+	wantFailed := &FailedScript{Stage: "tables", File: "5_CreateTable_ZONE.sql", Error: "Msg 2714"}
+	if !reflect.DeepEqual(loaded.Failed, wantFailed) {
+		t.Errorf("loaded failed = %+v, want %+v", loaded.Failed, wantFailed)
+	}
+
+	// completing the stage clears the failure
+	if loaded.isStageDone("tables") {
+		t.Errorf("isStageDone(tables) = true before the stage completed")
+	}
+	err = loaded.completeStage("tables")
+	if err != nil {
+		t.Fatalf("completeStage() error = %v", err)
+	}
+	if !loaded.isStageDone("tables") || loaded.Failed != nil {
+		t.Errorf("completeStage() stages = %v, failed = %+v, want tables done and no failure", loaded.Stages, loaded.Failed)
+	}
+
+	err = loaded.remove()
+	if err != nil {
+		t.Fatalf("remove() error = %v", err)
+	}
+	if _, err = os.Stat(loaded.path); !os.IsNotExist(err) {
+		t.Errorf("remove() left %s; stat error = %v", loaded.path, err)
+	}
+	if err = loaded.remove(); err != nil {
+		t.Errorf("remove() of a removed checkpoint error = %v, want nil", err)
+	}
+}
+
+func TestCheckpointNil(t *testing.T) {
+	// without checkpoints (CommitAll), nothing is skipped or written
+	var cp *Checkpoint
+	scripts := []Script{{Name: "5_CreateTable_ITEM.sql"}}
+	if got := cp.pending(scripts); !reflect.DeepEqual(got, scripts) {
+		t.Errorf("pending() = %v, want every script", got)
+	}
+	if cp.isStageDone("tables") || cp.isFileDone(scripts[0]) {
+		t.Errorf("nil checkpoint reports work done")
+	}
+	if err := cp.completeFiles(scripts...); err != nil {
+		t.Errorf("completeFiles() error = %v", err)
+	}
+	cp.fail(scripts[0].Name, errors.New("failed"))
+}
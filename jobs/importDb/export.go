@@ -0,0 +1,102 @@
+package importDb
+
+import (
+	"fmt"
+	"kodb-import/dbDriver"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// CombinedExportFileName is the name of the script containing every exported file, in import order
+	CombinedExportFileName = "kodb-import.sql"
+
+	// exportFileNameFmt prefixes exported files with their position in the import order
+	exportFileNameFmt = "%03d_%s"
+
+	// useDbSqlFmt is written at the top of each exported file so sqlcmd targets the right database
+	useDbSqlFmt = "USE [%s]"
+)
+
+// ScriptExporter writes the scripts ImportDb would execute to numbered *.sql files in Dir, plus a combined script
+// that can be run with sqlcmd -i
+type ScriptExporter struct {
+	Dir      string
+	seq      int
+	combined *os.File
+}
+
+// NewScriptExporter creates the export directory and the combined script file
+func NewScriptExporter(dir string) (exporter *ScriptExporter, err error) {
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	exporter = &ScriptExporter{Dir: dir}
+	exporter.combined, err = os.Create(filepath.Join(dir, CombinedExportFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = fmt.Fprintf(exporter.combined, "-- Generated by kodb-import; run with: sqlcmd -i %s\n\n", CombinedExportFileName)
+	if err != nil {
+		exporter.combined.Close()
+		return nil, err
+	}
+
+	return exporter, nil
+}
+
+// Close closes the combined script file
+func (this *ScriptExporter) Close() error {
+	if this.combined == nil {
+		return nil
+	}
+	err := this.combined.Close()
+	this.combined = nil
+	return err
+}
+
+// exportScripts renders each script into its batches and writes it to the next numbered file and the combined script
+func (this *ScriptExporter) exportScripts(driver dbDriver.DbDriver, scriptArgs ScriptArgs, sqlScripts ...Script) (err error) {
+	target := driver.GetGenDbConfig().Name
+	if scriptArgs.IsUseDefaultSystemDb {
+		target = driver.GetSysDbName()
+	}
+
+	for i := range sqlScripts {
+		sb := strings.Builder{}
+		sb.WriteString(fmt.Sprintf(useDbSqlFmt, target))
+		sb.WriteString("\nGO\n")
+		batches, err := getBatches(driver, sqlScripts[i], scriptArgs)
+		if err != nil {
+			return err
+		}
+		for j := range batches {
+			sb.WriteString(batches[j].Sql)
+			if batches[j].Repeat > 1 {
+				sb.WriteString(fmt.Sprintf("\nGO %d\n", batches[j].Repeat))
+			} else {
+				sb.WriteString("\nGO\n")
+			}
+		}
+
+		this.seq++
+		fileName := fmt.Sprintf(exportFileNameFmt, this.seq, filepath.Base(sqlScripts[i].Name))
+		err = os.WriteFile(filepath.Join(this.Dir, fileName), []byte(sb.String()), 0644)
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(this.combined, "-- %s\n%s\n", fileName, sb.String())
+		if err != nil {
+			return err
+		}
+		slog.Info("script exported", "db", driver.GetGenDbConfig().Name, "file", fileName)
+	}
+
+	return nil
+}
@@ -2,14 +2,17 @@ package importDb
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"kodb-import/artifacts"
-	"kodb-import/config"
+	"kodb-import/dbDriver"
+	"kodb-import/jobs/migrate"
 	"kodb-import/mssql"
 	"kodb-import/utils"
-	"os"
+	"log/slog"
+	"path"
 	"path/filepath"
-	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -17,6 +20,12 @@ import (
 
 var (
 
+	// Exporter when set, scripts are written to disk by the exporter instead of being executed
+	Exporter *ScriptExporter
+
+	// StageTimeout limits how long each import stage may take; 0 for no limit
+	StageTimeout time.Duration
+
 	// ImportBatSize is used to set the number of insert records sent in each batch.  Valid values 2-999.
 	ImportBatSize = 16
 
@@ -45,11 +54,12 @@ type Script struct {
 
 // ScriptArgs are arguments used in the runScripts function
 type ScriptArgs struct {
-	// IsUseDefaultSystemDb will use the mssql.DefaultSysDbName (master) when true.  Default false
+	// IsUseDefaultSystemDb will use the driver's system database (master) when true.  Default false
 	IsUseDefaultSystemDb bool
 
-	// IsDataDump set to true for loading one of our insert dumps; our dumps do not use "GO" batch separators and must be manually split
-	// this is done to keep our insert files diff-friendly and allow us to adjust the ImportBatSize for performance tuning
+	// IsDataDump set to true for loading one of our insert dumps; our dumps do not use "GO" batch separators and are
+	// parsed into rows and re-batched (see mssql.ParseDataDump). This is done to keep our insert files diff-friendly and
+	// allow us to adjust the ImportBatSize for performance tuning
 	IsDataDump bool
 }
 
@@ -61,145 +71,415 @@ func defaultScriptArgs() ScriptArgs {
 	}
 }
 
-// ImportDb attempts to load all *.sql batch files from the OpenKO-db project into an MSSQL instance
-// Database creation scripts execute against mssql.DefaultSysDbName, the rest should be
+// importStage is a named step of the import
+type importStage struct {
+	Name string
+	Run  func(ctx context.Context, driver dbDriver.DbDriver) error
+	// IsSystemDb stages run entirely on the system database connection, which isn't transacted, so they're committed
+	// as they go and aren't run again when a transaction fence is retried
+	IsSystemDb bool
+}
+
+// importStages are run in order by ImportDb; the names are recorded in checkpoint files
+var importStages = []importStage{
+	{Name: "databases", Run: importDbs, IsSystemDb: true},
+	{Name: "schemas", Run: importSchemas},
+	{Name: "users", Run: importUsers},
+	{Name: "logins", Run: importLogins, IsSystemDb: true},
+	{Name: "tables", Run: importTables},
+	{Name: "data", Run: importTableData},
+	{Name: "views", Run: importViews},
+	{Name: "procs", Run: importStoredProcs},
+	{Name: "migrations", Run: recordMigrations},
+}
+
+// ImportDb attempts to load all *.sql batch files from the OpenKO-db project into the driver's server
+// Database creation scripts execute against the driver's system database, the rest should be
 // executed using the created database named in schemaConfig.GameDb.Name
-func ImportDb(ctx context.Context, driver *mssql.MssqlDbDriver) (err error) {
-	fmt.Println("-- Import --")
+//
+// When the driver commits per stage or per file, progress is recorded in a checkpoint file so a failed import can be
+// continued with IsResume
+func ImportDb(ctx context.Context, driver dbDriver.DbDriver) (err error) {
+	log := slog.With("db", driver.GetGenDbConfig().Name)
+	log.Info("import started", "commit", driver.GetCommitMode())
+	start := time.Now()
 
-	err = importDbs(ctx, driver)
+	// render the templated scripts up front, so a broken template fails before anything is executed
+	err = artifacts.ValidateTemplates(driver)
 	if err != nil {
+		log.Error("invalid template", "error", err)
 		return err
 	}
 
-	// open tx to game db
-	_, err = driver.GetTx()
-	if err != nil {
-		return err
+	// with CommitAll, the workers need the table structures committed (see runScriptsParallel), so a failure can't
+	// simply be rolled back; the database and logins are dropped instead to keep the import all-or-nothing
+	if isParallel(driver) && driver.GetCommitMode() == dbDriver.CommitAll {
+		defer func() {
+			if err != nil {
+				dropTarget(ctx, driver)
+			}
+		}()
 	}
 
-	err = importSchemas(ctx, driver)
-	if err != nil {
-		return err
+	var cp *Checkpoint
+	if IsResume {
+		cp, err = loadCheckpoint(driver.GetGenDbConfig().Name)
+		if err != nil {
+			return err
+		}
+		log.Info("resuming import", "stages", len(cp.Stages), "files", len(cp.Files))
+		if cp.Failed != nil {
+			log.Info("previous run stopped", "stage", cp.Failed.Stage, "file", cp.Failed.File, "error", cp.Failed.Error)
+		}
+	} else if driver.GetCommitMode() != dbDriver.CommitAll {
+		cp = newCheckpoint(driver.GetGenDbConfig().Name)
 	}
-
-	err = importUsers(ctx, driver)
-	if err != nil {
-		return err
+	if cp != nil {
+		cp.isReadOnly = driver.IsPlanMode() || Exporter != nil
+		ctx = withCheckpoint(ctx, cp)
 	}
 
-	err = importLogins(ctx, driver)
-	if err != nil {
-		return err
+	// the stages run in transaction fences: the work between two commits.  With CommitAll/CommitStage a transient error
+	// rolls back the whole fence, so its stages are run again from the first one on a new transaction (see runFence)
+	done := map[string]bool{}
+	for i := 0; i < len(importStages); {
+		from := i
+		err = dbDriver.RetryIf(ctx, driver, isFenceErr, func() (err error) {
+			i, err = runFence(ctx, driver, cp, done, from)
+			if isFenceErr(err) {
+				rErr := driver.RollbackTx()
+				if rErr != nil {
+					log.Error("failed to rollback transaction", "error", rErr)
+				}
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
 	}
 
-	err = importTables(ctx, driver)
-	if err != nil {
-		return err
-	}
+	log.Info("import completed", "duration", time.Since(start))
 
-	err = importViews(ctx, driver)
-	if err != nil {
-		return err
+	// with CommitAll, the caller commits the top-level transaction; the checkpoint is no longer needed either way
+	return cp.remove()
+}
+
+// runFence runs the stages from importStages[from] until the work on the top-level transaction fence is committed, and
+// returns the index of the next stage.  Stages in done are skipped; IsSystemDb stages are added to it once they've
+// run, as a rolled back fence doesn't undo them
+func runFence(ctx context.Context, driver dbDriver.DbDriver, cp *Checkpoint, done map[string]bool, from int) (next int, err error) {
+	log := slog.With("db", driver.GetGenDbConfig().Name)
+	for i := from; i < len(importStages); i++ {
+		stage := importStages[i]
+		if done[stage.Name] {
+			continue
+		}
+		if cp.isStageDone(stage.Name) {
+			log.Info("stage skipped; committed by a previous run", "stage", stage.Name)
+			continue
+		}
+		if cp != nil {
+			cp.stage = stage.Name
+		}
+		if ctx.Err() != nil {
+			log.Warn("import stopped", "stage", stage.Name, "error", ctx.Err())
+			err = fmt.Errorf("stopped before stage %s: %w", stage.Name, ctx.Err())
+			cp.fail("", err)
+			return i, err
+		}
+
+		log.Info("stage started", "stage", stage.Name)
+		stageStart := time.Now()
+		err = runStage(ctx, driver, stage)
+		if err != nil {
+			log.Error("stage failed", "stage", stage.Name, "duration", time.Since(stageStart), "error", err)
+			return i, err
+		}
+		log.Info("stage completed", "stage", stage.Name, "duration", time.Since(stageStart))
+		if stage.IsSystemDb {
+			done[stage.Name] = true
+		}
+
+		if driver.GetCommitMode() == dbDriver.CommitStage && driver.HasTx() {
+			err = driver.CommitTx()
+			if err != nil {
+				cp.fail("", err)
+				return i, err
+			}
+		}
+		// stages that run entirely on the master connection are committed as they go
+		if driver.GetCommitMode() != dbDriver.CommitAll || !driver.HasTx() {
+			err = cp.completeStage(stage.Name)
+			if err != nil {
+				return i, err
+			}
+			// nothing is left on the fence, so the next stage starts a new one
+			return i + 1, nil
+		}
 	}
 
-	err = importStoredProcs(ctx, driver)
-	if err != nil {
-		return err
+	return len(importStages), nil
+}
+
+// runStage runs a single import stage, limited to StageTimeout when set
+func runStage(ctx context.Context, driver dbDriver.DbDriver, stage importStage) error {
+	if StageTimeout <= 0 {
+		return stage.Run(ctx, driver)
 	}
 
-	return nil
+	stageCtx, cancel := context.WithTimeout(ctx, StageTimeout)
+	defer cancel()
+	err := stage.Run(stageCtx, driver)
+	if err != nil && ctx.Err() == nil && errors.Is(stageCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("stage %s timed out after %s: %w", stage.Name, StageTimeout, err)
+	}
+	return err
 }
 
 // runScripts runs a related group of sql files.  Each file is broken down into batches (separated by the "GO" keyword)
 // and then executed/commited within a transaction fence.
-func runScripts(ctx context.Context, driver *mssql.MssqlDbDriver, scriptArgs ScriptArgs, sqlScripts ...Script) (err error) {
+func runScripts(ctx context.Context, driver dbDriver.DbDriver, scriptArgs ScriptArgs, sqlScripts ...Script) (err error) {
 	if len(sqlScripts) == 0 {
-		fmt.Println("WARN: No scripts to execute")
+		slog.Warn("no scripts to execute", "db", driver.GetGenDbConfig().Name)
 		return nil
 	}
 
-	// get gorm connection
-	var gormConn *gorm.DB
-	if scriptArgs.IsUseDefaultSystemDb {
-		gormConn, err = driver.GetMasterConnection()
-	} else {
-		gormConn, err = driver.GetTx()
+	cp := getCheckpoint(ctx)
+	sqlScripts = cp.pending(sqlScripts)
+
+	if driver.IsPlanMode() {
+		planScripts(driver, scriptArgs, sqlScripts...)
+		return nil
 	}
-	if err != nil {
-		return err
+
+	if Exporter != nil {
+		return Exporter.exportScripts(driver, scriptArgs, sqlScripts...)
 	}
 
 	for i := range sqlScripts {
-		batches := []string{}
-		if scriptArgs.IsDataDump {
+		err = runScriptWithRetry(ctx, driver, scriptArgs, sqlScripts[i])
+		if err != nil {
+			slog.Error("script failed", "db", driver.GetGenDbConfig().Name, "file", filepath.Base(sqlScripts[i].Name), "error", err)
+			cp.fail(sqlScripts[i].Name, err)
+			return err
+		}
 
-			lines := strings.Split(sqlScripts[i].Sql, "\n")
-			// sliding window batches
-			l := 1
-			r := l + ImportBatSize
+		if scriptArgs.IsUseDefaultSystemDb {
+			// master connection work isn't transacted, so it's committed already
+			err = cp.completeFiles(sqlScripts[i])
+		} else if driver.GetCommitMode() == dbDriver.CommitFile {
+			err = driver.CommitTx()
+			if err != nil {
+				cp.fail(sqlScripts[i].Name, err)
+				return err
+			}
+			err = cp.completeFiles(sqlScripts[i])
+		}
+		if err != nil {
+			return err
+		}
+	}
 
-			header := fmt.Sprintf("%s\n", lines[0])
-			for l < len(lines) {
-				// put r back on tail element if exceeded
-				if r >= len(lines) {
-					r = len(lines) - 1
-				}
+	return nil
+}
 
-				// remove any trailing "," from previous batch
-				if len(batches) > 0 {
-					batches[len(batches)-1] = strings.TrimSpace(batches[len(batches)-1])
-					batches[len(batches)-1] = strings.TrimSuffix(batches[len(batches)-1], ",")
-				}
+// runScriptWithRetry runs a script on the connection its ScriptArgs call for, retrying transient errors (see
+// dbDriver.Retry).  Master connection work isn't transacted, so runScript retries each batch on its own; with
+// CommitFile the whole file is retried on a new transaction fence.  On a shared transaction fence (CommitAll/
+// CommitStage) the work before the error is rolled back with it, so the error is returned as a *fenceErr for ImportDb
+// to run the fence again
+func runScriptWithRetry(ctx context.Context, driver dbDriver.DbDriver, scriptArgs ScriptArgs, script Script) (err error) {
+	// get gorm connection; with CommitFile each file gets a new transaction fence
+	var gormConn *gorm.DB
+	getConn := func() (err error) {
+		if scriptArgs.IsUseDefaultSystemDb {
+			gormConn, err = driver.GetMasterConnection()
+		} else {
+			gormConn, err = driver.GetTx()
+		}
+		return err
+	}
 
-				if l == r {
-					// make sure we didn't just land on the blank line at the end of the file
-					if strings.TrimSpace(lines[l]) == "" {
-						break
-					}
-				}
+	if scriptArgs.IsUseDefaultSystemDb || driver.GetCommitMode() != dbDriver.CommitFile {
+		err = dbDriver.Retry(ctx, driver, getConn)
+		if err != nil {
+			return err
+		}
+		err = runScript(ctx, driver, gormConn, scriptArgs, script)
+		if err != nil && !scriptArgs.IsUseDefaultSystemDb && driver.IsTransientErr(err) {
+			return &fenceErr{err: err}
+		}
+		return err
+	}
 
-				// capture current window as batch
-				// insert header
-				batch := header + strings.Join(lines[l:r+1], "\n")
-				batches = append(batches, batch)
-				l = r + 1
-				r += ImportBatSize
+	return dbDriver.Retry(ctx, driver, func() (err error) {
+		err = getConn()
+		if err != nil {
+			return err
+		}
+		err = runScript(ctx, driver, gormConn, scriptArgs, script)
+		if err != nil && driver.IsTransientErr(err) {
+			// the retry starts the file over on a new transaction fence
+			rErr := driver.RollbackTx()
+			if rErr != nil {
+				slog.Error("failed to rollback transaction", "db", driver.GetGenDbConfig().Name, "file", filepath.Base(script.Name), "error", rErr)
 			}
-		} else {
-			batches = splitBatches(sqlScripts[i].Sql)
 		}
+		return err
+	})
+}
 
-		for j := range batches {
-			err = gormConn.Exec(batches[j]).Error
+// fenceErr is a transient error on a shared transaction fence (CommitAll/CommitStage)
+type fenceErr struct {
+	err error
+}
+
+// Error returns the transient error's message
+func (this *fenceErr) Error() string {
+	return this.err.Error()
+}
+
+// Unwrap returns the transient error
+func (this *fenceErr) Unwrap() error {
+	return this.err
+}
+
+// isFenceErr checks if an error can be retried by running its transaction fence again
+func isFenceErr(err error) bool {
+	var fErr *fenceErr
+	return errors.As(err, &fErr)
+}
+
+// runScript executes a single sql file's batches on the given connection.  Batches on the master connection aren't
+// transacted, so transient errors are retried batch by batch
+func runScript(ctx context.Context, driver dbDriver.DbDriver, gormConn *gorm.DB, scriptArgs ScriptArgs, script Script) (err error) {
+	log := slog.With("db", driver.GetGenDbConfig().Name, "file", filepath.Base(script.Name))
+	start := time.Now()
+	progress := getProgress(ctx)
+	progress.startTable(script.Name)
+	rowsDone := 0
+	defer func() {
+		if err != nil {
+			progress.failTable(script.Name, rowsDone)
+		}
+	}()
+
+	if scriptArgs.IsDataDump && IsBulkCopy {
+		dump, err := mssql.ParseDataDump(script.Name, script.Sql)
+		if err != nil {
+			return err
+		}
+		isLoaded, err := bulkCopyDump(ctx, gormConn, dump, driver.GetTimeoutsConfig().Batch)
+		if err != nil {
+			log.Error("bulk copy failed", "duration", time.Since(start), "error", err)
+			return err
+		}
+		if isLoaded {
+			rowsDone = dump.RowCount()
+			progress.completeBatch(rowsDone)
+			progress.completeTable(script.Name)
+			log.Info("script completed", "rows", dump.RowCount(), "bulk", true, "duration", time.Since(start))
+			return nil
+		}
+	}
+
+	batches, err := getBatches(driver, script, scriptArgs)
+	if err != nil {
+		return err
+	}
+
+	for j := range batches {
+		// stop between batches; the caller rolls back the open transaction
+		if ctx.Err() != nil {
+			log.Warn("script stopped", "batch", j+1, "batches", len(batches), "line", batches[j].Line, "error", ctx.Err())
+			return fmt.Errorf("stopped before batch [%d/%d] at line %d in %s: %w", j+1, len(batches), batches[j].Line, filepath.Base(script.Name), ctx.Err())
+		}
+		batchStart := time.Now()
+		for k := 0; k < batches[j].Repeat; k++ {
+			exec := func() error {
+				return driver.ExecBatch(ctx, gormConn, batches[j].Sql)
+			}
+			if scriptArgs.IsUseDefaultSystemDb {
+				err = dbDriver.Retry(ctx, driver, exec)
+			} else {
+				err = exec()
+			}
 			if err != nil {
-				if !isIgnoreErr(err) {
-					fmt.Printf("error executing batch [%d/%d] in %s: %v\n", j+1, len(batches), sqlScripts[i].Name, err)
-					fmt.Printf("batch sql: %s", batches[j])
+				// a batch cancelled mid-flight fails with the driver's error, which doesn't always wrap ctx.Err()
+				if ctx.Err() != nil {
+					log.Warn("script stopped", "batch", j+1, "batches", len(batches), "line", batches[j].Line, "error", err)
+					return fmt.Errorf("stopped during batch [%d/%d] at line %d in %s: %w: %v", j+1, len(batches), batches[j].Line, filepath.Base(script.Name), ctx.Err(), err)
+				}
+				if !driver.IsIgnorableErr(err, batches[j].Sql) {
+					log.Error("batch failed", "batch", j+1, "batches", len(batches), "line", batches[j].Line, "sql", batches[j].Sql, "duration", time.Since(batchStart), "error", err)
 					return err
-				} else {
-					err = nil
 				}
+				log.Debug("batch error ignored", "batch", j+1, "line", batches[j].Line, "error", err)
+				err = nil
 			}
 		}
+		rowsDone += batches[j].Rows
+		progress.completeBatch(batches[j].Rows)
+		log.Debug("batch completed", "batch", j+1, "batches", len(batches), "line", batches[j].Line, "repeat", batches[j].Repeat, "duration", time.Since(batchStart))
 	}
+	progress.completeTable(script.Name)
 
+	log.Info("script completed", "batches", len(batches), "duration", time.Since(start))
 	return nil
 }
 
-// importDbs uses the CreateDatabase.sqltemplate to create the database configured in schemaConfig.gameDb
-func importDbs(ctx context.Context, driver *mssql.MssqlDbDriver) (err error) {
-	defer func() {
-		if err == nil {
-			fmt.Println("databases successfully imported")
+// getBatches breaks a script down into the batches that will be sent to the server.  Data dumps are parsed and
+// re-batched into groups of ImportBatSize rows
+func getBatches(driver dbDriver.DbDriver, script Script, scriptArgs ScriptArgs) (batches []dbDriver.Batch, err error) {
+	if !scriptArgs.IsDataDump {
+		batches, err = driver.SplitBatches(script.Sql)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", script.Name, err)
 		}
-	}()
-	fmt.Println("-- Importing databases --")
+		return batches, nil
+	}
+
+	dump, err := mssql.ParseDataDump(script.Name, script.Sql)
+	if err != nil {
+		return nil, err
+	}
+
+	return dump.Batches(ImportBatSize), nil
+}
+
+// planScripts prints the target connection, files, and batches runScripts would execute without connecting to the
+// server.  Data dump batches are summarized rather than printed in full.
+func planScripts(driver dbDriver.DbDriver, scriptArgs ScriptArgs, sqlScripts ...Script) {
+	target := driver.GetGenDbConfig().Name
+	if scriptArgs.IsUseDefaultSystemDb {
+		target = driver.GetSysDbName()
+	}
+	fmt.Printf("[plan] target: %s; %d file(s)\n", target, len(sqlScripts))
+
+	for i := range sqlScripts {
+		batches, err := getBatches(driver, sqlScripts[i], scriptArgs)
+		if err != nil {
+			fmt.Printf("[plan] %v\n", err)
+			continue
+		}
+		fmt.Printf("[plan] %s: %d batch(es)\n", sqlScripts[i].Name, len(batches))
+		if scriptArgs.IsDataDump {
+			continue
+		}
+		for j := range batches {
+			fmt.Printf("[plan]   batch [%d/%d] line %d, repeat %d:\n%s\n", j+1, len(batches), batches[j].Line, batches[j].Repeat, batches[j].Sql)
+		}
+	}
+}
+
+// importDbs uses the CreateDatabase.sqltemplate to create the database configured in schemaConfig.gameDb
+func importDbs(ctx context.Context, driver dbDriver.DbDriver) (err error) {
 	sArgs := defaultScriptArgs()
 	sArgs.IsUseDefaultSystemDb = true
 
 	script := Script{
-		Name: fmt.Sprintf(artifacts.CreateDatabaseFileNameFmt, driver.GenDbConfig.Name),
+		Name: fmt.Sprintf(artifacts.CreateDatabaseFileNameFmt, driver.GetGenDbConfig().Name),
 	}
 
 	script.Sql, err = artifacts.GetCreateDatabaseScript(driver)
@@ -211,18 +491,12 @@ func importDbs(ctx context.Context, driver *mssql.MssqlDbDriver) (err error) {
 }
 
 // importSchemas uses the CreateSchema.sqltemplate to create schemas defined in schemaConfig.gameDb.schemas
-func importSchemas(ctx context.Context, driver *mssql.MssqlDbDriver) (err error) {
-	defer func() {
-		if err == nil {
-			fmt.Println("schemas successfully imported")
-		}
-	}()
-	fmt.Println("-- Importing Schemas --")
+func importSchemas(ctx context.Context, driver dbDriver.DbDriver) (err error) {
 	sArgs := defaultScriptArgs()
 	scripts := []Script{}
-	for i := range driver.GenDbConfig.Schemas {
+	for i := range driver.GetGenDbConfig().Schemas {
 		script := Script{
-			Name: fmt.Sprintf(artifacts.CreateSchemaFileNameFmt, driver.GenDbConfig.Schemas[i]),
+			Name: fmt.Sprintf(artifacts.CreateSchemaFileNameFmt, driver.GetGenDbConfig().Schemas[i]),
 		}
 		script.Sql, err = artifacts.GetCreateSchemaScript(driver, i)
 		if err != nil {
@@ -236,18 +510,12 @@ func importSchemas(ctx context.Context, driver *mssql.MssqlDbDriver) (err error)
 }
 
 // importUsers uses the CreateUser.sqltemplate to create users defined in schemaConfig.gameDb.users
-func importUsers(ctx context.Context, driver *mssql.MssqlDbDriver) (err error) {
-	defer func() {
-		if err == nil {
-			fmt.Println("users successfully imported")
-		}
-	}()
-	fmt.Println("-- Importing Users --")
+func importUsers(ctx context.Context, driver dbDriver.DbDriver) (err error) {
 	sArgs := defaultScriptArgs()
 	scripts := []Script{}
-	for i := range driver.GenDbConfig.Users {
+	for i := range driver.GetGenDbConfig().Users {
 		script := Script{
-			Name: fmt.Sprintf(artifacts.CreateUserFileNameFmt, driver.GenDbConfig.Users[i].Name),
+			Name: fmt.Sprintf(artifacts.CreateUserFileNameFmt, driver.GetGenDbConfig().Users[i].Name),
 		}
 		script.Sql, err = artifacts.GetCreateUserScript(driver, i)
 		if err != nil {
@@ -261,19 +529,13 @@ func importUsers(ctx context.Context, driver *mssql.MssqlDbDriver) (err error) {
 }
 
 // importLogins uses the CreateLogin.sqltemplate to create logins defined in schemaConfig.gameDb.logins
-func importLogins(ctx context.Context, driver *mssql.MssqlDbDriver) (err error) {
-	defer func() {
-		if err == nil {
-			fmt.Println("logins successfully imported")
-		}
-	}()
-	fmt.Println("-- Importing Logins --")
+func importLogins(ctx context.Context, driver dbDriver.DbDriver) (err error) {
 	sArgs := defaultScriptArgs()
 	sArgs.IsUseDefaultSystemDb = true
 	scripts := []Script{}
-	for i := range driver.GenDbConfig.Logins {
+	for i := range driver.GetGenDbConfig().Logins {
 		script := Script{
-			Name: fmt.Sprintf(artifacts.CreateLoginFileNameFmt, driver.GenDbConfig.Logins[i].Name),
+			Name: fmt.Sprintf(artifacts.CreateLoginFileNameFmt, driver.GetGenDbConfig().Logins[i].Name),
 		}
 		script.Sql, err = artifacts.GetCreateLoginScript(driver, i)
 		if err != nil {
@@ -286,55 +548,82 @@ func importLogins(ctx context.Context, driver *mssql.MssqlDbDriver) (err error)
 	return runScripts(ctx, driver, sArgs, scripts...)
 }
 
-// importTables uses the openko-gorm model library to run CREATE TABLE sql scripts, then
-// inserts the table data defined in OpenKO-db/ManualSetup/6_InsertData_*.sql
-func importTables(ctx context.Context, driver *mssql.MssqlDbDriver) (err error) {
-	fmt.Println("-- Creating Tables --")
-
-	scripts, err := getSqlScriptsByPattern(filepath.Join(config.GetConfig().GenConfig.SchemaDir, artifacts.ManualSetupDir), fmt.Sprintf(artifacts.CreateTableFileNameFmt, "*"))
+// importTables uses the openko-gorm model library to run CREATE TABLE sql scripts
+func importTables(ctx context.Context, driver dbDriver.DbDriver) (err error) {
+	scripts, err := getSqlScriptsByPattern(artifacts.GetManualSetupFsDir(driver), fmt.Sprintf(artifacts.CreateTableFileNameFmt, "*"))
 	if err != nil {
 		return err
 	}
 
 	for i := range scripts {
-		scripts[i].Sql = utils.ReplaceUseDatabaseName(scripts[i].Sql, driver.GenDbConfig.Name)
-	}
-
-	err = runScripts(ctx, driver, defaultScriptArgs(), scripts...)
-	if err != nil {
-		return err
+		scripts[i].Sql = utils.ReplaceUseDatabaseName(scripts[i].Sql, driver.GetGenDbConfig().Name)
 	}
 
-	fmt.Println("table structures successfully created")
+	return runScripts(ctx, driver, defaultScriptArgs(), scripts...)
+}
 
-	fmt.Println("-- Importing Table Data --")
-	fmt.Println("this may take several minutes")
+// importTableData inserts the table data defined in OpenKO-db/ManualSetup/6_InsertData_*.sql
+func importTableData(ctx context.Context, driver dbDriver.DbDriver) (err error) {
 	start := time.Now()
 	args := defaultScriptArgs()
 	args.IsDataDump = true
-	scripts, err = getSqlScriptsByPattern(filepath.Join(config.GetConfig().GenConfig.SchemaDir, artifacts.ManualSetupDir), fmt.Sprintf(artifacts.CreateTableDataFileNameFmt, "*"))
+	scripts, err := getSqlScriptsByPattern(artifacts.GetManualSetupFsDir(driver), fmt.Sprintf(artifacts.CreateTableDataFileNameFmt, "*"))
 	if err != nil {
 		return err
 	}
 
-	err = runScripts(ctx, driver, args, scripts...)
+	if !driver.IsPlanMode() && Exporter == nil {
+		progress, err := scanProgress(ctx, driver, scripts)
+		if err != nil {
+			return err
+		}
+		ctx = withProgress(ctx, progress)
+		progress.run()
+		defer progress.finish()
+	}
+
+	if isParallel(driver) {
+		err = runScriptsParallel(ctx, driver, args, scripts...)
+	} else {
+		err = runScripts(ctx, driver, args, scripts...)
+	}
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("table data successfully imported in %.2f seconds; batch size %d\n", time.Since(start).Seconds(), ImportBatSize)
+	if IsBulkCopy {
+		slog.Info("table data imported", "db", driver.GetGenDbConfig().Name, "files", len(scripts), "bulk", true, "duration", time.Since(start))
+	} else {
+		slog.Info("table data imported", "db", driver.GetGenDbConfig().Name, "files", len(scripts), "batch_size", ImportBatSize, "duration", time.Since(start))
+	}
 	return nil
 }
 
-// importViews executes the *.sql scripts in OpenKO-db/Views
-func importViews(ctx context.Context, driver *mssql.MssqlDbDriver) (err error) {
-	defer func() {
-		if err == nil {
-			fmt.Println("views successfully imported")
+// scanProgress parses the table data scripts that haven't been committed by a previous run and returns a progress
+// tracker for their total row count
+func scanProgress(ctx context.Context, driver dbDriver.DbDriver, scripts []Script) (progress *importProgress, err error) {
+	cp := getCheckpoint(ctx)
+	tables := 0
+	rows := int64(0)
+	for i := range scripts {
+		if cp.isFileDone(scripts[i]) {
+			continue
 		}
-	}()
-	fmt.Println("-- Importing Views --")
-	scripts, err := getSqlScriptsByPattern(filepath.Join(config.GetConfig().GenConfig.SchemaDir, artifacts.ManualSetupDir), fmt.Sprintf(artifacts.CreateViewFileNameFmt, "*"))
+		dump, err := mssql.ParseDataDump(scripts[i].Name, scripts[i].Sql)
+		if err != nil {
+			return nil, err
+		}
+		tables++
+		rows += int64(dump.RowCount())
+	}
+	slog.Info("table data scanned", "db", driver.GetGenDbConfig().Name, "tables", tables, "rows", rows)
+
+	return newImportProgress(driver.GetGenDbConfig().Name, tables, rows), nil
+}
+
+// importViews executes the *.sql scripts in OpenKO-db/Views
+func importViews(ctx context.Context, driver dbDriver.DbDriver) (err error) {
+	scripts, err := getSqlScriptsByPattern(artifacts.GetManualSetupFsDir(driver), fmt.Sprintf(artifacts.CreateViewFileNameFmt, "*"))
 	if err != nil {
 		return err
 	}
@@ -342,15 +631,9 @@ func importViews(ctx context.Context, driver *mssql.MssqlDbDriver) (err error) {
 	return runScripts(ctx, driver, defaultScriptArgs(), scripts...)
 }
 
-// importViews executes the *.sql scripts in OpenKO-db/StoredProcedures
-func importStoredProcs(ctx context.Context, driver *mssql.MssqlDbDriver) (err error) {
-	defer func() {
-		if err == nil {
-			fmt.Println("stored procedures successfully imported")
-		}
-	}()
-	fmt.Println("-- Importing Stored Procedures --")
-	scripts, err := getSqlScriptsByPattern(filepath.Join(config.GetConfig().GenConfig.SchemaDir, artifacts.ManualSetupDir), fmt.Sprintf(artifacts.CreateStoredProcedureFileNameFmt, "*"))
+// importStoredProcs executes the *.sql scripts in OpenKO-db/StoredProcedures
+func importStoredProcs(ctx context.Context, driver dbDriver.DbDriver) (err error) {
+	scripts, err := getSqlScriptsByPattern(artifacts.GetManualSetupFsDir(driver), fmt.Sprintf(artifacts.CreateStoredProcedureFileNameFmt, "*"))
 	if err != nil {
 		return err
 	}
@@ -359,19 +642,38 @@ func importStoredProcs(ctx context.Context, driver *mssql.MssqlDbDriver) (err er
 	return runScripts(ctx, driver, sArgs, scripts...)
 }
 
-// getSqlScriptsByPattern returns the list of files from a directory matching the given pattern
+// recordMigrations creates the migrate.SchemaVersionTable and records every migration in the schema as applied, as the
+// ManualSetup scripts are already the latest schema; -migrate then only runs migrations added after the import
+func recordMigrations(ctx context.Context, driver dbDriver.DbDriver) (err error) {
+	migrations, err := migrate.GetMigrations(driver)
+	if err != nil {
+		return err
+	}
+
+	script := Script{
+		Name: artifacts.RecordMigrationsFileName,
+		Sql:  migrate.GetRecordScript(migrations),
+	}
+	return runScripts(ctx, driver, defaultScriptArgs(), script)
+}
+
+// getSqlScriptsByPattern returns the list of files from a directory of the schema (see artifacts.GetSchemaFS) matching
+// the given pattern
 func getSqlScriptsByPattern(dir string, pattern string) (sqlScripts []Script, err error) {
-	if _, err = os.Stat(dir); os.IsNotExist(err) {
+	fsys, err := artifacts.GetSchemaFS()
+	if err != nil {
+		return nil, err
+	}
+	if _, err = fs.Stat(fsys, dir); errors.Is(err, fs.ErrNotExist) {
 		return nil, fmt.Errorf("directory %s does not exist", dir)
 	}
-	fileNames, err := filepath.Glob(filepath.Join(dir, pattern))
+	fileNames, err := fs.Glob(fsys, path.Join(dir, pattern))
 	if err != nil {
 		return nil, err
 	}
 
 	for i := range fileNames {
-		//fmt.Printf("Reading %s\n", fileNames[i])
-		sqlBytes, err := os.ReadFile(fileNames[i])
+		sqlBytes, err := fs.ReadFile(fsys, fileNames[i])
 		if err != nil {
 			return nil, err
 		}
@@ -384,27 +686,3 @@ func getSqlScriptsByPattern(dir string, pattern string) (sqlScripts []Script, er
 
 	return sqlScripts, nil
 }
-
-// splitBatches breaks an MSSQL .sql dump file into batch groups.  MSSQL dump files use "GO" statements to separate
-// batches.  The GO statement is not standard SQL and is only supported inside of MS SQL Management Studio, so we
-// need to parse around it.
-func splitBatches(sql string) (batches []string) {
-	batches = strings.Split(sql, mssql.BatchTerminator)
-	for i := range batches {
-		batches[i] = strings.TrimSpace(batches[i])
-		if batches[i] == "" {
-			batches = append(batches[:i], batches[i+1:]...)
-		}
-	}
-	return batches
-}
-
-// isIgnoreErr checks an error to see if it can be ignored; These are errors related to
-// failed DROP statements after a database clean or new setup
-func isIgnoreErr(err error) bool {
-	if strings.HasPrefix(err.Error(), "mssql: Cannot drop the view") ||
-		strings.HasPrefix(err.Error(), "mssql: Cannot drop the procedure") {
-		return true
-	}
-	return false
-}
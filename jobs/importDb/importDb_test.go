@@ -0,0 +1,486 @@
+package importDb
+
+import (
+	"context"
+	"errors"
+	"kodb-import/artifacts"
+	"kodb-import/config"
+	"kodb-import/dbDriver"
+	"kodb-import/dbDriver/recordingDriver"
+	"kodb-import/mssql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/Open-KO/kodb-godef/enums/dbType"
+	mssqldb "github.com/microsoft/go-mssqldb"
+)
+
+const (
+	// identityOnSql and identityOffSql wrap the ITEM data batches (see mssql.DataDump.Batches)
+	identityOnSql  = "IF EXISTS (SELECT 1 FROM sys.identity_columns WHERE object_id = OBJECT_ID(N'[dbo].[ITEM]') AND name IN (N'Num', N'strName')) SET IDENTITY_INSERT [dbo].[ITEM] ON"
+	identityOffSql = "IF EXISTS (SELECT 1 FROM sys.identity_columns WHERE object_id = OBJECT_ID(N'[dbo].[ITEM]') AND name IN (N'Num', N'strName')) SET IDENTITY_INSERT [dbo].[ITEM] OFF"
+	// createVersionTableSql and recordMigrationSql record testdata/OpenKO-db/Migrations as applied
+	createVersionTableSql = "IF OBJECT_ID(N'[dbo].[SchemaVersion]', N'U') IS NULL CREATE TABLE [dbo].[SchemaVersion] ([Version] int NOT NULL CONSTRAINT [PK_SchemaVersion] PRIMARY KEY, [Name] nvarchar(260) NOT NULL, [AppliedAt] datetime2 NOT NULL CONSTRAINT [DF_SchemaVersion_AppliedAt] DEFAULT SYSUTCDATETIME())"
+	recordMigrationSql    = "INSERT INTO [dbo].[SchemaVersion] ([Version], [Name]) VALUES\n(1, N'1_AddItemPrice.sql')"
+)
+
+// newTestDriver returns a recording driver for the game database in testdata/kodb-import-config.yaml
+func newTestDriver(t *testing.T) *recordingDriver.RecordingDriver {
+	t.Helper()
+	config.ConfigPath = "testdata/kodb-import-config.yaml"
+	CheckpointDir = t.TempDir()
+	return recordingDriver.NewRecordingDriver(config.GetConfig().GenConfig.GameDbs[0], dbType.GAME)
+}
+
+// importSql is the statements an import of testdata/OpenKO-db records, in order, using CommitAll
+var importSql = []string{
+	"master: CREATE DATABASE [KN_online]",
+	"KN_online tx1: BEGIN TRANSACTION",
+	"KN_online tx1: CREATE SCHEMA [knight]",
+	"KN_online tx1: -- db KN_online",
+	"KN_online tx1: CREATE USER [knight] WITH DEFAULT_SCHEMA=[knight]",
+	"KN_online tx1: -- db KN_online",
+	"master: USE [KN_online]",
+	"master: CREATE LOGIN [knight] WITH PASSWORD=N'knight', DEFAULT_DATABASE=[KN_online]",
+	"KN_online tx1: USE [KN_online]",
+	"KN_online tx1: CREATE TABLE [dbo].[ITEM](\n\t[Num] [int] NOT NULL,\n\t[strName] [varchar](50) NULL,\n CONSTRAINT [PK_ITEM] PRIMARY KEY CLUSTERED ([Num] ASC)\n)",
+	"KN_online tx1: " + identityOnSql,
+	"KN_online tx1: INSERT INTO [dbo].[ITEM] ([Num], [strName]) VALUES\n(1, 'Sword'),\n(2, 'Shield'),\n(3, 'Bow')",
+	"KN_online tx1: " + identityOffSql,
+	"KN_online tx1: DROP VIEW [dbo].[VIEW_ITEM]",
+	"KN_online tx1: CREATE VIEW [dbo].[VIEW_ITEM] AS SELECT Num FROM ITEM",
+	"KN_online tx1: CREATE PROCEDURE [dbo].[GET_ITEM] AS SELECT 1",
+	"KN_online tx1: " + createVersionTableSql,
+	"KN_online tx1: " + recordMigrationSql,
+}
+
+func TestImportDb(t *testing.T) {
+	driver := newTestDriver(t)
+
+	err := ImportDb(context.Background(), driver)
+	if err != nil {
+		t.Fatalf("ImportDb() error = %v", err)
+	}
+	if got := driver.GetSql(); !reflect.DeepEqual(got, importSql) {
+		t.Errorf("ImportDb() sql =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(importSql, "\n"))
+	}
+	// with CommitAll the caller commits the top-level transaction
+	if !driver.HasTx() {
+		t.Errorf("ImportDb() closed the top-level transaction")
+	}
+}
+
+func TestImportDbIgnorableErr(t *testing.T) {
+	driver := newTestDriver(t)
+	// errors are matched by number, so a localized message is still ignored
+	driver.Errors["DROP VIEW [dbo].[VIEW_ITEM]"] = mssqldb.Error{Number: 3701, State: 5, Class: 11, LineNo: 1, Message: "Die Sicht 'dbo.VIEW_ITEM' kann nicht gelöscht werden, da sie nicht vorhanden ist oder Sie nicht über die erforderliche Berechtigung verfügen."}
+
+	err := ImportDb(context.Background(), driver)
+	if err != nil {
+		t.Fatalf("ImportDb() error = %v", err)
+	}
+	if got := driver.GetSql(); !reflect.DeepEqual(got, importSql) {
+		t.Errorf("ImportDb() sql =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(importSql, "\n"))
+	}
+}
+
+func TestImportDbIgnorableNumberErr(t *testing.T) {
+	driver := newTestDriver(t)
+	// ignorable numbers are only ignored for DROP batches
+	driver.Errors["CREATE VIEW [dbo].[VIEW_ITEM] AS SELECT Num FROM ITEM"] = mssqldb.Error{Number: 3701, State: 5, Class: 11, LineNo: 1, Message: "Cannot drop the table 'ITEM', because it does not exist or you do not have permission."}
+
+	err := ImportDb(context.Background(), driver)
+	if sqlErr, ok := mssql.AsSqlError(err); !ok || sqlErr.Number != 3701 {
+		t.Fatalf("ImportDb() error = %v, want Msg 3701", err)
+	}
+
+	want := importSql[:15]
+	if got := driver.GetSql(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ImportDb() sql =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestImportDbErr(t *testing.T) {
+	driver := newTestDriver(t)
+	driver.Errors["USE [KN_online]"] = mssqldb.Error{Number: 911, State: 1, Class: 16, LineNo: 1, Message: "Database 'KN_online' does not exist. Make sure that the name is entered correctly."}
+
+	err := ImportDb(context.Background(), driver)
+	if err == nil {
+		t.Fatalf("ImportDb() error = nil, want error")
+	}
+
+	// the import stops at the first batch that fails; logins are created on the master connection
+	want := importSql[:7]
+	if got := driver.GetSql(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ImportDb() sql =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestImportDbRollback(t *testing.T) {
+	driver := newTestDriver(t)
+	driver.CommitMode = dbDriver.CommitStage
+	driver.Errors["CREATE PROCEDURE [dbo].[GET_ITEM] AS SELECT 1"] = mssqldb.Error{Number: 2714, State: 3, Class: 16, LineNo: 1, Message: "There is already an object named 'GET_ITEM' in the database."}
+
+	err := ImportDb(context.Background(), driver)
+	if err == nil {
+		t.Fatalf("ImportDb() error = nil, want error")
+	}
+	if !driver.HasTx() {
+		t.Fatalf("ImportDb() closed the failed stage's transaction")
+	}
+	// processDb ends the fence with the job's error, which rolls the failed stage back
+	if endErr := dbDriver.EndTx(driver, err); endErr == nil {
+		t.Fatalf("EndTx() error = nil, want the import's error")
+	}
+	if driver.HasTx() {
+		t.Fatalf("EndTx() left the failed stage's transaction open")
+	}
+
+	want := []string{
+		"master: CREATE DATABASE [KN_online]",
+		"KN_online tx1: BEGIN TRANSACTION",
+		"KN_online tx1: CREATE SCHEMA [knight]",
+		"KN_online tx1: -- db KN_online",
+		"KN_online tx1: COMMIT",
+		"KN_online tx2: BEGIN TRANSACTION",
+		"KN_online tx2: CREATE USER [knight] WITH DEFAULT_SCHEMA=[knight]",
+		"KN_online tx2: -- db KN_online",
+		"KN_online tx2: COMMIT",
+		"master: USE [KN_online]",
+		"master: CREATE LOGIN [knight] WITH PASSWORD=N'knight', DEFAULT_DATABASE=[KN_online]",
+		"KN_online tx3: BEGIN TRANSACTION",
+		"KN_online tx3: USE [KN_online]",
+		"KN_online tx3: CREATE TABLE [dbo].[ITEM](\n\t[Num] [int] NOT NULL,\n\t[strName] [varchar](50) NULL,\n CONSTRAINT [PK_ITEM] PRIMARY KEY CLUSTERED ([Num] ASC)\n)",
+		"KN_online tx3: COMMIT",
+		"KN_online tx4: BEGIN TRANSACTION",
+		"KN_online tx4: " + identityOnSql,
+		"KN_online tx4: INSERT INTO [dbo].[ITEM] ([Num], [strName]) VALUES\n(1, 'Sword'),\n(2, 'Shield'),\n(3, 'Bow')",
+		"KN_online tx4: " + identityOffSql,
+		"KN_online tx4: COMMIT",
+		"KN_online tx5: BEGIN TRANSACTION",
+		"KN_online tx5: DROP VIEW [dbo].[VIEW_ITEM]",
+		"KN_online tx5: CREATE VIEW [dbo].[VIEW_ITEM] AS SELECT Num FROM ITEM",
+		"KN_online tx5: COMMIT",
+		"KN_online tx6: BEGIN TRANSACTION",
+		"KN_online tx6: CREATE PROCEDURE [dbo].[GET_ITEM] AS SELECT 1",
+		"KN_online tx6: ROLLBACK",
+	}
+	if got := driver.GetSql(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ImportDb() sql =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	cp, err := loadCheckpoint(driver.GenDbConfig.Name)
+	if err != nil {
+		t.Fatalf("loadCheckpoint() error = %v", err)
+	}
+	if cp.Failed == nil || cp.Failed.Stage != "procs" {
+		t.Errorf("checkpoint failed = %+v, want stage procs", cp.Failed)
+	}
+	wantStages := []string{"databases", "schemas", "users", "logins", "tables", "data", "views"}
+	if !reflect.DeepEqual(cp.Stages, wantStages) {
+		t.Errorf("checkpoint stages = %v, want %v", cp.Stages, wantStages)
+	}
+}
+
+func TestImportDbCancel(t *testing.T) {
+	driver := newTestDriver(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	driver.OnExec = func(sql string) {
+		if sql == "DROP VIEW [dbo].[VIEW_ITEM]" {
+			cancel()
+		}
+	}
+
+	err := ImportDb(ctx, driver)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("ImportDb() error = %v, want context.Canceled", err)
+	}
+	if !strings.Contains(err.Error(), "batch [2/2] at line 3 in 7_CreateView_VIEW_ITEM.sql") {
+		t.Errorf("ImportDb() error = %v, want the batch it stopped at", err)
+	}
+	if endErr := dbDriver.EndTx(driver, err); endErr == nil {
+		t.Fatalf("EndTx() error = nil, want the import's error")
+	}
+
+	// the import stops between batches; nothing after the cancelled batch is sent
+	want := append(append([]string{}, importSql[:14]...), "KN_online tx1: ROLLBACK")
+	if got := driver.GetSql(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ImportDb() sql =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestImportDbCancelDuringBatch(t *testing.T) {
+	driver := newTestDriver(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// the batch in flight fails with a connection error rather than context.Canceled
+	driver.Errors["DROP VIEW [dbo].[VIEW_ITEM]"] = errors.New("read tcp 127.0.0.1:51234->127.0.0.1:1433: use of closed network connection")
+	driver.OnExec = func(sql string) {
+		if sql == "DROP VIEW [dbo].[VIEW_ITEM]" {
+			cancel()
+		}
+	}
+
+	err := ImportDb(ctx, driver)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("ImportDb() error = %v, want context.Canceled", err)
+	}
+	if !strings.Contains(err.Error(), "stopped during batch [1/2] at line 1 in 7_CreateView_VIEW_ITEM.sql") || !strings.Contains(err.Error(), "use of closed network connection") {
+		t.Errorf("ImportDb() error = %v, want the batch it stopped at and its error", err)
+	}
+	if got := driver.GetSql(); !reflect.DeepEqual(got, importSql[:14]) {
+		t.Errorf("ImportDb() sql =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(importSql[:14], "\n"))
+	}
+}
+
+func TestImportDbStageTimeout(t *testing.T) {
+	driver := newTestDriver(t)
+	StageTimeout = 50 * time.Millisecond
+	defer func() { StageTimeout = 0 }()
+	driver.OnExec = func(sql string) {
+		if sql == "DROP VIEW [dbo].[VIEW_ITEM]" {
+			time.Sleep(2 * StageTimeout)
+		}
+	}
+
+	err := ImportDb(context.Background(), driver)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("ImportDb() error = %v, want context.DeadlineExceeded", err)
+	}
+	if !strings.Contains(err.Error(), "stage views timed out") {
+		t.Errorf("ImportDb() error = %v, want the stage that timed out", err)
+	}
+	if got := driver.GetSql(); !reflect.DeepEqual(got, importSql[:14]) {
+		t.Errorf("ImportDb() sql =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(importSql[:14], "\n"))
+	}
+}
+
+// deadlockErr is the transient error returned when a batch is chosen as a deadlock victim
+var deadlockErr = mssqldb.Error{Number: 1205, Message: "Transaction (Process ID 52) was deadlocked on lock resources with another process and has been chosen as the deadlock victim. Rerun the transaction."}
+
+func TestImportDbRetry(t *testing.T) {
+	driver := newTestDriver(t)
+	driver.CommitMode = dbDriver.CommitFile
+	driver.DbConfig.Retry = config.RetryConfig{Attempts: 3, MaxDelay: time.Millisecond}
+	driver.ErrorQueue["USE [KN_online]"] = []error{deadlockErr}
+	driver.ErrorQueue["INSERT INTO [dbo].[ITEM] ([Num], [strName]) VALUES\n(1, 'Sword'),\n(2, 'Shield'),\n(3, 'Bow')"] = []error{deadlockErr, deadlockErr}
+
+	err := ImportDb(context.Background(), driver)
+	if err != nil {
+		t.Fatalf("ImportDb() error = %v", err)
+	}
+
+	// master batches are retried on their own; transacted files start over on a new transaction
+	want := []string{
+		"master: CREATE DATABASE [KN_online]",
+		"KN_online tx1: BEGIN TRANSACTION",
+		"KN_online tx1: CREATE SCHEMA [knight]",
+		"KN_online tx1: -- db KN_online",
+		"KN_online tx1: COMMIT",
+		"KN_online tx2: BEGIN TRANSACTION",
+		"KN_online tx2: CREATE USER [knight] WITH DEFAULT_SCHEMA=[knight]",
+		"KN_online tx2: -- db KN_online",
+		"KN_online tx2: COMMIT",
+		"master: USE [KN_online]",
+		"master: USE [KN_online]",
+		"master: CREATE LOGIN [knight] WITH PASSWORD=N'knight', DEFAULT_DATABASE=[KN_online]",
+		"KN_online tx3: BEGIN TRANSACTION",
+		"KN_online tx3: USE [KN_online]",
+		"KN_online tx3: CREATE TABLE [dbo].[ITEM](\n\t[Num] [int] NOT NULL,\n\t[strName] [varchar](50) NULL,\n CONSTRAINT [PK_ITEM] PRIMARY KEY CLUSTERED ([Num] ASC)\n)",
+		"KN_online tx3: COMMIT",
+		"KN_online tx4: BEGIN TRANSACTION",
+		"KN_online tx4: " + identityOnSql,
+		"KN_online tx4: INSERT INTO [dbo].[ITEM] ([Num], [strName]) VALUES\n(1, 'Sword'),\n(2, 'Shield'),\n(3, 'Bow')",
+		"KN_online tx4: ROLLBACK",
+		"KN_online tx5: BEGIN TRANSACTION",
+		"KN_online tx5: " + identityOnSql,
+		"KN_online tx5: INSERT INTO [dbo].[ITEM] ([Num], [strName]) VALUES\n(1, 'Sword'),\n(2, 'Shield'),\n(3, 'Bow')",
+		"KN_online tx5: ROLLBACK",
+		"KN_online tx6: BEGIN TRANSACTION",
+		"KN_online tx6: " + identityOnSql,
+		"KN_online tx6: INSERT INTO [dbo].[ITEM] ([Num], [strName]) VALUES\n(1, 'Sword'),\n(2, 'Shield'),\n(3, 'Bow')",
+		"KN_online tx6: " + identityOffSql,
+		"KN_online tx6: COMMIT",
+		"KN_online tx7: BEGIN TRANSACTION",
+		"KN_online tx7: DROP VIEW [dbo].[VIEW_ITEM]",
+		"KN_online tx7: CREATE VIEW [dbo].[VIEW_ITEM] AS SELECT Num FROM ITEM",
+		"KN_online tx7: COMMIT",
+		"KN_online tx8: BEGIN TRANSACTION",
+		"KN_online tx8: CREATE PROCEDURE [dbo].[GET_ITEM] AS SELECT 1",
+		"KN_online tx8: COMMIT",
+		"KN_online tx9: BEGIN TRANSACTION",
+		"KN_online tx9: " + createVersionTableSql,
+		"KN_online tx9: " + recordMigrationSql,
+		"KN_online tx9: COMMIT",
+	}
+	if got := driver.GetSql(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ImportDb() sql =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestImportDbRetryAttempts(t *testing.T) {
+	driver := newTestDriver(t)
+	driver.CommitMode = dbDriver.CommitFile
+	driver.DbConfig.Retry = config.RetryConfig{Attempts: 2, MaxDelay: time.Millisecond}
+	driver.Errors["CREATE PROCEDURE [dbo].[GET_ITEM] AS SELECT 1"] = deadlockErr
+
+	err := ImportDb(context.Background(), driver)
+	var sqlErr mssqldb.Error
+	if !errors.As(err, &sqlErr) || sqlErr.Number != deadlockErr.Number {
+		t.Fatalf("ImportDb() error = %v, want the deadlock error", err)
+	}
+
+	// the file is tried Attempts times, each on its own transaction
+	want := []string{
+		"KN_online tx6: BEGIN TRANSACTION",
+		"KN_online tx6: CREATE PROCEDURE [dbo].[GET_ITEM] AS SELECT 1",
+		"KN_online tx6: ROLLBACK",
+		"KN_online tx7: BEGIN TRANSACTION",
+		"KN_online tx7: CREATE PROCEDURE [dbo].[GET_ITEM] AS SELECT 1",
+		"KN_online tx7: ROLLBACK",
+	}
+	got := driver.GetSql()
+	if len(got) < len(want) || !reflect.DeepEqual(got[len(got)-len(want):], want) {
+		t.Errorf("ImportDb() sql =\n%s\nwant suffix\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if driver.HasTx() {
+		t.Errorf("ImportDb() left the failed file's transaction open")
+	}
+}
+
+func TestImportDbSharedTxRetry(t *testing.T) {
+	driver := newTestDriver(t)
+	driver.DbConfig.Retry = config.RetryConfig{Attempts: 3, MaxDelay: time.Millisecond}
+	driver.ErrorQueue["INSERT INTO [dbo].[ITEM] ([Num], [strName]) VALUES\n(1, 'Sword'),\n(2, 'Shield'),\n(3, 'Bow')"] = []error{deadlockErr}
+
+	err := ImportDb(context.Background(), driver)
+	if err != nil {
+		t.Fatalf("ImportDb() error = %v", err)
+	}
+
+	// the deadlock rolled back the shared transaction, so its stages start over on a new one; the database and login
+	// were created on the master connection and are kept
+	want := append([]string{}, importSql[:12]...)
+	want = append(want, "KN_online tx1: ROLLBACK")
+	for _, sql := range importSql[1:] {
+		if strings.HasPrefix(sql, "KN_online tx1: ") {
+			want = append(want, "KN_online tx2: "+strings.TrimPrefix(sql, "KN_online tx1: "))
+		}
+	}
+	if got := driver.GetSql(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ImportDb() sql =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestImportDbSharedTxRetryAttempts(t *testing.T) {
+	driver := newTestDriver(t)
+	driver.CommitMode = dbDriver.CommitStage
+	driver.DbConfig.Retry = config.RetryConfig{Attempts: 2, MaxDelay: time.Millisecond}
+	driver.Errors["CREATE PROCEDURE [dbo].[GET_ITEM] AS SELECT 1"] = deadlockErr
+
+	err := ImportDb(context.Background(), driver)
+	var sqlErr mssqldb.Error
+	if !errors.As(err, &sqlErr) || sqlErr.Number != deadlockErr.Number {
+		t.Fatalf("ImportDb() error = %v, want the deadlock error", err)
+	}
+
+	// with CommitStage the fence is the procs stage alone; it's tried Attempts times, each on its own transaction
+	want := []string{
+		"KN_online tx6: BEGIN TRANSACTION",
+		"KN_online tx6: CREATE PROCEDURE [dbo].[GET_ITEM] AS SELECT 1",
+		"KN_online tx6: ROLLBACK",
+		"KN_online tx7: BEGIN TRANSACTION",
+		"KN_online tx7: CREATE PROCEDURE [dbo].[GET_ITEM] AS SELECT 1",
+		"KN_online tx7: ROLLBACK",
+	}
+	got := driver.GetSql()
+	if len(got) < len(want) || !reflect.DeepEqual(got[len(got)-len(want):], want) {
+		t.Errorf("ImportDb() sql =\n%s\nwant suffix\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if driver.HasTx() {
+		t.Errorf("ImportDb() left the failed stage's transaction open")
+	}
+}
+
+func TestImportDbEmbeddedSchema(t *testing.T) {
+	driver := newTestDriver(t)
+	conf := config.GetConfig()
+	schemaDir := conf.GenConfig.SchemaDir
+	defer func() {
+		conf.GenConfig.SchemaDir = schemaDir
+		artifacts.EmbeddedSchema = nil
+	}()
+
+	// an existing schemaDir overrides the embedded copy
+	artifacts.EmbeddedSchema = fstest.MapFS{}
+	err := ImportDb(context.Background(), driver)
+	if err != nil {
+		t.Fatalf("ImportDb() with schemaDir error = %v", err)
+	}
+
+	// an uninitialized submodule is an empty directory; the embedded copy is used instead
+	driver = newTestDriver(t)
+	conf.GenConfig.SchemaDir = t.TempDir()
+	artifacts.EmbeddedSchema = os.DirFS(schemaDir)
+	err = ImportDb(context.Background(), driver)
+	if err != nil {
+		t.Fatalf("ImportDb() with embedded schema error = %v", err)
+	}
+	if got := driver.GetSql(); !reflect.DeepEqual(got, importSql) {
+		t.Errorf("ImportDb() sql =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(importSql, "\n"))
+	}
+
+	// without either, the error explains how to get the schema
+	driver = newTestDriver(t)
+	artifacts.EmbeddedSchema = nil
+	err = ImportDb(context.Background(), driver)
+	if err == nil || !strings.Contains(err.Error(), "git submodule update") {
+		t.Errorf("ImportDb() without a schema error = %v, want the submodule hint", err)
+	}
+}
+
+func TestImportDbInvalidTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		text     string
+		wantErr  string
+	}{
+		{name: "legacy fmt template", template: "CreateSchema.sqltemplate", text: "CREATE SCHEMA [%s]\nGO\n", wantErr: "no {{ }} actions"},
+		{name: "unknown field", template: "CreateLogin.sqltemplate", text: "CREATE LOGIN [{{.Login.Nmae}}]\nGO\n", wantErr: "can't evaluate field Nmae"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driver := newTestDriver(t)
+			conf := config.GetConfig()
+			schemaDir := conf.GenConfig.SchemaDir
+			defer func() { conf.GenConfig.SchemaDir = schemaDir }()
+			conf.GenConfig.SchemaDir = t.TempDir()
+			err := os.CopyFS(conf.GenConfig.SchemaDir, os.DirFS(schemaDir))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = os.WriteFile(filepath.Join(conf.GenConfig.SchemaDir, "Templates", tt.template), []byte(tt.text), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// templates are validated even when the configuration doesn't use them
+			driver.GenDbConfig.Schemas = nil
+			driver.GenDbConfig.Logins = nil
+
+			err = ImportDb(context.Background(), driver)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ImportDb() error = %v, want %q", err, tt.wantErr)
+			}
+			if got := driver.GetSql(); len(got) != 0 {
+				t.Errorf("ImportDb() sql =\n%s\nwant nothing executed", strings.Join(got, "\n"))
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package importDb
+
+import (
+	"context"
+	"fmt"
+	"kodb-import/dbDriver"
+	"kodb-import/jobs/clean"
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ImportWorkers is the number of table data files loaded concurrently, each on its own connection and transaction,
+	// so at most ImportWorkers worker transactions are open at once.  Values less than 2 load the files one after
+	// another on the top-level transaction
+	ImportWorkers = 1
+)
+
+// scriptResult is the outcome of loading a single script on a worker
+type scriptResult struct {
+	Name     string
+	Duration time.Duration
+	Err      error
+}
+
+// runScriptsParallel loads each script on its own connection and transaction using ImportWorkers workers.
+//
+// Worker connections can't see uncommitted objects, so the top-level transaction (table structures) is committed
+// first.  Each table is committed as soon as its script finishes, and the workers stop taking scripts once one has
+// failed.  With CommitAll the import can no longer be rolled back from here on, so ImportDb drops the database and
+// logins if anything fails (see dropTarget); with CommitStage/CommitFile each committed table is recorded in the
+// checkpoint for -resume.
+func runScriptsParallel(ctx context.Context, driver dbDriver.DbDriver, scriptArgs ScriptArgs, sqlScripts ...Script) (err error) {
+	cp := getCheckpoint(ctx)
+	sqlScripts = cp.pending(sqlScripts)
+	if len(sqlScripts) == 0 {
+		slog.Warn("no scripts to execute", "db", driver.GetGenDbConfig().Name)
+		return nil
+	}
+
+	if driver.HasTx() {
+		err = driver.CommitTx()
+		if err != nil {
+			return err
+		}
+	}
+
+	// mu guards the checkpoint and the failures, which every worker updates
+	mu := sync.Mutex{}
+	failed := 0
+	var firstErr error
+	jobs := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < ImportWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				mu.Lock()
+				isFailed := failed > 0
+				mu.Unlock()
+				if isFailed {
+					continue
+				}
+
+				result := runScriptOnTx(ctx, driver, scriptArgs, sqlScripts[i])
+				mu.Lock()
+				if result.Err == nil {
+					result.Err = cp.completeFiles(sqlScripts[i])
+				}
+				if result.Err != nil {
+					if failed == 0 {
+						firstErr = result.Err
+						cp.fail(result.Name, result.Err)
+					}
+					failed++
+					slog.Error("script failed", "db", driver.GetGenDbConfig().Name, "file", filepath.Base(result.Name), "duration", result.Duration, "error", result.Err)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range sqlScripts {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d table data files failed to import: %w", failed, len(sqlScripts), firstErr)
+	}
+	return nil
+}
+
+// runScriptOnTx runs a script on a new transaction and commits it, or rolls it back on error.  Transient errors roll
+// the transaction back and start the script over on a new one (see dbDriver.Retry)
+func runScriptOnTx(ctx context.Context, driver dbDriver.DbDriver, scriptArgs ScriptArgs, script Script) (result scriptResult) {
+	start := time.Now()
+	result.Name = script.Name
+	defer func() {
+		result.Duration = time.Since(start)
+	}()
+
+	var tx *gorm.DB
+	result.Err = dbDriver.Retry(ctx, driver, func() (err error) {
+		tx, err = driver.BeginTx()
+		if err != nil {
+			tx = nil
+			return err
+		}
+
+		err = runScript(ctx, driver, tx, scriptArgs, script)
+		if err != nil {
+			rErr := driver.RollbackIndependentTx(tx)
+			if rErr != nil {
+				slog.Error("failed to rollback script", "db", driver.GetGenDbConfig().Name, "file", filepath.Base(script.Name), "error", rErr)
+			}
+			tx = nil
+		}
+		return err
+	})
+	if result.Err != nil {
+		return result
+	}
+
+	result.Err = driver.CommitIndependentTx(tx)
+	if result.Err != nil {
+		slog.Error("failed to commit script", "db", driver.GetGenDbConfig().Name, "file", filepath.Base(script.Name), "error", result.Err)
+	}
+	return result
+}
+
+// isParallel checks if the table data is loaded by runScriptsParallel
+func isParallel(driver dbDriver.DbDriver) bool {
+	return ImportWorkers > 1 && !driver.IsPlanMode() && Exporter == nil
+}
+
+// dropTarget undoes a failed CommitAll import whose table structures were committed for the workers: the open
+// transaction is rolled back, then the database and its logins are dropped (see clean.Clean).  The drop isn't
+// cancelled with ctx, so a cancelled import is still undone
+func dropTarget(ctx context.Context, driver dbDriver.DbDriver) {
+	dbName := driver.GetGenDbConfig().Name
+	if driver.HasTx() {
+		rErr := driver.RollbackTx()
+		if rErr != nil {
+			slog.Error("failed to rollback transaction", "db", dbName, "error", rErr)
+		}
+	}
+
+	slog.Warn("dropping partially imported database and logins", "db", dbName)
+	err := clean.Clean(context.WithoutCancel(ctx), driver)
+	if err != nil {
+		slog.Error("failed to drop partially imported database; run -clean before importing again", "db", dbName, "error", err)
+		return
+	}
+	slog.Info("partially imported database dropped", "db", dbName)
+}
@@ -0,0 +1,206 @@
+package importDb
+
+import (
+	"context"
+	"errors"
+	"kodb-import/config"
+	"kodb-import/dbDriver/recordingDriver"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	mssqldb "github.com/microsoft/go-mssqldb"
+)
+
+// newParallelTestDriver returns a recording driver for a copy of testdata/OpenKO-db with the NPC and ZONE data files
+// added, loaded with 2 workers
+func newParallelTestDriver(t *testing.T) *recordingDriver.RecordingDriver {
+	t.Helper()
+	driver := newTestDriver(t)
+
+	conf := config.GetConfig()
+	schemaDir := conf.GenConfig.SchemaDir
+	conf.GenConfig.SchemaDir = filepath.Join(t.TempDir(), "OpenKO-db")
+	err := os.CopyFS(conf.GenConfig.SchemaDir, os.DirFS(schemaDir))
+	if err != nil {
+		t.Fatalf("CopyFS() error = %v", err)
+	}
+	for _, table := range []string{"NPC", "ZONE"} {
+		sql := "INSERT INTO [dbo].[" + table + "] ([Num]) VALUES\n(1),\n(2)\n"
+		err = os.WriteFile(filepath.Join(conf.GenConfig.SchemaDir, "ManualSetup", "6_InsertData_"+table+".sql"), []byte(sql), 0644)
+		if err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+
+	ImportWorkers = 2
+	t.Cleanup(func() {
+		conf.GenConfig.SchemaDir = schemaDir
+		ImportWorkers = 1
+	})
+	return driver
+}
+
+// splitWorkers separates the statements recorded on the workers' transactions from the rest.  The workers' statements
+// and transaction ids interleave in any order, so workers maps each table to how its last transaction ended, and
+// topLevel lists the other statements as "target: sql"
+func splitWorkers(driver *recordingDriver.RecordingDriver) (topLevel []string, workers map[string]string) {
+	tables := map[int]string{}
+	for _, stmt := range driver.Statements {
+		if match := tableDataRegex.FindStringSubmatch(stmt.Sql); match != nil && stmt.Tx != 0 {
+			tables[stmt.Tx] = match[1]
+		}
+	}
+
+	workers = map[string]string{}
+	for _, stmt := range driver.Statements {
+		table, isWorker := tables[stmt.Tx]
+		switch {
+		case !isWorker:
+			topLevel = append(topLevel, stmt.Target+": "+stmt.Sql)
+		case stmt.Sql == recordingDriver.CommitSql || stmt.Sql == recordingDriver.RollbackSql:
+			workers[table] = stmt.Sql
+		}
+	}
+	return topLevel, workers
+}
+
+// maxOpenWorkers returns the most worker transactions that were open at once
+func maxOpenWorkers(driver *recordingDriver.RecordingDriver) (maxOpen int) {
+	topLevel := map[int]bool{}
+	open := 0
+	for _, stmt := range driver.Statements {
+		if stmt.Tx == 0 || topLevel[stmt.Tx] {
+			continue
+		}
+		switch {
+		case stmt.Sql == recordingDriver.BeginSql:
+			open++
+			maxOpen = max(maxOpen, open)
+		case stmt.Sql == recordingDriver.CommitSql || stmt.Sql == recordingDriver.RollbackSql:
+			open--
+		case tableDataRegex.FindStringSubmatch(stmt.Sql) == nil:
+			// the top-level transactions run the other stages
+			topLevel[stmt.Tx] = true
+			open--
+		}
+	}
+	return maxOpen
+}
+
+// tableDataRegex matches the table data batches of the test data files; the first group is the table
+var tableDataRegex = regexp.MustCompile(`^(?:INSERT INTO |IF EXISTS \(.*OBJECT_ID\(N')\[dbo\]\.\[(ITEM|NPC|ZONE)\]`)
+
+func TestImportDbParallel(t *testing.T) {
+	driver := newParallelTestDriver(t)
+
+	err := ImportDb(context.Background(), driver)
+	if err != nil {
+		t.Fatalf("ImportDb() error = %v", err)
+	}
+
+	// the table structures are committed for the workers; the later stages run on a new top-level transaction
+	topLevel, workers := splitWorkers(driver)
+	want := []string{
+		"KN_online: USE [KN_online]",
+		"KN_online: CREATE TABLE [dbo].[ITEM](\n\t[Num] [int] NOT NULL,\n\t[strName] [varchar](50) NULL,\n CONSTRAINT [PK_ITEM] PRIMARY KEY CLUSTERED ([Num] ASC)\n)",
+		"KN_online: COMMIT",
+		"KN_online: BEGIN TRANSACTION",
+		"KN_online: DROP VIEW [dbo].[VIEW_ITEM]",
+		"KN_online: CREATE VIEW [dbo].[VIEW_ITEM] AS SELECT Num FROM ITEM",
+		"KN_online: CREATE PROCEDURE [dbo].[GET_ITEM] AS SELECT 1",
+		"KN_online: " + createVersionTableSql,
+		"KN_online: " + recordMigrationSql,
+	}
+	if got := topLevel[len(topLevel)-len(want):]; !reflect.DeepEqual(got, want) {
+		t.Errorf("ImportDb() sql =\n%s\nwant suffix\n%s", strings.Join(topLevel, "\n"), strings.Join(want, "\n"))
+	}
+	wantWorkers := map[string]string{"ITEM": recordingDriver.CommitSql, "NPC": recordingDriver.CommitSql, "ZONE": recordingDriver.CommitSql}
+	if !reflect.DeepEqual(workers, wantWorkers) {
+		t.Errorf("ImportDb() workers = %v, want %v", workers, wantWorkers)
+	}
+	// each table is committed as it finishes, so only ImportWorkers transactions are ever open
+	if got := maxOpenWorkers(driver); got > ImportWorkers {
+		t.Errorf("ImportDb() opened %d worker transactions at once, want at most %d", got, ImportWorkers)
+	}
+}
+
+// wantDropTarget are the statements dropTarget sends after a failed CommitAll import
+func wantDropTarget(driver *recordingDriver.RecordingDriver) []string {
+	return []string{
+		"master: " + driver.GetDropDatabaseSql("KN_online"),
+		"master: " + driver.GetDropLoginSql("knight"),
+	}
+}
+
+func TestImportDbParallelScriptErr(t *testing.T) {
+	driver := newParallelTestDriver(t)
+	driver.Errors["INSERT INTO [dbo].[NPC] ([Num]) VALUES\n(1),\n(2)"] = mssqldb.Error{Number: 2627, State: 1, Class: 14, LineNo: 1, Message: "Violation of PRIMARY KEY constraint 'PK_NPC'."}
+
+	err := ImportDb(context.Background(), driver)
+	if err == nil {
+		t.Fatalf("ImportDb() error = nil, want error")
+	}
+
+	// the table structures were committed for the workers, so the database and logins are dropped rather than rolled
+	// back; later stages never run
+	topLevel, workers := splitWorkers(driver)
+	want := wantDropTarget(driver)
+	if got := topLevel[len(topLevel)-len(want):]; !reflect.DeepEqual(got, want) {
+		t.Errorf("ImportDb() sql =\n%s\nwant suffix\n%s", strings.Join(topLevel, "\n"), strings.Join(want, "\n"))
+	}
+	if workers["NPC"] != recordingDriver.RollbackSql {
+		t.Errorf("ImportDb() NPC = %s, want %s", workers["NPC"], recordingDriver.RollbackSql)
+	}
+	if driver.HasTx() {
+		t.Errorf("ImportDb() left a transaction open")
+	}
+}
+
+func TestImportDbParallelCommitErr(t *testing.T) {
+	driver := newParallelTestDriver(t)
+	commitErr := errors.New("connection reset")
+	// the top-level transaction commits; the first table to finish doesn't
+	driver.ErrorQueue[recordingDriver.CommitSql] = []error{nil, commitErr}
+
+	err := ImportDb(context.Background(), driver)
+	if !errors.Is(err, commitErr) {
+		t.Fatalf("ImportDb() error = %v, want %v", err, commitErr)
+	}
+
+	topLevel, _ := splitWorkers(driver)
+	want := wantDropTarget(driver)
+	if got := topLevel[len(topLevel)-len(want):]; !reflect.DeepEqual(got, want) {
+		t.Errorf("ImportDb() sql =\n%s\nwant suffix\n%s", strings.Join(topLevel, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestImportDbParallelLaterStageErr(t *testing.T) {
+	driver := newParallelTestDriver(t)
+	driver.Errors["CREATE PROCEDURE [dbo].[GET_ITEM] AS SELECT 1"] = mssqldb.Error{Number: 2714, State: 3, Class: 16, LineNo: 1, Message: "There is already an object named 'GET_ITEM' in the database."}
+
+	err := ImportDb(context.Background(), driver)
+	if err == nil {
+		t.Fatalf("ImportDb() error = nil, want error")
+	}
+
+	// every table was committed, so the failed procs stage is rolled back and the whole database and logins dropped
+	topLevel, workers := splitWorkers(driver)
+	want := append([]string{
+		"KN_online: CREATE PROCEDURE [dbo].[GET_ITEM] AS SELECT 1",
+		"KN_online: ROLLBACK",
+	}, wantDropTarget(driver)...)
+	if got := topLevel[len(topLevel)-len(want):]; !reflect.DeepEqual(got, want) {
+		t.Errorf("ImportDb() sql =\n%s\nwant suffix\n%s", strings.Join(topLevel, "\n"), strings.Join(want, "\n"))
+	}
+	wantWorkers := map[string]string{"ITEM": recordingDriver.CommitSql, "NPC": recordingDriver.CommitSql, "ZONE": recordingDriver.CommitSql}
+	if !reflect.DeepEqual(workers, wantWorkers) {
+		t.Errorf("ImportDb() workers = %v, want %v", workers, wantWorkers)
+	}
+	if driver.HasTx() {
+		t.Errorf("ImportDb() left a transaction open")
+	}
+}
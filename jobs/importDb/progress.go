@@ -0,0 +1,230 @@
+package importDb
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"kodb-import/logging"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// progressRefreshInterval is how often the progress line is redrawn on a terminal
+	progressRefreshInterval = 250 * time.Millisecond
+)
+
+var (
+	// ProgressInterval is how often a progress event is logged when stderr isn't a terminal
+	ProgressInterval = 10 * time.Second
+)
+
+// progressKey is the context key used to pass the table data progress to runScript
+type progressKey struct{}
+
+// importProgress tracks table data progress against the row count scanned before the import starts.  When stderr is a
+// terminal a single status line is redrawn there (see logging.DrawStatusLine), otherwise a progress event is logged
+// every ProgressInterval
+type importProgress struct {
+	mu         sync.Mutex
+	dbName     string
+	active     []string
+	tables     int
+	tablesDone int
+	rows       int64
+	rowsDone   int64
+	batches    int
+	start      time.Time
+	isTerminal bool
+	out        io.Writer
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+// newImportProgress returns the progress of importing the given number of tables and rows
+func newImportProgress(dbName string, tables int, rows int64) *importProgress {
+	return &importProgress{
+		dbName: dbName,
+		tables: tables,
+		rows:   rows,
+		// the status line stays out of the log output on stdout, so redirected or json logs aren't corrupted
+		out:        os.Stderr,
+		isTerminal: isTerminal(os.Stderr),
+	}
+}
+
+// isTerminal checks if the file is a character device, such as a console
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// run starts reporting progress until finish is called
+func (this *importProgress) run() {
+	this.start = time.Now()
+	this.stop = make(chan struct{})
+	this.done = make(chan struct{})
+	interval := ProgressInterval
+	if this.isTerminal {
+		interval = progressRefreshInterval
+	}
+
+	go func() {
+		defer close(this.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-this.stop:
+				return
+			case <-ticker.C:
+				this.report()
+			}
+		}
+	}()
+}
+
+// finish stops reporting and reports the final progress
+func (this *importProgress) finish() {
+	if this == nil || this.stop == nil {
+		return
+	}
+	close(this.stop)
+	<-this.done
+	this.report()
+	if this.isTerminal {
+		logging.EndStatusLine()
+	}
+}
+
+// getTableName returns the table name of a 6_InsertData_[Table].sql file
+func getTableName(fileName string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(filepath.Base(fileName), "6_InsertData_"), ".sql")
+}
+
+// startTable records a table being loaded; with ImportWorkers several tables are loaded at once
+func (this *importProgress) startTable(fileName string) {
+	if this == nil {
+		return
+	}
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.active = append(this.active, getTableName(fileName))
+}
+
+// endTable removes a table that's no longer being loaded; the caller holds mu
+func (this *importProgress) endTable(fileName string) {
+	this.active = slices.DeleteFunc(this.active, func(table string) bool { return table == getTableName(fileName) })
+}
+
+// completeBatch records a batch sent to the server
+func (this *importProgress) completeBatch(rows int) {
+	if this == nil {
+		return
+	}
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.batches++
+	this.rowsDone += int64(rows)
+}
+
+// failTable removes the rows of a failed attempt whose transaction was rolled back, so a retry doesn't count them
+// twice
+func (this *importProgress) failTable(fileName string, rows int) {
+	if this == nil {
+		return
+	}
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.rowsDone -= int64(rows)
+	this.endTable(fileName)
+}
+
+// completeTable records a loaded table
+func (this *importProgress) completeTable(fileName string) {
+	if this == nil {
+		return
+	}
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.tablesDone++
+	this.endTable(fileName)
+}
+
+// progressSnapshot is the progress at a point in time
+type progressSnapshot struct {
+	// Active are the tables being loaded, in the order they were started
+	Active     []string
+	Tables     int
+	TablesDone int
+	Rows       int64
+	RowsDone   int64
+	Batches    int
+	RowsPerSec float64
+	// Eta is the estimated time remaining; 0 until a row has been sent
+	Eta time.Duration
+}
+
+// snapshot returns the progress as of now
+func (this *importProgress) snapshot(now time.Time) (s progressSnapshot) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	s = progressSnapshot{
+		Active:     slices.Clone(this.active),
+		Tables:     this.tables,
+		TablesDone: this.tablesDone,
+		Rows:       this.rows,
+		RowsDone:   this.rowsDone,
+		Batches:    this.batches,
+	}
+
+	elapsed := now.Sub(this.start).Seconds()
+	if elapsed > 0 && s.RowsDone > 0 {
+		s.RowsPerSec = float64(s.RowsDone) / elapsed
+		if s.Rows > s.RowsDone {
+			s.Eta = time.Duration(float64(s.Rows-s.RowsDone) / s.RowsPerSec * float64(time.Second)).Round(time.Second)
+		}
+	}
+	return s
+}
+
+// String formats the snapshot as a single status line
+func (this progressSnapshot) String() string {
+	eta := "--"
+	if this.RowsDone > 0 {
+		eta = this.Eta.String()
+	}
+	return fmt.Sprintf("table data: %s [%d/%d tables] %d/%d rows, %d batches, %.0f rows/s, ETA %s",
+		strings.Join(this.Active, ", "), this.TablesDone, this.Tables, this.RowsDone, this.Rows, this.Batches, this.RowsPerSec, eta)
+}
+
+// report draws the status line or logs a progress event
+func (this *importProgress) report() {
+	s := this.snapshot(time.Now())
+	if this.isTerminal {
+		logging.DrawStatusLine(this.out, s.String())
+		return
+	}
+
+	slog.Info("table data progress", "db", this.dbName, "tables_active", s.Active, "tables_done", s.TablesDone, "tables", s.Tables,
+		"rows_done", s.RowsDone, "rows", s.Rows, "batches", s.Batches, "rows_per_sec", int64(s.RowsPerSec), "eta", s.Eta)
+}
+
+// withProgress returns a copy of ctx carrying the table data progress
+func withProgress(ctx context.Context, progress *importProgress) context.Context {
+	return context.WithValue(ctx, progressKey{}, progress)
+}
+
+// getProgress returns the table data progress carried by ctx, or nil
+func getProgress(ctx context.Context) *importProgress {
+	progress, _ := ctx.Value(progressKey{}).(*importProgress)
+	return progress
+}
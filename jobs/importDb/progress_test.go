@@ -0,0 +1,83 @@
+package importDb
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestImportProgressSnapshot(t *testing.T) {
+	progress := newImportProgress("KN_online", 2, 1000)
+	progress.start = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	progress.startTable("ManualSetup/6_InsertData_ITEM.sql")
+	progress.completeBatch(100)
+	progress.completeBatch(150)
+	progress.completeTable("ManualSetup/6_InsertData_ITEM.sql")
+	progress.startTable("ManualSetup/6_InsertData_MAGIC.sql")
+
+	got := progress.snapshot(progress.start.Add(10 * time.Second))
+	want := progressSnapshot{
+		Active:     []string{"MAGIC"},
+		Tables:     2,
+		TablesDone: 1,
+		Rows:       1000,
+		RowsDone:   250,
+		Batches:    2,
+		RowsPerSec: 25,
+		Eta:        30 * time.Second,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("snapshot() = %+v, want %+v", got, want)
+	}
+
+	wantLine := "table data: MAGIC [1/2 tables] 250/1000 rows, 2 batches, 25 rows/s, ETA 30s"
+	if got.String() != wantLine {
+		t.Errorf("String() = %q, want %q", got.String(), wantLine)
+	}
+}
+
+func TestImportProgressSnapshotNoRows(t *testing.T) {
+	progress := newImportProgress("KN_online", 1, 10)
+	progress.start = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	got := progress.snapshot(progress.start.Add(time.Second))
+	if got.RowsPerSec != 0 || got.Eta != 0 {
+		t.Errorf("snapshot() = %+v, want no rate or ETA before the first row", got)
+	}
+	wantLine := "table data:  [0/1 tables] 0/10 rows, 0 batches, 0 rows/s, ETA --"
+	if got.String() != wantLine {
+		t.Errorf("String() = %q, want %q", got.String(), wantLine)
+	}
+}
+
+func TestImportProgressWorkers(t *testing.T) {
+	progress := newImportProgress("KN_online", 4, 1000)
+
+	// workers load tables at once; each stays on the status line until it completes or fails
+	progress.startTable("ManualSetup/6_InsertData_ITEM.sql")
+	progress.startTable("ManualSetup/6_InsertData_MAGIC.sql")
+	progress.startTable("ManualSetup/6_InsertData_NPC.sql")
+	progress.completeTable("ManualSetup/6_InsertData_MAGIC.sql")
+	progress.startTable("ManualSetup/6_InsertData_ZONE.sql")
+	progress.failTable("ManualSetup/6_InsertData_ITEM.sql", 0)
+
+	got := progress.snapshot(time.Now())
+	if want := []string{"NPC", "ZONE"}; !reflect.DeepEqual(got.Active, want) {
+		t.Errorf("snapshot() active = %v, want %v", got.Active, want)
+	}
+	wantLine := "table data: NPC, ZONE [1/4 tables] 0/1000 rows, 0 batches, 0 rows/s, ETA --"
+	if got.String() != wantLine {
+		t.Errorf("String() = %q, want %q", got.String(), wantLine)
+	}
+}
+
+func TestImportProgressNil(t *testing.T) {
+	// runScript reports progress unconditionally; outside the data stage there's no tracker
+	var progress *importProgress
+	progress.startTable("5_CreateTable_ITEM.sql")
+	progress.completeBatch(1)
+	progress.completeTable("5_CreateTable_ITEM.sql")
+	progress.failTable("5_CreateTable_ITEM.sql", 1)
+	progress.finish()
+}
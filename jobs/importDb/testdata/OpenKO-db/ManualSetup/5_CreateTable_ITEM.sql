@@ -0,0 +1,8 @@
+USE [KN_online]
+GO
+CREATE TABLE [dbo].[ITEM](
+	[Num] [int] NOT NULL,
+	[strName] [varchar](50) NULL,
+ CONSTRAINT [PK_ITEM] PRIMARY KEY CLUSTERED ([Num] ASC)
+)
+GO
@@ -0,0 +1,4 @@
+INSERT INTO [dbo].[ITEM] ([Num], [strName]) VALUES
+(1, 'Sword'),
+(2, 'Shield'),
+(3, 'Bow')
@@ -0,0 +1,4 @@
+DROP VIEW [dbo].[VIEW_ITEM]
+GO
+CREATE VIEW [dbo].[VIEW_ITEM] AS SELECT Num FROM ITEM
+GO
@@ -0,0 +1,2 @@
+CREATE PROCEDURE [dbo].[GET_ITEM] AS SELECT 1
+GO
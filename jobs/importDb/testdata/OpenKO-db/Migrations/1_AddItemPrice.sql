@@ -0,0 +1,2 @@
+ALTER TABLE [dbo].[ITEM] ADD [Price] [int] NULL
+GO
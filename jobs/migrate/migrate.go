@@ -0,0 +1,316 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"kodb-import/artifacts"
+	"kodb-import/dbDriver"
+	"kodb-import/mssql"
+	"log/slog"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// SchemaVersionTable records the migrations applied to a database
+	SchemaVersionTable = "[dbo].[SchemaVersion]"
+	// SchemaVersionTableName is SchemaVersionTable as [schema].[table] names are read from the catalog
+	SchemaVersionTableName = "dbo.SchemaVersion"
+
+	createVersionTableSql = "IF OBJECT_ID(N'" + SchemaVersionTable + "', N'U') IS NULL " +
+		"CREATE TABLE " + SchemaVersionTable + " (" +
+		"[Version] int NOT NULL CONSTRAINT [PK_SchemaVersion] PRIMARY KEY, " +
+		"[Name] nvarchar(260) NOT NULL, " +
+		"[AppliedAt] datetime2 NOT NULL CONSTRAINT [DF_SchemaVersion_AppliedAt] DEFAULT SYSUTCDATETIME())"
+	selectVersionsSql = "IF OBJECT_ID(N'" + SchemaVersionTable + "', N'U') IS NOT NULL " +
+		"SELECT [Version], [Name], [AppliedAt] FROM " + SchemaVersionTable + " ORDER BY [Version]"
+	insertVersionSql = "INSERT INTO " + SchemaVersionTable + " ([Version], [Name]) VALUES"
+)
+
+var (
+	// migrationFileRegex matches [Version]_[Description].sql migration file names
+	migrationFileRegex = regexp.MustCompile(`^(\d+)_.+\.sql$`)
+)
+
+// Migration is a numbered migration script
+type Migration struct {
+	Version int
+	Name    string
+	Path    string
+}
+
+// AppliedMigration is a row of the SchemaVersionTable
+type AppliedMigration struct {
+	Version   int
+	Name      string
+	AppliedAt time.Time
+}
+
+// Migrate reports the applied and pending migrations for the driver's database and runs the pending ones in version
+// order, each in its own transaction.  Migration scripts are read from artifacts.GetMigrationsFsDir.  In plan mode the
+// applied versions are read, but the pending migrations are only printed.
+func Migrate(ctx context.Context, driver *mssql.MssqlDbDriver) (err error) {
+	log := slog.With("db", driver.GetGenDbConfig().Name)
+	log.Info("migrate started")
+
+	migrations, err := GetMigrations(driver)
+	if err != nil {
+		return err
+	}
+	if migrations == nil {
+		log.Info("no migrations directory; skipping", "dir", artifacts.GetMigrationsFsDir(driver))
+		return nil
+	}
+
+	// transient errors (see dbDriver.Retry) are retried; reading the versions and creating the table are safe to repeat
+	var conn *gorm.DB
+	err = dbDriver.Retry(ctx, driver, func() (err error) {
+		conn, err = driver.GetConnection()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	applied := []AppliedMigration{}
+	err = dbDriver.Retry(ctx, driver, func() error {
+		applied = applied[:0]
+		return conn.WithContext(ctx).Raw(selectVersionsSql).Scan(&applied).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return applyPending(ctx, driver, conn, migrations, applied)
+}
+
+// applyPending runs the migrations that aren't in applied, in version order, each in its own transaction.  conn is
+// the untransacted connection the SchemaVersionTable is created on.  In plan mode the pending migrations are only
+// printed
+func applyPending(ctx context.Context, driver dbDriver.DbDriver, conn *gorm.DB, migrations []Migration, applied []AppliedMigration) (err error) {
+	log := slog.With("db", driver.GetGenDbConfig().Name)
+	pending := logStatus(log, migrations, applied)
+	if len(pending) == 0 {
+		log.Info("database is up to date")
+		return nil
+	}
+
+	if driver.IsPlanMode() {
+		for i := range pending {
+			batches, err := readBatches(driver, pending[i])
+			if err != nil {
+				return err
+			}
+			fmt.Printf("[plan] %s: %d batch(es)\n", pending[i].Name, len(batches))
+			for j := range batches {
+				fmt.Printf("[plan]   batch [%d/%d] line %d, repeat %d:\n%s\n", j+1, len(batches), batches[j].Line, batches[j].Repeat, batches[j].Sql)
+			}
+		}
+		return nil
+	}
+
+	err = dbDriver.Retry(ctx, driver, func() error {
+		return driver.ExecBatch(ctx, conn, createVersionTableSql)
+	})
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	for i := range pending {
+		err = applyMigration(ctx, driver, pending[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Info("migrate completed", "applied", len(pending), "duration", time.Since(start))
+	return nil
+}
+
+// GetMigrations returns the driver's migration scripts (see artifacts.GetMigrationsFsDir) sorted by version.
+// migrations is nil when the schema doesn't have a migrations directory
+func GetMigrations(driver dbDriver.DbDriver) (migrations []Migration, err error) {
+	fsys, err := artifacts.GetSchemaFS()
+	if err != nil {
+		return nil, err
+	}
+	dir := artifacts.GetMigrationsFsDir(driver)
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	migrations = []Migration{}
+	versions := map[int]string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := migrationFileRegex.FindStringSubmatch(entry.Name())
+		if match == nil {
+			slog.Warn("migration file name doesn't match [Version]_[Description].sql; ignoring", "db", driver.GetGenDbConfig().Name, "file", entry.Name())
+			continue
+		}
+
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid version: %v", entry.Name(), err)
+		}
+		if other, ok := versions[version]; ok {
+			return nil, fmt.Errorf("duplicate migration version %d: %s and %s", version, other, entry.Name())
+		}
+		versions[version] = entry.Name()
+
+		migrations = append(migrations, Migration{
+			Version: version,
+			Name:    entry.Name(),
+			Path:    path.Join(dir, entry.Name()),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// GetRecordScript returns the script that creates the SchemaVersionTable and records migrations as applied.  A fresh
+// import already includes every migration in the schema, so ImportDb records them for the next -migrate
+func GetRecordScript(migrations []Migration) string {
+	sb := strings.Builder{}
+	sb.WriteString(createVersionTableSql)
+	sb.WriteString("\nGO\n")
+	if len(migrations) == 0 {
+		return sb.String()
+	}
+
+	sb.WriteString(insertVersionSql)
+	for i := range migrations {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString("\n")
+		sb.WriteString(getVersionValues(migrations[i]))
+	}
+	sb.WriteString("\nGO\n")
+	return sb.String()
+}
+
+// getVersionValues returns the migration's (version, name) SchemaVersionTable row
+func getVersionValues(migration Migration) string {
+	return fmt.Sprintf("(%d, N'%s')", migration.Version, strings.ReplaceAll(migration.Name, "'", "''"))
+}
+
+// logStatus logs each migration as applied or pending and returns the pending migrations
+func logStatus(log *slog.Logger, migrations []Migration, applied []AppliedMigration) (pending []Migration) {
+	appliedByVersion := map[int]AppliedMigration{}
+	for i := range applied {
+		appliedByVersion[applied[i].Version] = applied[i]
+	}
+
+	for i := range migrations {
+		if a, ok := appliedByVersion[migrations[i].Version]; ok {
+			log.Info("migration status", "migration", migrations[i].Name, "status", "applied", "applied_at", a.AppliedAt)
+			delete(appliedByVersion, migrations[i].Version)
+			continue
+		}
+		log.Info("migration status", "migration", migrations[i].Name, "status", "pending")
+		pending = append(pending, migrations[i])
+	}
+
+	// versions recorded in the database without a matching file
+	for i := range applied {
+		if _, ok := appliedByVersion[applied[i].Version]; ok {
+			log.Warn("applied migration has no matching file", "version", applied[i].Version, "migration", applied[i].Name)
+		}
+	}
+
+	return pending
+}
+
+// readBatches reads a migration file from the schema and splits it into batches
+func readBatches(driver dbDriver.DbDriver, migration Migration) (batches []dbDriver.Batch, err error) {
+	fsys, err := artifacts.GetSchemaFS()
+	if err != nil {
+		return nil, err
+	}
+	sqlBytes, err := fs.ReadFile(fsys, migration.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	batches, err = driver.SplitBatches(string(sqlBytes))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", migration.Name, err)
+	}
+	return batches, nil
+}
+
+// applyMigration runs a migration and records its version in a single transaction.  Transient errors roll the
+// transaction back and start the migration over on a new one (see dbDriver.Retry)
+func applyMigration(ctx context.Context, driver dbDriver.DbDriver, migration Migration) (err error) {
+	batches, err := readBatches(driver, migration)
+	if err != nil {
+		return err
+	}
+
+	log := slog.With("db", driver.GetGenDbConfig().Name, "migration", migration.Name)
+	log.Info("migration started", "batches", len(batches))
+	start := time.Now()
+	var tx *gorm.DB
+	err = dbDriver.Retry(ctx, driver, func() (err error) {
+		tx, err = driver.BeginTx()
+		if err != nil {
+			tx = nil
+			return err
+		}
+
+		err = runMigration(ctx, driver, tx, migration, batches)
+		if err != nil {
+			rErr := driver.RollbackIndependentTx(tx)
+			if rErr != nil {
+				log.Error("failed to rollback transaction", "error", rErr)
+			}
+			tx = nil
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	err = driver.CommitIndependentTx(tx)
+	if err != nil {
+		return err
+	}
+	log.Info("migration applied", "duration", time.Since(start))
+
+	return nil
+}
+
+// runMigration executes a migration's batches and records its version on tx
+func runMigration(ctx context.Context, driver dbDriver.DbDriver, tx *gorm.DB, migration Migration, batches []dbDriver.Batch) (err error) {
+	for j := range batches {
+		for k := 0; k < batches[j].Repeat; k++ {
+			err = driver.ExecBatch(ctx, tx, batches[j].Sql)
+			if err != nil {
+				slog.Error("batch failed", "db", driver.GetGenDbConfig().Name, "migration", migration.Name, "batch", j+1, "batches", len(batches), "line", batches[j].Line, "error", err)
+				return err
+			}
+		}
+	}
+
+	return driver.ExecBatch(ctx, tx, insertVersionSql+" "+getVersionValues(migration))
+}
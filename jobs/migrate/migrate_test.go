@@ -0,0 +1,235 @@
+package migrate
+
+import (
+	"context"
+	"kodb-import/config"
+	"kodb-import/dbDriver/recordingDriver"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Open-KO/kodb-godef/enums/dbType"
+	mssqldb "github.com/microsoft/go-mssqldb"
+)
+
+const (
+	// the batches of the testdata/OpenKO-db migrations
+	addItemPriceSql   = "ALTER TABLE [dbo].[ITEM] ADD [Price] [int] NULL"
+	addItemWeightSql  = "ALTER TABLE [dbo].[ITEM] ADD [Weight] [int] NULL"
+	setItemWeightSql  = "UPDATE [dbo].[ITEM] SET [Weight] = 0"
+	indexItemPriceSql = "CREATE INDEX [IX_ITEM_Price] ON [dbo].[ITEM] ([Price])"
+)
+
+// newTestDriver returns a recording driver for the game database in testdata/kodb-import-config.yaml
+func newTestDriver(t *testing.T) *recordingDriver.RecordingDriver {
+	t.Helper()
+	config.ConfigPath = "testdata/kodb-import-config.yaml"
+	return recordingDriver.NewRecordingDriver(config.GetConfig().GenConfig.GameDbs[0], dbType.GAME)
+}
+
+// runApplyPending applies the testdata migrations that aren't in applied
+func runApplyPending(t *testing.T, driver *recordingDriver.RecordingDriver, applied []AppliedMigration) error {
+	t.Helper()
+	migrations, err := GetMigrations(driver)
+	if err != nil {
+		t.Fatalf("GetMigrations() error = %v", err)
+	}
+	conn, err := driver.GetConnection()
+	if err != nil {
+		t.Fatalf("GetConnection() error = %v", err)
+	}
+	return applyPending(context.Background(), driver, conn, migrations, applied)
+}
+
+func TestGetMigrations(t *testing.T) {
+	driver := newTestDriver(t)
+
+	got, err := GetMigrations(driver)
+	if err != nil {
+		t.Fatalf("GetMigrations() error = %v", err)
+	}
+
+	// versions are ordered numerically; README.md, AddShop.sql, and the Login directory aren't migrations
+	want := []Migration{
+		{Version: 1, Name: "1_AddItemPrice.sql", Path: "Migrations/1_AddItemPrice.sql"},
+		{Version: 2, Name: "2_AddItemWeight.sql", Path: "Migrations/2_AddItemWeight.sql"},
+		{Version: 10, Name: "10_IndexItemPrice.sql", Path: "Migrations/10_IndexItemPrice.sql"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetMigrations() = %+v, want %+v", got, want)
+	}
+
+	// the account database's migrations are in their own directory
+	driver.DbType = dbType.ACCOUNT
+	got, err = GetMigrations(driver)
+	if err != nil {
+		t.Fatalf("GetMigrations() account error = %v", err)
+	}
+	want = []Migration{{Version: 1, Name: "1_AddUserEmail.sql", Path: "Migrations/Login/1_AddUserEmail.sql"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetMigrations() account = %+v, want %+v", got, want)
+	}
+
+	// the log database has none
+	driver.DbType = dbType.LOG
+	got, err = GetMigrations(driver)
+	if err != nil || got != nil {
+		t.Errorf("GetMigrations() log = %+v, %v, want nil", got, err)
+	}
+}
+
+func TestGetMigrationsDuplicateVersion(t *testing.T) {
+	driver := newTestDriver(t)
+	conf := config.GetConfig()
+	schemaDir := conf.GenConfig.SchemaDir
+	defer func() { conf.GenConfig.SchemaDir = schemaDir }()
+	conf.GenConfig.SchemaDir = t.TempDir()
+	dir := filepath.Join(conf.GenConfig.SchemaDir, "Migrations")
+	for _, name := range []string{"2_AddItemWeight.sql", "02_AddItemHeight.sql"} {
+		err := os.MkdirAll(dir, 0755)
+		if err == nil {
+			err = os.WriteFile(filepath.Join(dir, name), []byte("SELECT 1\nGO\n"), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := GetMigrations(driver)
+	if err == nil || !strings.Contains(err.Error(), "duplicate migration version 2") {
+		t.Errorf("GetMigrations() error = %v, want duplicate version 2", err)
+	}
+}
+
+func TestApplyPending(t *testing.T) {
+	driver := newTestDriver(t)
+
+	err := runApplyPending(t, driver, nil)
+	if err != nil {
+		t.Fatalf("applyPending() error = %v", err)
+	}
+
+	// each migration runs and records its version in its own transaction, in version order
+	want := []string{
+		"KN_online: " + createVersionTableSql,
+		"KN_online tx1: BEGIN TRANSACTION",
+		"KN_online tx1: " + addItemPriceSql,
+		"KN_online tx1: " + insertVersionSql + " (1, N'1_AddItemPrice.sql')",
+		"KN_online tx1: COMMIT",
+		"KN_online tx2: BEGIN TRANSACTION",
+		"KN_online tx2: " + addItemWeightSql,
+		"KN_online tx2: " + setItemWeightSql,
+		"KN_online tx2: " + insertVersionSql + " (2, N'2_AddItemWeight.sql')",
+		"KN_online tx2: COMMIT",
+		"KN_online tx3: BEGIN TRANSACTION",
+		"KN_online tx3: " + indexItemPriceSql,
+		"KN_online tx3: " + insertVersionSql + " (10, N'10_IndexItemPrice.sql')",
+		"KN_online tx3: COMMIT",
+	}
+	if got := driver.GetSql(); !reflect.DeepEqual(got, want) {
+		t.Errorf("applyPending() sql =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestApplyPendingSkipsApplied(t *testing.T) {
+	driver := newTestDriver(t)
+	applied := []AppliedMigration{
+		{Version: 1, Name: "1_AddItemPrice.sql", AppliedAt: time.Now()},
+		{Version: 10, Name: "10_IndexItemPrice.sql", AppliedAt: time.Now()},
+		// a version without a file is only logged
+		{Version: 3, Name: "3_Removed.sql", AppliedAt: time.Now()},
+	}
+
+	err := runApplyPending(t, driver, applied)
+	if err != nil {
+		t.Fatalf("applyPending() error = %v", err)
+	}
+
+	want := []string{
+		"KN_online: " + createVersionTableSql,
+		"KN_online tx1: BEGIN TRANSACTION",
+		"KN_online tx1: " + addItemWeightSql,
+		"KN_online tx1: " + setItemWeightSql,
+		"KN_online tx1: " + insertVersionSql + " (2, N'2_AddItemWeight.sql')",
+		"KN_online tx1: COMMIT",
+	}
+	if got := driver.GetSql(); !reflect.DeepEqual(got, want) {
+		t.Errorf("applyPending() sql =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// once everything is applied, nothing is executed
+	driver = newTestDriver(t)
+	applied = append(applied, AppliedMigration{Version: 2, Name: "2_AddItemWeight.sql", AppliedAt: time.Now()})
+	err = runApplyPending(t, driver, applied)
+	if err != nil || len(driver.GetSql()) != 0 {
+		t.Errorf("applyPending() up to date sql = %v, error = %v, want nothing executed", driver.GetSql(), err)
+	}
+}
+
+func TestApplyPendingErr(t *testing.T) {
+	driver := newTestDriver(t)
+	driver.Errors[setItemWeightSql] = mssqldb.Error{Number: 207, State: 1, Class: 16, LineNo: 1, Message: "Invalid column name 'Weight'."}
+
+	err := runApplyPending(t, driver, nil)
+	if err == nil || !strings.Contains(err.Error(), "Invalid column name 'Weight'") {
+		t.Fatalf("applyPending() error = %v, want the failed batch's error", err)
+	}
+
+	// the failed migration is rolled back without recording its version, and later ones aren't run
+	want := []string{
+		"KN_online: " + createVersionTableSql,
+		"KN_online tx1: BEGIN TRANSACTION",
+		"KN_online tx1: " + addItemPriceSql,
+		"KN_online tx1: " + insertVersionSql + " (1, N'1_AddItemPrice.sql')",
+		"KN_online tx1: COMMIT",
+		"KN_online tx2: BEGIN TRANSACTION",
+		"KN_online tx2: " + addItemWeightSql,
+		"KN_online tx2: " + setItemWeightSql,
+		"KN_online tx2: ROLLBACK",
+	}
+	if got := driver.GetSql(); !reflect.DeepEqual(got, want) {
+		t.Errorf("applyPending() sql =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestApplyPendingPlan(t *testing.T) {
+	driver := newTestDriver(t)
+	driver.IsPlan = true
+
+	err := runApplyPending(t, driver, nil)
+	if err != nil {
+		t.Fatalf("applyPending() error = %v", err)
+	}
+	if got := driver.GetSql(); len(got) != 0 {
+		t.Errorf("applyPending() plan sql =\n%s\nwant nothing executed", strings.Join(got, "\n"))
+	}
+}
+
+func TestGetRecordScript(t *testing.T) {
+	tests := []struct {
+		name       string
+		migrations []Migration
+		want       string
+	}{
+		{
+			name: "no migrations",
+			want: createVersionTableSql + "\nGO\n",
+		},
+		{
+			name:       "migrations",
+			migrations: []Migration{{Version: 1, Name: "1_AddItemPrice.sql"}, {Version: 2, Name: "2_Fix_'quoted'.sql"}},
+			want: createVersionTableSql + "\nGO\n" +
+				insertVersionSql + "\n(1, N'1_AddItemPrice.sql'),\n(2, N'2_Fix_''quoted''.sql')\nGO\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GetRecordScript(tt.migrations); got != tt.want {
+				t.Errorf("GetRecordScript() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
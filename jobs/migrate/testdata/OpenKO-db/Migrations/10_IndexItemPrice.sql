@@ -0,0 +1,2 @@
+CREATE INDEX [IX_ITEM_Price] ON [dbo].[ITEM] ([Price])
+GO
@@ -0,0 +1,4 @@
+ALTER TABLE [dbo].[ITEM] ADD [Weight] [int] NULL
+GO
+UPDATE [dbo].[ITEM] SET [Weight] = 0
+GO
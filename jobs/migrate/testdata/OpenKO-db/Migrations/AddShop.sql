@@ -0,0 +1,2 @@
+DROP TABLE [dbo].[ITEM]
+GO
@@ -0,0 +1,2 @@
+ALTER TABLE [dbo].[TB_USER] ADD [Email] [varchar](100) NULL
+GO
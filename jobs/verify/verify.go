@@ -0,0 +1,149 @@
+package verify
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"kodb-import/artifacts"
+	"kodb-import/mssql"
+	"log/slog"
+	"path"
+	"strings"
+)
+
+const (
+	countRowsSqlFmt = "SELECT COUNT_BIG(*) FROM %s"
+	objectExistsSql = "SELECT COUNT(*) FROM sys.objects WHERE object_id = OBJECT_ID(?) AND type IN ?"
+)
+
+var (
+	// viewTypes and procTypes are the sys.objects types accepted for views and stored procedures
+	viewTypes = []string{"V"}
+	procTypes = []string{"P", "PC"}
+)
+
+// Verify compares the live database against the OpenKO-db scripts it was imported from: the row count of every
+// 6_InsertData_*.sql table, and the existence of every 7_CreateView_* and 8_CreateStoredProc_* object.  Each check is
+// logged with its kind and object; returns an error when anything doesn't match.
+func Verify(ctx context.Context, driver *mssql.MssqlDbDriver) (err error) {
+	log := slog.With("db", driver.GetGenDbConfig().Name)
+	log.Info("verify started")
+	conn, err := driver.GetConnection()
+	if err != nil {
+		return err
+	}
+
+	fsys, err := artifacts.GetSchemaFS()
+	if err != nil {
+		return err
+	}
+	dir := artifacts.GetManualSetupFsDir(driver)
+	mismatches := 0
+
+	dataFiles, err := fs.Glob(fsys, path.Join(dir, fmt.Sprintf(artifacts.CreateTableDataFileNameFmt, "*")))
+	if err != nil {
+		return err
+	}
+	for _, file := range dataFiles {
+		sqlBytes, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return err
+		}
+		dump, err := mssql.ParseDataDump(path.Base(file), string(sqlBytes))
+		if err != nil {
+			return err
+		}
+
+		mismatches += checkRowCounts(log, dump, func(table string) (count int64, err error) {
+			err = conn.Raw(fmt.Sprintf(countRowsSqlFmt, table)).Scan(&count).Error
+			return count, err
+		})
+	}
+
+	objectChecks := []struct {
+		FileNameFmt string
+		Types       []string
+		Kind        string
+	}{
+		{artifacts.CreateViewFileNameFmt, viewTypes, "view"},
+		{artifacts.CreateStoredProcedureFileNameFmt, procTypes, "stored procedure"},
+	}
+	for _, check := range objectChecks {
+		files, err := fs.Glob(fsys, path.Join(dir, fmt.Sprintf(check.FileNameFmt, "*")))
+		if err != nil {
+			return err
+		}
+		missing, err := checkObjects(log, files, check.FileNameFmt, check.Kind, func(name string) (count int, err error) {
+			err = conn.Raw(objectExistsSql, name, check.Types).Scan(&count).Error
+			return count, err
+		})
+		if err != nil {
+			return err
+		}
+		mismatches += missing
+	}
+
+	log.Info("verify completed", "mismatches", mismatches)
+	if mismatches > 0 {
+		return fmt.Errorf("verification failed; %d mismatch(es)", mismatches)
+	}
+	return nil
+}
+
+// checkRowCounts compares the number of rows the dump inserts into each table with countRows, and returns the number of
+// tables that don't match.  A dump can hold several INSERT statements, possibly for different tables
+func checkRowCounts(log *slog.Logger, dump *mssql.DataDump, countRows func(table string) (int64, error)) (mismatches int) {
+	expected := map[string]int64{}
+	tables := []string{}
+	for i := range dump.Records {
+		if dump.Records[i].Kind != mssql.DumpRow {
+			continue
+		}
+		table := dump.Records[i].Insert.Table
+		if _, ok := expected[table]; !ok {
+			tables = append(tables, table)
+		}
+		expected[table]++
+	}
+
+	for _, table := range tables {
+		actual, err := countRows(table)
+		if err != nil {
+			log.Warn("row count failed", "file", dump.Name, "kind", "table", "object", table, "error", err)
+			mismatches++
+			continue
+		}
+		if actual != expected[table] {
+			log.Warn("row count mismatch", "file", dump.Name, "kind", "table", "object", table, "rows", actual, "expected", expected[table])
+			mismatches++
+			continue
+		}
+		log.Info("row count matches", "file", dump.Name, "kind", "table", "object", table, "rows", actual)
+	}
+	return mismatches
+}
+
+// checkObjects checks that the object each file creates exists, using countObjects, and returns the number of
+// missing objects
+func checkObjects(log *slog.Logger, files []string, fileNameFmt string, kind string, countObjects func(name string) (int, error)) (missing int, err error) {
+	for _, file := range files {
+		name := getObjectName(path.Base(file), fileNameFmt)
+		count, err := countObjects(name)
+		if err != nil {
+			return missing, err
+		}
+		if count == 0 {
+			log.Warn("object missing", "file", path.Base(file), "kind", kind, "object", name)
+			missing++
+			continue
+		}
+		log.Info("object exists", "file", path.Base(file), "kind", kind, "object", name)
+	}
+	return missing, nil
+}
+
+// getObjectName extracts the object name from an artifact file name, e.g. 7_CreateView_[Name].sql
+func getObjectName(fileName string, fileNameFmt string) string {
+	prefix, suffix, _ := strings.Cut(fileNameFmt, "%s")
+	return strings.TrimSuffix(strings.TrimPrefix(fileName, prefix), suffix)
+}
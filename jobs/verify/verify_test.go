@@ -0,0 +1,144 @@
+package verify
+
+import (
+	"errors"
+	"kodb-import/artifacts"
+	"kodb-import/mssql"
+	"log/slog"
+	"reflect"
+	"testing"
+)
+
+const (
+	// itemDumpSql inserts 3 rows into ITEM over two statements, and 1 into ZONE, around statements that aren't rows
+	itemDumpSql = "SET IDENTITY_INSERT [dbo].[ITEM] ON\nGO\n" +
+		"INSERT INTO [dbo].[ITEM] ([Num], [strName]) VALUES\n(1, N'Sword'),\n(2, N'Shield')\nGO\n" +
+		"SET IDENTITY_INSERT [dbo].[ITEM] OFF\nGO\n" +
+		"INSERT INTO [dbo].[ZONE] VALUES (21, N'Moradon')\nGO\n" +
+		"INSERT INTO [dbo].[ITEM] ([Num], [strName]) VALUES (3, N'Bow')\nGO\n"
+)
+
+func TestCheckRowCounts(t *testing.T) {
+	tests := []struct {
+		name           string
+		sql            string
+		rows           map[string]int64
+		countErr       error
+		wantTables     []string
+		wantMismatches int
+	}{
+		{
+			name:       "match",
+			sql:        itemDumpSql,
+			rows:       map[string]int64{"[dbo].[ITEM]": 3, "[dbo].[ZONE]": 1},
+			wantTables: []string{"[dbo].[ITEM]", "[dbo].[ZONE]"},
+		},
+		{
+			name:           "mismatch",
+			sql:            itemDumpSql,
+			rows:           map[string]int64{"[dbo].[ITEM]": 2, "[dbo].[ZONE]": 1},
+			wantTables:     []string{"[dbo].[ITEM]", "[dbo].[ZONE]"},
+			wantMismatches: 1,
+		},
+		{
+			name:           "empty tables",
+			sql:            itemDumpSql,
+			rows:           map[string]int64{},
+			wantTables:     []string{"[dbo].[ITEM]", "[dbo].[ZONE]"},
+			wantMismatches: 2,
+		},
+		{
+			name:           "count error",
+			sql:            itemDumpSql,
+			countErr:       errors.New("Invalid object name 'dbo.ITEM'."),
+			wantTables:     []string{"[dbo].[ITEM]", "[dbo].[ZONE]"},
+			wantMismatches: 2,
+		},
+		{
+			name:       "no rows",
+			sql:        "SET IDENTITY_INSERT [dbo].[ITEM] ON\nGO\nSET IDENTITY_INSERT [dbo].[ITEM] OFF\nGO\n",
+			wantTables: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dump, err := mssql.ParseDataDump("6_InsertData_ITEM.sql", tt.sql)
+			if err != nil {
+				t.Fatalf("ParseDataDump() error = %v", err)
+			}
+
+			tables := []string{}
+			got := checkRowCounts(slog.Default(), dump, func(table string) (int64, error) {
+				tables = append(tables, table)
+				return tt.rows[table], tt.countErr
+			})
+			if got != tt.wantMismatches {
+				t.Errorf("checkRowCounts() = %d, want %d", got, tt.wantMismatches)
+			}
+			// each table is counted once, in the order the dump first inserts into it
+			if !reflect.DeepEqual(tables, tt.wantTables) {
+				t.Errorf("checkRowCounts() counted %v, want %v", tables, tt.wantTables)
+			}
+		})
+	}
+}
+
+func TestCheckObjects(t *testing.T) {
+	files := []string{"OpenKO-db/ManualSetup/7_CreateView_VIEW_ITEM.sql", "OpenKO-db/ManualSetup/7_CreateView_VIEW_ZONE.sql"}
+	tests := []struct {
+		name        string
+		counts      map[string]int
+		countErr    error
+		wantMissing int
+		wantErr     bool
+	}{
+		{
+			name:   "exist",
+			counts: map[string]int{"VIEW_ITEM": 1, "VIEW_ZONE": 1},
+		},
+		{
+			name:        "missing",
+			counts:      map[string]int{"VIEW_ZONE": 1},
+			wantMissing: 1,
+		},
+		{
+			name:     "error",
+			countErr: errors.New("connection reset"),
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := checkObjects(slog.Default(), files, artifacts.CreateViewFileNameFmt, "view", func(name string) (int, error) {
+				return tt.counts[name], tt.countErr
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkObjects() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.wantMissing {
+				t.Errorf("checkObjects() = %d, want %d", got, tt.wantMissing)
+			}
+		})
+	}
+}
+
+func TestGetObjectName(t *testing.T) {
+	tests := []struct {
+		name        string
+		fileName    string
+		fileNameFmt string
+		want        string
+	}{
+		{"view", "7_CreateView_VIEW_ITEM.sql", artifacts.CreateViewFileNameFmt, "VIEW_ITEM"},
+		{"stored procedure", "8_CreateStoredProc_GET_ITEM.sql", artifacts.CreateStoredProcedureFileNameFmt, "GET_ITEM"},
+		{"name with the suffix", "7_CreateView_VIEW.sql.sql", artifacts.CreateViewFileNameFmt, "VIEW.sql"},
+		{"other artifact", "5_CreateTable_ITEM.sql", artifacts.CreateViewFileNameFmt, "5_CreateTable_ITEM"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getObjectName(tt.fileName, tt.fileNameFmt); got != tt.want {
+				t.Errorf("getObjectName(%q) = %q, want %q", tt.fileName, got, tt.want)
+			}
+		})
+	}
+}
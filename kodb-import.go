@@ -2,22 +2,38 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"kodb-import/arg"
+	"kodb-import/artifacts"
 	"kodb-import/config"
+	"kodb-import/dbDriver"
 	"kodb-import/jobs/clean"
+	"kodb-import/jobs/diff"
+	"kodb-import/jobs/exportData"
 	"kodb-import/jobs/importDb"
+	"kodb-import/jobs/migrate"
+	"kodb-import/jobs/verify"
+	"kodb-import/logging"
 	"kodb-import/mssql"
-	"log"
+	"kodb-import/postgres"
+	"log/slog"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
 	"github.com/Open-KO/kodb-godef/enums/dbType"
-	"gorm.io/gorm"
 )
 
 const (
 	appTitle    = "OpenKO Database Import Utility"
 	outputWidth = 120
+
+	// exitCancelled is the exit code used when the run is cancelled by SIGINT/SIGTERM; 128 + SIGINT, like a shell
+	exitCancelled = 130
+	// exitConfigErr is the exit code used when the arguments or config are invalid, so nothing was run
+	exitConfigErr = 1
 )
 
 type dbInfo struct {
@@ -30,62 +46,150 @@ func printHeaderRow() {
 }
 
 func main() {
+	exitCode := 0
 	defer func() {
 		// catch-all panic error
 		if r := recover(); r != nil {
-			log.Printf("Recovered from panic: %v", r)
+			slog.Error("recovered from panic", "error", r)
+			os.Exit(1)
+		}
+		if exitCode != 0 {
+			os.Exit(exitCode)
 		}
 	}()
 
-	// Print intro header
-	printHeaderRow()
-	titlePad := (outputWidth - len(appTitle)) / 2
-	fmt.Printf("%[2]s%[1]s%[2]s\n", appTitle, strings.Repeat(" ", titlePad))
-	printHeaderRow()
-
 	args := arg.GetArgs()
-	if err := args.Validate(); err != nil {
+	if err := logging.Init(args.LogFormat, args.LogLevel); err != nil {
 		fmt.Printf("arguments error: %v, closing.", err)
+		exitCode = exitConfigErr
+		return
+	}
+
+	// Print intro header; json output is only log events
+	if logging.Format == logging.FormatText {
+		printHeaderRow()
+		titlePad := (outputWidth - len(appTitle)) / 2
+		fmt.Printf("%[2]s%[1]s%[2]s\n", appTitle, strings.Repeat(" ", titlePad))
+		printHeaderRow()
+	}
+
+	if err := args.Validate(); err != nil {
+		slog.Error("arguments error", "error", err)
+		exitCode = exitConfigErr
 		return
 	}
 
 	// loading config for the first time can throw a panic, so let's do it here
 	// uses a singleton pattern, so once loaded from disk it's in memory
-	fmt.Print("Loading config...")
+	slog.Info("loading config", "path", config.ConfigPath)
 	conf := config.GetConfig()
 	// apply any command-line overrides
 	if args.DbUser != "" {
 		conf.DatabaseConfig.User = args.DbUser
 	}
 	if args.DbPass != "" {
+		if !config.IsSecretSource(args.DbPass) {
+			slog.Warn("-dbpass is visible in the process list and shell history; use -dbpass env:NAME, file:/path, or prompt instead")
+		}
 		conf.DatabaseConfig.Password = args.DbPass
 	}
 	if args.SchemaDir != "" {
 		conf.GenConfig.SchemaDir = args.SchemaDir
 	}
+	if args.ConnectTimeout > 0 {
+		conf.DatabaseConfig.Timeouts.Connect = args.ConnectTimeout
+	}
+	if args.BatchTimeout > 0 {
+		conf.DatabaseConfig.Timeouts.Batch = args.BatchTimeout
+	}
+	if args.StageTimeout > 0 {
+		conf.DatabaseConfig.Timeouts.Stage = args.StageTimeout
+	}
+	if args.Timeout > 0 {
+		conf.DatabaseConfig.Timeouts.Overall = args.Timeout
+	}
+	importDb.StageTimeout = conf.DatabaseConfig.Timeouts.Stage
+	// env:NAME, file:/path, and prompt passwords are read now that every override has been applied
+	if err := conf.ResolveSecrets(); err != nil {
+		slog.Error("config error", "error", err)
+		exitCode = exitConfigErr
+		return
+	}
+	if conf.DatabaseConfig.Type == "" {
+		conf.DatabaseConfig.Type = dbDriver.MssqlType
+	}
+	if err := validateDbType(conf.DatabaseConfig.Type, args); err != nil {
+		slog.Error("config error", "error", err)
+		exitCode = exitConfigErr
+		return
+	}
+	if err := validateSchemaDir(conf.GenConfig.SchemaDir, args); err != nil {
+		slog.Error("config error", "error", err)
+		exitCode = exitConfigErr
+		return
+	}
 	if args.ImportBatchSize > 1 && args.ImportBatchSize < 1000 {
 		importDb.ImportBatSize = args.ImportBatchSize
 	}
-	fmt.Println("done")
+	importDb.IsBulkCopy = args.BulkCopy
+	importDb.IsResume = args.Resume
+	if args.ImportWorkers > 1 {
+		importDb.ImportWorkers = args.ImportWorkers
+	}
+	slog.Info("config loaded", "type", conf.DatabaseConfig.Type, "schemaDir", conf.GenConfig.SchemaDir)
+	if artifacts.IsSchemaEmbedded() {
+		slog.Info("schema directory not found; using the embedded OpenKO-db", "schemaDir", conf.GenConfig.SchemaDir, "version", artifacts.EmbeddedSchemaVersion)
+	}
 
-	// Create a stub context for use with our db-ops.  We're not doing anything fancy with it now, but it will give us a
-	// few options if we ever desire them (deadlines, cancel funcs, key:val mapping)
+	// appCtx is cancelled by SIGINT/SIGTERM (Ctrl-C); jobs stop between batches and the open transaction is rolled back
 	// https://pkg.go.dev/context
-	appCtx := context.Background()
+	appCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if conf.DatabaseConfig.Timeouts.Overall > 0 {
+		var cancel context.CancelFunc
+		appCtx, cancel = context.WithTimeout(appCtx, conf.DatabaseConfig.Timeouts.Overall)
+		defer cancel()
+	}
 
+	// databases are processed in the order the server stack depends on them: login, game, then log
 	dbs := []dbInfo{}
+	for i := range conf.GenConfig.LoginDbs {
+		dbs = append(dbs, dbInfo{
+			Config: conf.GenConfig.LoginDbs[i],
+			Type:   dbType.ACCOUNT,
+		})
+	}
 	for i := range conf.GenConfig.GameDbs {
 		dbs = append(dbs, dbInfo{
 			Config: conf.GenConfig.GameDbs[i],
 			Type:   dbType.GAME,
 		})
 	}
+	for i := range conf.GenConfig.LogDbs {
+		dbs = append(dbs, dbInfo{
+			Config: conf.GenConfig.LogDbs[i],
+			Type:   dbType.LOG,
+		})
+	}
 
-	// TODO: Add multi-db support by updating the config structure with LoginDbs and LogDbs
-	// and adding them to the dbs list
+	if args.ExportDir != "" {
+		var err error
+		importDb.Exporter, err = importDb.NewScriptExporter(args.ExportDir)
+		if err != nil {
+			slog.Error("failed to create export directory", "dir", args.ExportDir, "error", err)
+			exitCode = exitConfigErr
+			return
+		}
+		defer importDb.Exporter.Close()
+	}
 
 	for i := range dbs {
 		err := processDb(appCtx, dbs[i], args)
+		if errors.Is(err, context.Canceled) {
+			slog.Error("cancelled", "db", dbs[i].Config.Name, "error", err)
+			exitCode = exitCancelled
+			return
+		}
 		if err != nil {
 			panic(err)
 		}
@@ -96,29 +200,50 @@ func main() {
 func processDb(appCtx context.Context, db dbInfo, args arg.Args) (err error) {
 	// a clean driver should be used/configured per database as the application logic
 	// makes heavy use of the driver.GenDbConfig
-	driver := mssql.NewMssqlDbDriver(db.Config, db.Type)
+	driver := newDbDriver(db, args)
+	// jobs that read T-SQL specific catalogs are only supported on mssql; see validateDbType
+	mssqlDriver, _ := driver.(*mssql.MssqlDbDriver)
+	slog.Info("processing database", "db", db.Config.Name, "type", string(db.Type))
 
-	var tx *gorm.DB
 	defer func() {
 		// catch-all panic error
 		if r := recover(); r != nil {
 			err = fmt.Errorf("panic: %v", r)
 		}
-		if tx != nil {
-			if err != nil {
-				rErr := driver.RollbackTx()
-				if rErr != nil {
-					fmt.Printf("failed to rollback transaction: %v", rErr)
-				}
-			} else {
-				err = driver.CommitTx()
-			}
-		}
+		// commit the transaction fence, or roll back whatever is still open on error
+		err = dbDriver.EndTx(driver, err)
 		driver.CloseConnection()
 	}()
 
-	// Run clean if either -clean or -import was called
-	if args.Clean || args.Import {
+	// export renders the import scripts without connecting to the server
+	if args.ExportDir != "" {
+		return importDb.ImportDb(appCtx, driver)
+	}
+
+	// export-data only reads from the database
+	if args.ExportData {
+		return exportData.ExportData(appCtx, mssqlDriver)
+	}
+
+	// diff only reads from the database
+	if args.Diff {
+		err = diff.Diff(appCtx, mssqlDriver)
+		if err != nil {
+			return err
+		}
+		if args.Verify {
+			err = verify.Verify(appCtx, mssqlDriver)
+		}
+		return err
+	}
+
+	// migrate upgrades the existing database in place; each migration commits on its own
+	if args.Migrate {
+		return migrate.Migrate(appCtx, mssqlDriver)
+	}
+
+	// Run clean if either -clean or -import was called; a resumed import keeps the work already committed
+	if (args.Clean || args.Import) && !args.Resume {
 		err = clean.Clean(appCtx, driver)
 		if err != nil {
 			return err
@@ -132,12 +257,74 @@ func processDb(appCtx context.Context, db dbInfo, args arg.Args) (err error) {
 		}
 	}
 
-	// ImportDb will set driver.Tx as it has a mix of work to do on master/gen databases.  Get a ref to that pointer,
-	// or open it now if import wasn't called
-	tx, err = driver.GetTx()
+	// nothing was executed, so there's no transaction to commit
+	if driver.IsPlanMode() {
+		return nil
+	}
+
+	// verify checks the committed database, so commit the import first
+	if args.Verify {
+		if driver.HasTx() {
+			err = driver.CommitTx()
+			if err != nil {
+				return err
+			}
+		}
+		err = verify.Verify(appCtx, mssqlDriver)
+		if err != nil {
+			return err
+		}
+	}
+
+	// ImportDb will set driver.Tx as it has a mix of work to do on master/gen databases; open it now if import wasn't
+	// called, so EndTx commits it
+	_, err = driver.GetTx()
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// newDbDriver returns the DbDriver implementation for the configured databaseConfig.type
+func newDbDriver(db dbInfo, args arg.Args) dbDriver.DbDriver {
+	var base *dbDriver.Base
+	var driver dbDriver.DbDriver
+	switch config.GetConfig().DatabaseConfig.Type {
+	case dbDriver.PostgresType:
+		pgDriver := postgres.NewPostgresDbDriver(db.Config, db.Type)
+		base, driver = &pgDriver.Base, pgDriver
+	default:
+		msDriver := mssql.NewMssqlDbDriver(db.Config, db.Type)
+		base, driver = &msDriver.Base, msDriver
+	}
+	base.IsPlan = args.Plan
+	base.CommitMode = dbDriver.CommitMode(args.CommitMode)
+
+	return driver
+}
+
+// validateSchemaDir checks that the requested jobs can use the configured genConfig.schemaDir; archives are read-only
+func validateSchemaDir(schemaDir string, args arg.Args) error {
+	if artifacts.IsArchive(schemaDir) && args.ExportData {
+		return fmt.Errorf("-export-data needs genConfig.schemaDir to be a directory, not an archive: %s", schemaDir)
+	}
+	return nil
+}
+
+// validateDbType checks the configured databaseConfig.type and that the requested jobs support it
+func validateDbType(databaseType string, args arg.Args) error {
+	switch databaseType {
+	case "", dbDriver.MssqlType:
+		return nil
+	case dbDriver.PostgresType:
+	default:
+		return fmt.Errorf("unsupported databaseConfig.type %q; expected %s or %s", databaseType, dbDriver.MssqlType, dbDriver.PostgresType)
+	}
+
+	// postgres is clean-only: the schema's templates and data files are T-SQL, and OpenKO-db has no PostgreSQL templates
+	if args.Import || args.ExportDir != "" || args.ExportData || args.Diff || args.Verify || args.Migrate || args.BulkCopy {
+		return fmt.Errorf("-import, -export, -export-data, -diff, -verify, -migrate and -bulk are only supported with databaseConfig.type %s", dbDriver.MssqlType)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+	gormLogger "gorm.io/gorm/logger"
+)
+
+// the logging package configures the application's log/slog output and adapts it for gorm.
+// This package shouldn't import any other packages in this project to avoid circular dependencies.
+
+const (
+	// FormatText writes key=value log lines; the default
+	FormatText = "text"
+	// FormatJson writes one JSON object per log line
+	FormatJson = "json"
+
+	// slowSqlThreshold is the duration after which a statement is logged as slow
+	slowSqlThreshold = time.Second
+)
+
+var (
+	// Level is the minimum level logged by the application and gorm; set by Init
+	Level = new(slog.LevelVar)
+
+	// Format is the active log format; set by Init
+	Format = FormatText
+)
+
+// Init sets the default slog logger to write the given format to stdout at the given level.  Records clear and redraw
+// the status line (see DrawStatusLine), so the two can share a terminal
+func Init(format string, level string) error {
+	err := Level.UnmarshalText([]byte(level))
+	if err != nil {
+		return fmt.Errorf("invalid log level %q; expected debug, info, warn, or error", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: Level}
+	switch format {
+	case FormatText:
+		slog.SetDefault(slog.New(&statusHandler{slog.NewTextHandler(os.Stdout, opts)}))
+	case FormatJson:
+		slog.SetDefault(slog.New(&statusHandler{slog.NewJSONHandler(os.Stdout, opts)}))
+	default:
+		return fmt.Errorf("invalid log format %q; expected %s or %s", format, FormatText, FormatJson)
+	}
+	Format = format
+
+	return nil
+}
+
+// SlogGormLogger writes gorm's SQL trace to the default slog logger
+type SlogGormLogger struct {
+	LogLevel gormLogger.LogLevel
+}
+
+// NewGormLogger returns a gorm logger following the application's log Level: every statement is traced when the
+// level is debug, and slow statements are logged as warnings unless the level is error
+func NewGormLogger() gormLogger.Interface {
+	logLevel := gormLogger.Error
+	switch {
+	case Level.Level() <= slog.LevelDebug:
+		logLevel = gormLogger.Info
+	case Level.Level() <= slog.LevelWarn:
+		logLevel = gormLogger.Warn
+	}
+
+	return &SlogGormLogger{LogLevel: logLevel}
+}
+
+// LogMode returns a copy of the logger at the given gorm level
+func (this *SlogGormLogger) LogMode(level gormLogger.LogLevel) gormLogger.Interface {
+	return &SlogGormLogger{LogLevel: level}
+}
+
+// Info logs a gorm message at debug; gorm's info messages aren't application progress
+func (this *SlogGormLogger) Info(ctx context.Context, msg string, args ...any) {
+	if this.LogLevel >= gormLogger.Info {
+		slog.DebugContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+// Warn logs a gorm message at warn
+func (this *SlogGormLogger) Warn(ctx context.Context, msg string, args ...any) {
+	if this.LogLevel >= gormLogger.Warn {
+		slog.WarnContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+// Error logs a gorm message at error
+func (this *SlogGormLogger) Error(ctx context.Context, msg string, args ...any) {
+	if this.LogLevel >= gormLogger.Error {
+		slog.ErrorContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+// Trace logs an executed statement.  Failed statements are only traced at debug; the jobs report failures with
+// their file and batch, and some failures are expected (see DbDriver.IsIgnorableErr)
+func (this *SlogGormLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	if this.LogLevel <= gormLogger.Silent {
+		return
+	}
+
+	elapsed := time.Since(begin)
+	switch {
+	case err != nil && this.LogLevel >= gormLogger.Info && !errors.Is(err, gorm.ErrRecordNotFound):
+		sql, rows := fc()
+		slog.DebugContext(ctx, "sql failed", "sql", sql, "rows", rows, "duration", elapsed, "error", err)
+	case elapsed > slowSqlThreshold && this.LogLevel >= gormLogger.Warn:
+		sql, rows := fc()
+		slog.WarnContext(ctx, "slow sql", "sql", sql, "rows", rows, "duration", elapsed, "threshold", slowSqlThreshold)
+	case this.LogLevel >= gormLogger.Info:
+		sql, rows := fc()
+		slog.DebugContext(ctx, "sql", "sql", sql, "rows", rows, "duration", elapsed)
+	}
+}
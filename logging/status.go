@@ -0,0 +1,79 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+)
+
+// status is the line redrawn in place below the log output; see DrawStatusLine
+var status = &statusLine{}
+
+// statusLine is a single line of terminal output that's redrawn in place.  It's cleared before each log record is
+// written and drawn again after, so log lines and the status line don't overwrite each other
+type statusLine struct {
+	mu   sync.Mutex
+	out  io.Writer
+	text string
+}
+
+// clear erases the drawn line; the caller holds mu
+func (this *statusLine) clear() {
+	if this.text != "" {
+		// \r returns to the start of the line, \033[K clears it
+		fmt.Fprint(this.out, "\r\033[K")
+	}
+}
+
+// draw writes the line; the caller holds mu
+func (this *statusLine) draw() {
+	if this.text != "" {
+		fmt.Fprint(this.out, this.text)
+	}
+}
+
+// DrawStatusLine draws text on out in place of the previous status line.  out should be a terminal, usually stderr
+func DrawStatusLine(out io.Writer, text string) {
+	status.mu.Lock()
+	defer status.mu.Unlock()
+	status.clear()
+	status.out = out
+	status.text = text
+	status.draw()
+}
+
+// EndStatusLine leaves the last status line on screen and stops redrawing it around log records
+func EndStatusLine() {
+	status.mu.Lock()
+	defer status.mu.Unlock()
+	if status.text != "" {
+		fmt.Fprintln(status.out)
+	}
+	status.text = ""
+}
+
+// statusHandler clears the status line around each record written by the wrapped handler
+type statusHandler struct {
+	slog.Handler
+}
+
+// Handle writes the record with the status line cleared, then redraws it
+func (this *statusHandler) Handle(ctx context.Context, record slog.Record) error {
+	status.mu.Lock()
+	defer status.mu.Unlock()
+	status.clear()
+	defer status.draw()
+	return this.Handler.Handle(ctx, record)
+}
+
+// WithAttrs returns the wrapped handler with attrs, still clearing the status line
+func (this *statusHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &statusHandler{this.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup returns the wrapped handler with the group, still clearing the status line
+func (this *statusHandler) WithGroup(name string) slog.Handler {
+	return &statusHandler{this.Handler.WithGroup(name)}
+}
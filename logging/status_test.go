@@ -0,0 +1,36 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+)
+
+func TestStatusHandler(t *testing.T) {
+	// stdout and stderr share the terminal; a single buffer shows the order the two are written in
+	var out bytes.Buffer
+	log := slog.New(&statusHandler{slog.NewTextHandler(&out, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})}).With("db", "KN_online")
+
+	log.Info("before")
+	DrawStatusLine(&out, "table data: ITEM")
+	log.Info("during")
+	DrawStatusLine(&out, "table data: NPC")
+	EndStatusLine()
+	log.Info("after")
+
+	want := "level=INFO msg=before db=KN_online\n" +
+		"table data: ITEM" +
+		"\r\033[K" + "level=INFO msg=during db=KN_online\n" + "table data: ITEM" +
+		"\r\033[K" + "table data: NPC" + "\n" +
+		"level=INFO msg=after db=KN_online\n"
+	if out.String() != want {
+		t.Errorf("output = %q, want %q", out.String(), want)
+	}
+}
@@ -0,0 +1,198 @@
+package mssql
+
+import (
+	"fmt"
+	"kodb-import/dbDriver"
+	"strconv"
+	"strings"
+)
+
+// Batch is a single batch of a T-SQL script, as separated by "GO" lines
+type Batch = dbDriver.Batch
+
+// lexState tracks which kind of token the batch splitter is inside of
+type lexState int
+
+const (
+	lexCode lexState = iota
+	lexString
+	lexQuotedIdent
+	lexBracketIdent
+	lexLineComment
+	lexBlockComment
+)
+
+// SplitBatches breaks a T-SQL script into batches separated by GO lines, the way sqlcmd and SSMS do.  A GO line
+// contains only the GO keyword (case-insensitive), an optional repeat count, and an optional trailing -- comment.
+// GO is not a separator inside of string literals, quoted or bracketed identifiers, or block comments (which may
+// be nested), and identifiers such as GOLD or GOTO are never separators.  Blank batches are dropped.
+func SplitBatches(sql string) (batches []Batch, err error) {
+	state := lexCode
+	commentDepth := 0
+	// tokenLine is the line the current string/identifier/comment started on; used for error reporting
+	tokenLine := 0
+
+	batchStart := 0
+	batchLine := 1
+	line := 1
+	lineStart := 0
+
+	for i := 0; i < len(sql); {
+		// check for a GO separator at the start of every line that isn't inside of a multi-line token
+		if i == lineStart && state == lexCode {
+			lineEnd := strings.IndexByte(sql[i:], '\n')
+			if lineEnd < 0 {
+				lineEnd = len(sql)
+			} else {
+				lineEnd += i
+			}
+
+			repeat, isGo, goErr := parseGoLine(sql[i:lineEnd])
+			if goErr != nil {
+				return nil, fmt.Errorf("line %d: %v", line, goErr)
+			}
+			if isGo {
+				batches = appendBatch(batches, sql[batchStart:i], batchLine, repeat)
+				if lineEnd < len(sql) {
+					lineEnd++
+				}
+				i = lineEnd
+				line++
+				lineStart = i
+				batchStart = i
+				batchLine = line
+				continue
+			}
+		}
+
+		c := sql[i]
+		next := byte(0)
+		if i+1 < len(sql) {
+			next = sql[i+1]
+		}
+
+		switch state {
+		case lexCode:
+			switch {
+			case c == '\'':
+				state, tokenLine = lexString, line
+			case c == '"':
+				state, tokenLine = lexQuotedIdent, line
+			case c == '[':
+				state, tokenLine = lexBracketIdent, line
+			case c == '-' && next == '-':
+				state = lexLineComment
+				i++
+			case c == '/' && next == '*':
+				state, tokenLine = lexBlockComment, line
+				commentDepth = 1
+				i++
+			}
+		case lexString:
+			if c == '\'' {
+				if next == '\'' {
+					i++
+				} else {
+					state = lexCode
+				}
+			}
+		case lexQuotedIdent:
+			if c == '"' {
+				if next == '"' {
+					i++
+				} else {
+					state = lexCode
+				}
+			}
+		case lexBracketIdent:
+			if c == ']' {
+				if next == ']' {
+					i++
+				} else {
+					state = lexCode
+				}
+			}
+		case lexLineComment:
+			if c == '\n' {
+				state = lexCode
+			}
+		case lexBlockComment:
+			if c == '/' && next == '*' {
+				commentDepth++
+				i++
+			} else if c == '*' && next == '/' {
+				commentDepth--
+				i++
+				if commentDepth == 0 {
+					state = lexCode
+				}
+			}
+		}
+
+		if sql[i] == '\n' {
+			line++
+			lineStart = i + 1
+		}
+		i++
+	}
+
+	switch state {
+	case lexString:
+		return nil, fmt.Errorf("line %d: unterminated string literal", tokenLine)
+	case lexQuotedIdent, lexBracketIdent:
+		return nil, fmt.Errorf("line %d: unterminated quoted identifier", tokenLine)
+	case lexBlockComment:
+		return nil, fmt.Errorf("line %d: unterminated block comment", tokenLine)
+	}
+
+	batches = appendBatch(batches, sql[batchStart:], batchLine, 1)
+	return batches, nil
+}
+
+// parseGoLine checks if a line is a GO batch separator, returning its repeat count
+func parseGoLine(line string) (repeat int, isGo bool, err error) {
+	s := strings.TrimSpace(line)
+	if len(s) < 2 || !strings.EqualFold(s[:2], "GO") {
+		return 0, false, nil
+	}
+	s = s[2:]
+	// GO must be its own token; GOLD, GOTO, etc. are not separators
+	if s != "" && s[0] != ' ' && s[0] != '\t' && !strings.HasPrefix(s, "--") {
+		return 0, false, nil
+	}
+
+	if idx := strings.Index(s, "--"); idx >= 0 {
+		s = s[:idx]
+	}
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 1, true, nil
+	}
+
+	repeat, err = strconv.Atoi(s)
+	if err != nil {
+		// something other than a count follows GO (e.g. "go to"), so this isn't a separator line
+		return 0, false, nil
+	}
+	if repeat < 1 {
+		return 0, false, fmt.Errorf("invalid GO repeat count %d", repeat)
+	}
+
+	return repeat, true, nil
+}
+
+// appendBatch trims the batch text and appends it if it's not blank.  line is adjusted to the first non-blank line
+func appendBatch(batches []Batch, sql string, line int, repeat int) []Batch {
+	trimmed := strings.TrimLeft(sql, " \t\r\n")
+	line += strings.Count(sql[:len(sql)-len(trimmed)], "\n")
+	trimmed = strings.TrimSpace(trimmed)
+	if trimmed == "" {
+		return batches
+	}
+
+	return append(batches, Batch{
+		Sql:    trimmed,
+		Line:   line,
+		Repeat: repeat,
+	})
+}
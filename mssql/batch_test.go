@@ -0,0 +1,229 @@
+package mssql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitBatches(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want []Batch
+	}{
+		{
+			name: "empty script",
+			sql:  "",
+			want: nil,
+		},
+		{
+			name: "whitespace only",
+			sql:  "  \n\t\r\n",
+			want: nil,
+		},
+		{
+			name: "single batch without terminator",
+			sql:  "SELECT 1",
+			want: []Batch{{Sql: "SELECT 1", Line: 1, Repeat: 1}},
+		},
+		{
+			name: "single batch with terminator",
+			sql:  "SELECT 1\nGO\n",
+			want: []Batch{{Sql: "SELECT 1", Line: 1, Repeat: 1}},
+		},
+		{
+			name: "multiple batches",
+			sql:  "USE [KN_online]\nGO\nCREATE TABLE [dbo].[ITEM] ([Num] int)\nGO\n",
+			want: []Batch{
+				{Sql: "USE [KN_online]", Line: 1, Repeat: 1},
+				{Sql: "CREATE TABLE [dbo].[ITEM] ([Num] int)", Line: 3, Repeat: 1},
+			},
+		},
+		{
+			name: "lowercase and indented terminator",
+			sql:  "SELECT 1\n  go  \nSELECT 2",
+			want: []Batch{
+				{Sql: "SELECT 1", Line: 1, Repeat: 1},
+				{Sql: "SELECT 2", Line: 3, Repeat: 1},
+			},
+		},
+		{
+			name: "CRLF line endings",
+			sql:  "SELECT 1\r\nGO\r\nSELECT 2\r\nGO\r\n",
+			want: []Batch{
+				{Sql: "SELECT 1", Line: 1, Repeat: 1},
+				{Sql: "SELECT 2", Line: 3, Repeat: 1},
+			},
+		},
+		{
+			name: "blank batches are dropped",
+			sql:  "GO\n\nGO\nSELECT 1\nGO\n\nGO",
+			want: []Batch{{Sql: "SELECT 1", Line: 4, Repeat: 1}},
+		},
+		{
+			name: "line numbers skip leading blank lines",
+			sql:  "SELECT 1\nGO\n\n\n  SELECT 2\nGO",
+			want: []Batch{
+				{Sql: "SELECT 1", Line: 1, Repeat: 1},
+				{Sql: "SELECT 2", Line: 5, Repeat: 1},
+			},
+		},
+		{
+			name: "repeat count",
+			sql:  "INSERT INTO T DEFAULT VALUES\nGO 5\nSELECT 1",
+			want: []Batch{
+				{Sql: "INSERT INTO T DEFAULT VALUES", Line: 1, Repeat: 5},
+				{Sql: "SELECT 1", Line: 3, Repeat: 1},
+			},
+		},
+		{
+			name: "trailing comment after terminator",
+			sql:  "SELECT 1\nGO -- end of batch\nSELECT 2\nGO 2 -- twice\n",
+			want: []Batch{
+				{Sql: "SELECT 1", Line: 1, Repeat: 1},
+				{Sql: "SELECT 2", Line: 3, Repeat: 2},
+			},
+		},
+		{
+			name: "comment directly after terminator",
+			sql:  "SELECT 1\nGO--done\nSELECT 2",
+			want: []Batch{
+				{Sql: "SELECT 1", Line: 1, Repeat: 1},
+				{Sql: "SELECT 2", Line: 3, Repeat: 1},
+			},
+		},
+		{
+			name: "identifiers starting with GO",
+			sql:  "SELECT\nGOLD,\nGOODS_ID\nFROM T\nGOTO label\nGO",
+			want: []Batch{{Sql: "SELECT\nGOLD,\nGOODS_ID\nFROM T\nGOTO label", Line: 1, Repeat: 1}},
+		},
+		{
+			name: "GO followed by non-numeric text",
+			sql:  "SELECT 1\ngo to_label\nGO",
+			want: []Batch{{Sql: "SELECT 1\ngo to_label", Line: 1, Repeat: 1}},
+		},
+		{
+			name: "GO mid-line is not a separator",
+			sql:  "SELECT 1 GO\nSELECT 2",
+			want: []Batch{{Sql: "SELECT 1 GO\nSELECT 2", Line: 1, Repeat: 1}},
+		},
+		{
+			name: "GO inside string literal",
+			sql:  "INSERT INTO T VALUES ('line one\nGO\nline three')\nGO\nSELECT 2",
+			want: []Batch{
+				{Sql: "INSERT INTO T VALUES ('line one\nGO\nline three')", Line: 1, Repeat: 1},
+				{Sql: "SELECT 2", Line: 5, Repeat: 1},
+			},
+		},
+		{
+			name: "GO inside unicode string literal with escaped quotes",
+			sql:  "SELECT N'it''s\nGO\n'\nGO",
+			want: []Batch{{Sql: "SELECT N'it''s\nGO\n'", Line: 1, Repeat: 1}},
+		},
+		{
+			name: "GO inside block comment",
+			sql:  "/* header\nGO\n*/\nSELECT 1\nGO",
+			want: []Batch{{Sql: "/* header\nGO\n*/\nSELECT 1", Line: 1, Repeat: 1}},
+		},
+		{
+			name: "GO inside nested block comment",
+			sql:  "/* outer /* inner */\nGO\n*/\nSELECT 1\nGO\nSELECT 2",
+			want: []Batch{
+				{Sql: "/* outer /* inner */\nGO\n*/\nSELECT 1", Line: 1, Repeat: 1},
+				{Sql: "SELECT 2", Line: 6, Repeat: 1},
+			},
+		},
+		{
+			name: "GO inside bracketed identifier",
+			sql:  "SELECT 1 AS [a\nGO\nb]\nGO",
+			want: []Batch{{Sql: "SELECT 1 AS [a\nGO\nb]", Line: 1, Repeat: 1}},
+		},
+		{
+			name: "GO inside quoted identifier",
+			sql:  "SELECT 1 AS \"a\nGO\n\"\"b\"\nGO",
+			want: []Batch{{Sql: "SELECT 1 AS \"a\nGO\n\"\"b\"", Line: 1, Repeat: 1}},
+		},
+		{
+			name: "escaped bracket in identifier",
+			sql:  "SELECT 1 AS [a]]\nGO\nb]\nGO",
+			want: []Batch{{Sql: "SELECT 1 AS [a]]\nGO\nb]", Line: 1, Repeat: 1}},
+		},
+		{
+			name: "line comment does not hide the next line",
+			sql:  "SELECT 1 -- it's a comment with a quote\nGO\nSELECT 2",
+			want: []Batch{
+				{Sql: "SELECT 1 -- it's a comment with a quote", Line: 1, Repeat: 1},
+				{Sql: "SELECT 2", Line: 3, Repeat: 1},
+			},
+		},
+		{
+			name: "block comment markers inside strings",
+			sql:  "SELECT '/*'\nGO\nSELECT '*/'\nGO",
+			want: []Batch{
+				{Sql: "SELECT '/*'", Line: 1, Repeat: 1},
+				{Sql: "SELECT '*/'", Line: 3, Repeat: 1},
+			},
+		},
+		{
+			name: "quotes inside line comments",
+			sql:  "-- don't\nSELECT 1\nGO\nSELECT 2",
+			want: []Batch{
+				{Sql: "-- don't\nSELECT 1", Line: 1, Repeat: 1},
+				{Sql: "SELECT 2", Line: 4, Repeat: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SplitBatches(tt.sql)
+			if err != nil {
+				t.Fatalf("SplitBatches() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitBatches() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitBatchesErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		sql     string
+		wantErr string
+	}{
+		{
+			name:    "unterminated string literal",
+			sql:     "SELECT 1\nGO\nSELECT 'abc\nGO",
+			wantErr: "line 3: unterminated string literal",
+		},
+		{
+			name:    "unterminated bracketed identifier",
+			sql:     "SELECT [abc\nGO",
+			wantErr: "line 1: unterminated quoted identifier",
+		},
+		{
+			name:    "unterminated block comment",
+			sql:     "SELECT 1\n/* /* */\nGO",
+			wantErr: "line 2: unterminated block comment",
+		},
+		{
+			name:    "zero repeat count",
+			sql:     "SELECT 1\nGO 0",
+			wantErr: "line 2: invalid GO repeat count 0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := SplitBatches(tt.sql)
+			if err == nil {
+				t.Fatalf("SplitBatches() expected error %q", tt.wantErr)
+			}
+			if err.Error() != tt.wantErr {
+				t.Errorf("SplitBatches() error = %q, want %q", err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,621 @@
+package mssql
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// identityInsertSqlFmt turns IDENTITY_INSERT on or off for a table, if one of the listed columns is its identity
+	// column; the arguments are the table name escaped for a string literal, the column names as a list of string
+	// literals, the table name and the state
+	identityInsertSqlFmt = "IF EXISTS (SELECT 1 FROM sys.identity_columns WHERE object_id = OBJECT_ID(N'%s') AND name IN (%s)) SET IDENTITY_INSERT %s %s"
+)
+
+var (
+	// insertHeaderRegex captures the table name and optional column list of an INSERT ... VALUES header
+	insertHeaderRegex = regexp.MustCompile(`(?is)^INSERT\s+(?:INTO\s+)?((?:\[[^\]]+\]|"[^"]+"|\w+)(?:\s*\.\s*(?:\[[^\]]+\]|"[^"]+"|\w+))*)\s*(?:\(([^)]*)\))?\s*VALUES$`)
+
+	// identityInsertRegex matches a SET IDENTITY_INSERT statement
+	identityInsertRegex = regexp.MustCompile(`(?i)^SET\s+IDENTITY_INSERT\s`)
+
+	// statementKeywords start a new statement when they begin a line; see parseStatement
+	statementKeywords = []string{"INSERT", "SET", "UPDATE", "DELETE", "TRUNCATE", "MERGE", "ALTER", "DBCC", "DECLARE", "EXEC", "EXECUTE", "PRINT", "USE"}
+)
+
+// LiteralKind identifies the type of a value parsed from a data dump row
+type LiteralKind int
+
+const (
+	NullLiteral LiteralKind = iota
+	NumberLiteral
+	StringLiteral
+	BinaryLiteral
+	// ExprLiteral is any other expression, such as CAST(N'...' AS DateTime); Text holds the expression source
+	ExprLiteral
+)
+
+// Literal is a single value parsed from a data dump row
+type Literal struct {
+	Kind LiteralKind
+	// Text is the unescaped string value, the number or expression source, or the hex digits of a binary value
+	Text string
+}
+
+// DumpRecordKind identifies the type of a DumpRecord
+type DumpRecordKind int
+
+const (
+	// DumpStatement is any statement that isn't an INSERT ... VALUES, such as SET IDENTITY_INSERT [x] ON
+	DumpStatement DumpRecordKind = iota
+	// DumpRow is a single (...) tuple of an INSERT ... VALUES statement
+	DumpRow
+)
+
+// DumpInsert is the header of an INSERT ... VALUES statement in a data dump
+type DumpInsert struct {
+	// Header is the statement source up to and including the VALUES keyword
+	Header string
+	// Table is the (possibly quoted and schema-qualified) table name
+	Table string
+	// Columns are the unquoted column names; empty when the statement doesn't list columns
+	Columns []string
+	Line    int
+}
+
+// DumpRecord is a single statement or row parsed from a data dump, in file order
+type DumpRecord struct {
+	Kind DumpRecordKind
+	// Sql is the record's source text; for rows this is the tuple including its parentheses
+	Sql string
+	// Line is the 1-based line number the record starts on
+	Line int
+	// Insert is the statement a row belongs to; nil for statements
+	Insert *DumpInsert
+	// Values are the parsed values of a row; nil for statements
+	Values []Literal
+}
+
+// DataDump is a parsed 6_InsertData_*.sql file
+type DataDump struct {
+	Name    string
+	Records []DumpRecord
+}
+
+// RowCount returns the number of rows in the dump
+func (this *DataDump) RowCount() (count int) {
+	for i := range this.Records {
+		if this.Records[i].Kind == DumpRow {
+			count++
+		}
+	}
+	return count
+}
+
+// Inserts returns the INSERT statements in the dump, in file order
+func (this *DataDump) Inserts() (inserts []*DumpInsert) {
+	for i := range this.Records {
+		if this.Records[i].Kind != DumpRow {
+			continue
+		}
+		if len(inserts) == 0 || inserts[len(inserts)-1] != this.Records[i].Insert {
+			inserts = append(inserts, this.Records[i].Insert)
+		}
+	}
+	return inserts
+}
+
+// Batches re-batches the dump on row boundaries.  Consecutive rows of the same INSERT statement are grouped into
+// batches of at most batchSize rows under a copy of the statement's header; every other statement is its own batch.
+//
+// Unless the dump sets IDENTITY_INSERT itself, the batches of each INSERT statement with a column list are wrapped in
+// identityInsertSqlFmt batches, so explicit values can be inserted into identity columns; IDENTITY_INSERT is only
+// turned on when the list names the table's identity column.  Statements without a column list are left as is, since
+// SQL Server requires one whenever IDENTITY_INSERT is on
+func (this *DataDump) Batches(batchSize int) (batches []Batch) {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	isIdentityManaged := false
+	for i := range this.Records {
+		if this.Records[i].Kind == DumpStatement && identityInsertRegex.MatchString(this.Records[i].Sql) {
+			isIdentityManaged = true
+			break
+		}
+	}
+
+	var rows []string
+	var insert *DumpInsert
+	// identityInsert is the insert whose table has IDENTITY_INSERT turned on
+	var identityInsert *DumpInsert
+	line := 0
+	flush := func() {
+		if len(rows) == 0 {
+			return
+		}
+		batches = append(batches, Batch{
+			Sql:    insert.Header + "\n" + strings.Join(rows, ",\n"),
+			Line:   line,
+			Repeat: 1,
+			Rows:   len(rows),
+		})
+		rows = nil
+	}
+	setIdentityInsert := func(target *DumpInsert, state string) {
+		columns := make([]string, len(target.Columns))
+		for i, column := range target.Columns {
+			columns[i] = "N'" + strings.ReplaceAll(column, "'", "''") + "'"
+		}
+		table := strings.ReplaceAll(target.Table, "'", "''")
+		sql := fmt.Sprintf(identityInsertSqlFmt, table, strings.Join(columns, ", "), target.Table, state)
+		batches = append(batches, Batch{Sql: sql, Line: target.Line, Repeat: 1})
+	}
+	endInsert := func() {
+		flush()
+		if identityInsert != nil {
+			setIdentityInsert(identityInsert, "OFF")
+			identityInsert = nil
+		}
+	}
+
+	for i := range this.Records {
+		record := this.Records[i]
+		if record.Kind == DumpStatement {
+			endInsert()
+			batches = append(batches, Batch{Sql: record.Sql, Line: record.Line, Repeat: 1})
+			continue
+		}
+
+		if record.Insert != insert {
+			endInsert()
+			insert = record.Insert
+			if !isIdentityManaged && len(insert.Columns) > 0 {
+				setIdentityInsert(insert, "ON")
+				identityInsert = insert
+			}
+		} else if len(rows) == batchSize {
+			flush()
+		}
+		if len(rows) == 0 {
+			line = record.Line
+		}
+		rows = append(rows, record.Sql)
+	}
+	endInsert()
+
+	return batches
+}
+
+// dumpParser is a cursor over a data dump's source
+type dumpParser struct {
+	name string
+	sql  string
+	pos  int
+	line int
+}
+
+// ParseDataDump parses a data dump into its statements and rows.  A dump may contain any number of INSERT ... VALUES
+// statements whose tuples may span lines (multi-line string values), other statements such as SET IDENTITY_INSERT,
+// comments, and GO separators.  Both LF and CRLF line endings are accepted.  Errors are reported as name:line
+func ParseDataDump(name string, sql string) (dump *DataDump, err error) {
+	p := &dumpParser{name: name, sql: sql, line: 1}
+	dump = &DataDump{Name: name}
+
+	for {
+		err = p.skipTrivia(true)
+		if err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.sql) {
+			break
+		}
+
+		if p.peekKeyword("INSERT") {
+			err = p.parseInsert(dump)
+		} else if p.sql[p.pos] == '(' {
+			err = p.errorf(p.line, "row outside of an INSERT statement; is the previous row missing a ','?")
+		} else {
+			err = p.parseStatement(dump)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return dump, nil
+}
+
+// errorf formats a parse error at the given line
+func (this *dumpParser) errorf(line int, format string, args ...any) error {
+	return fmt.Errorf("%s:%d: %s", this.name, line, fmt.Sprintf(format, args...))
+}
+
+// advance moves the cursor forward n bytes, tracking line numbers
+func (this *dumpParser) advance(n int) {
+	for i := 0; i < n && this.pos < len(this.sql); i++ {
+		if this.sql[this.pos] == '\n' {
+			this.line++
+		}
+		this.pos++
+	}
+}
+
+// skipTrivia skips whitespace and comments.  When isStatementStart is true, GO separator lines are skipped too
+func (this *dumpParser) skipTrivia(isStatementStart bool) error {
+	for this.pos < len(this.sql) {
+		c := this.sql[this.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			this.advance(1)
+		case strings.HasPrefix(this.sql[this.pos:], "--"):
+			end := strings.IndexByte(this.sql[this.pos:], '\n')
+			if end < 0 {
+				end = len(this.sql) - this.pos
+			}
+			this.advance(end)
+		case strings.HasPrefix(this.sql[this.pos:], "/*"):
+			start := this.line
+			depth := 0
+			for {
+				if this.pos >= len(this.sql) {
+					return this.errorf(start, "unterminated block comment")
+				}
+				if strings.HasPrefix(this.sql[this.pos:], "/*") {
+					depth++
+					this.advance(2)
+				} else if strings.HasPrefix(this.sql[this.pos:], "*/") {
+					depth--
+					this.advance(2)
+					if depth == 0 {
+						break
+					}
+				} else {
+					this.advance(1)
+				}
+			}
+		case isStatementStart && this.isGoLine():
+			end := strings.IndexByte(this.sql[this.pos:], '\n')
+			if end < 0 {
+				end = len(this.sql) - this.pos
+			}
+			this.advance(end)
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// isGoLine checks if the remainder of the current line is a GO separator
+func (this *dumpParser) isGoLine() bool {
+	end := strings.IndexByte(this.sql[this.pos:], '\n')
+	if end < 0 {
+		end = len(this.sql) - this.pos
+	}
+	_, isGo, _ := parseGoLine(this.sql[this.pos : this.pos+end])
+	return isGo
+}
+
+// peekKeyword checks if the cursor is at the given keyword (case-insensitive, whole word)
+func (this *dumpParser) peekKeyword(keyword string) bool {
+	end := this.pos + len(keyword)
+	if end > len(this.sql) || !strings.EqualFold(this.sql[this.pos:end], keyword) {
+		return false
+	}
+	return end == len(this.sql) || !isWordByte(this.sql[end])
+}
+
+// parseStatement reads a non-INSERT statement.  Statements may span lines; one ends at a ';', a GO line, or a line
+// starting with one of the statementKeywords outside of parentheses
+func (this *dumpParser) parseStatement(dump *DataDump) error {
+	start, line := this.pos, this.line
+	end := this.pos
+	// an UPDATE's own SET clause may start a line
+	isUpdate := this.peekKeyword("UPDATE")
+	isUpdateSet := false
+	depth := 0
+	for this.pos < len(this.sql) && this.sql[this.pos] != ';' {
+		c := this.sql[this.pos]
+		switch {
+		case c == '\'' || c == '[' || c == '"':
+			_, err := this.readQuoted()
+			if err != nil {
+				return err
+			}
+		case c == '(':
+			depth++
+			this.advance(1)
+		case c == ')':
+			depth--
+			this.advance(1)
+		case isWordByte(c):
+			wordStart := this.pos
+			for this.pos < len(this.sql) && isWordByte(this.sql[this.pos]) {
+				this.advance(1)
+			}
+			if isUpdate && depth == 0 && strings.EqualFold(this.sql[wordStart:this.pos], "SET") {
+				isUpdateSet = true
+			}
+		default:
+			this.advance(1)
+		}
+		end = this.pos
+
+		tokenLine := this.line
+		err := this.skipTrivia(false)
+		if err != nil {
+			return err
+		}
+		if this.line != tokenLine && depth == 0 && this.pos < len(this.sql) && (this.isGoLine() || this.isStatementKeyword(isUpdate && !isUpdateSet)) {
+			break
+		}
+	}
+
+	dump.Records = append(dump.Records, DumpRecord{
+		Kind: DumpStatement,
+		Sql:  strings.TrimSpace(this.sql[start:end]),
+		Line: line,
+	})
+	if this.pos < len(this.sql) && this.sql[this.pos] == ';' {
+		this.advance(1)
+	}
+	return nil
+}
+
+// isStatementKeyword checks if the cursor is at one of the statementKeywords; isSetClause is true when a SET would
+// continue the current UPDATE statement instead
+func (this *dumpParser) isStatementKeyword(isSetClause bool) bool {
+	for _, keyword := range statementKeywords {
+		if this.peekKeyword(keyword) {
+			return keyword != "SET" || !isSetClause
+		}
+	}
+	return false
+}
+
+// parseInsert reads an INSERT ... VALUES header and all of its tuples
+func (this *dumpParser) parseInsert(dump *DataDump) error {
+	start, line := this.pos, this.line
+
+	// read up to and including the VALUES keyword
+	for {
+		if this.pos >= len(this.sql) {
+			return this.errorf(line, "INSERT statement is missing VALUES")
+		}
+		c := this.sql[this.pos]
+		if c == '\'' || c == '[' || c == '"' {
+			_, err := this.readQuoted()
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if this.peekKeyword("VALUES") && (this.pos == 0 || !isWordByte(this.sql[this.pos-1])) {
+			this.advance(len("VALUES"))
+			break
+		}
+		this.advance(1)
+	}
+
+	header := strings.Join(strings.Fields(this.sql[start:this.pos]), " ")
+	match := insertHeaderRegex.FindStringSubmatch(header)
+	if match == nil {
+		return this.errorf(line, "unrecognized INSERT header: %s", header)
+	}
+	insert := &DumpInsert{
+		Header: header,
+		Table:  match[1],
+		Line:   line,
+	}
+	if strings.TrimSpace(match[2]) != "" {
+		for _, column := range strings.Split(match[2], ",") {
+			insert.Columns = append(insert.Columns, UnquoteIdentifier(strings.TrimSpace(column)))
+		}
+	}
+
+	for {
+		err := this.skipTrivia(false)
+		if err != nil {
+			return err
+		}
+		if this.pos >= len(this.sql) || this.sql[this.pos] != '(' {
+			return this.errorf(this.line, "expected a (...) row")
+		}
+
+		rowStart, rowLine := this.pos, this.line
+		values, err := this.parseTuple()
+		if err != nil {
+			return err
+		}
+		if len(insert.Columns) > 0 && len(values) != len(insert.Columns) {
+			return this.errorf(rowLine, "row has %d values, expected %d", len(values), len(insert.Columns))
+		}
+		dump.Records = append(dump.Records, DumpRecord{
+			Kind:   DumpRow,
+			Sql:    this.sql[rowStart:this.pos],
+			Line:   rowLine,
+			Insert: insert,
+			Values: values,
+		})
+
+		// a ',' continues the statement; a trailing ',' after the last row is tolerated
+		err = this.skipTrivia(false)
+		if err != nil {
+			return err
+		}
+		if this.pos < len(this.sql) && this.sql[this.pos] == ',' {
+			this.advance(1)
+			err = this.skipTrivia(false)
+			if err != nil {
+				return err
+			}
+			if this.pos < len(this.sql) && this.sql[this.pos] == '(' {
+				continue
+			}
+			if this.pos < len(this.sql) && this.sql[this.pos] == ';' {
+				this.advance(1)
+			}
+			return nil
+		}
+		if this.pos < len(this.sql) && this.sql[this.pos] == ';' {
+			this.advance(1)
+		}
+		return nil
+	}
+}
+
+// parseTuple reads a (v1, v2, ...) tuple starting at the opening parenthesis
+func (this *dumpParser) parseTuple() (values []Literal, err error) {
+	line := this.line
+	this.advance(1)
+
+	for {
+		err = this.skipTrivia(false)
+		if err != nil {
+			return nil, err
+		}
+		if this.pos >= len(this.sql) {
+			return nil, this.errorf(line, "unterminated row")
+		}
+
+		value, err := this.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+
+		err = this.skipTrivia(false)
+		if err != nil {
+			return nil, err
+		}
+		if this.pos >= len(this.sql) {
+			return nil, this.errorf(line, "unterminated row")
+		}
+		switch this.sql[this.pos] {
+		case ',':
+			this.advance(1)
+		case ')':
+			this.advance(1)
+			return values, nil
+		default:
+			return nil, this.errorf(this.line, "unexpected %q in row, expected ',' or ')'", this.sql[this.pos])
+		}
+	}
+}
+
+// parseValue reads a single literal or expression value
+func (this *dumpParser) parseValue() (value Literal, err error) {
+	c := this.sql[this.pos]
+	switch {
+	case c == '\'' || ((c == 'N' || c == 'n') && this.pos+1 < len(this.sql) && this.sql[this.pos+1] == '\''):
+		if c != '\'' {
+			this.advance(1)
+		}
+		text, err := this.readQuoted()
+		if err != nil {
+			return value, err
+		}
+		return Literal{Kind: StringLiteral, Text: text}, nil
+	case c == '0' && this.pos+1 < len(this.sql) && (this.sql[this.pos+1] == 'x' || this.sql[this.pos+1] == 'X'):
+		this.advance(2)
+		start := this.pos
+		for this.pos < len(this.sql) && isHexByte(this.sql[this.pos]) {
+			this.advance(1)
+		}
+		return Literal{Kind: BinaryLiteral, Text: this.sql[start:this.pos]}, nil
+	case c == '-' || c == '+' || c == '.' || (c >= '0' && c <= '9'):
+		start := this.pos
+		this.advance(1)
+		for this.pos < len(this.sql) && isNumberByte(this.sql[this.pos]) {
+			this.advance(1)
+		}
+		return Literal{Kind: NumberLiteral, Text: this.sql[start:this.pos]}, nil
+	case this.peekKeyword("NULL"):
+		this.advance(len("NULL"))
+		return Literal{Kind: NullLiteral}, nil
+	case isWordByte(c):
+		// an expression such as CAST(N'...' AS DateTime); read to the matching ')' at depth 0
+		start, line := this.pos, this.line
+		depth := 0
+		for this.pos < len(this.sql) {
+			c = this.sql[this.pos]
+			if c == '\'' || c == '[' || c == '"' {
+				_, err = this.readQuoted()
+				if err != nil {
+					return value, err
+				}
+				continue
+			}
+			if depth == 0 && (c == ',' || c == ')') {
+				break
+			}
+			if c == '(' {
+				depth++
+			} else if c == ')' {
+				depth--
+			}
+			this.advance(1)
+		}
+		if depth != 0 {
+			return value, this.errorf(line, "unterminated expression")
+		}
+		return Literal{Kind: ExprLiteral, Text: strings.TrimSpace(this.sql[start:this.pos])}, nil
+	}
+
+	return value, this.errorf(this.line, "unexpected %q, expected a value", c)
+}
+
+// readQuoted reads a single-quoted string, [bracketed] identifier, or "double-quoted" identifier starting at the
+// opening quote and returns its unescaped contents
+func (this *dumpParser) readQuoted() (text string, err error) {
+	open := this.sql[this.pos]
+	closing := open
+	if open == '[' {
+		closing = ']'
+	}
+	line := this.line
+	this.advance(1)
+
+	sb := strings.Builder{}
+	for this.pos < len(this.sql) {
+		c := this.sql[this.pos]
+		if c == closing {
+			if this.pos+1 < len(this.sql) && this.sql[this.pos+1] == closing {
+				sb.WriteByte(c)
+				this.advance(2)
+				continue
+			}
+			this.advance(1)
+			return sb.String(), nil
+		}
+		sb.WriteByte(c)
+		this.advance(1)
+	}
+
+	if open == '\'' {
+		return "", this.errorf(line, "unterminated string literal")
+	}
+	return "", this.errorf(line, "unterminated quoted identifier")
+}
+
+// UnquoteIdentifier removes [] or "" quoting from an identifier
+func UnquoteIdentifier(name string) string {
+	if len(name) >= 2 && ((name[0] == '[' && name[len(name)-1] == ']') || (name[0] == '"' && name[len(name)-1] == '"')) {
+		return name[1 : len(name)-1]
+	}
+	return name
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '@' || c == '#' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func isHexByte(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func isNumberByte(c byte) bool {
+	return (c >= '0' && c <= '9') || c == '.' || c == 'e' || c == 'E' || c == '-' || c == '+'
+}
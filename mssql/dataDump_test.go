@@ -0,0 +1,283 @@
+package mssql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDataDump(t *testing.T) {
+	sql := "SET IDENTITY_INSERT [dbo].[ITEM] ON\r\n" +
+		"INSERT INTO [dbo].[ITEM] ([Num], [strName], [Data]) VALUES\r\n" +
+		"(1, N'Sword', 0x0A0B),\r\n" +
+		"(-2, 'multi\r\nline ''quoted''', NULL),\r\n" +
+		"(3, CAST(N'2024-01-02' AS DateTime), 0x)\r\n" +
+		"SET IDENTITY_INSERT [dbo].[ITEM] OFF;\r\n" +
+		"-- second statement\r\n" +
+		"INSERT [dbo].[ZONE] VALUES\r\n" +
+		"(1.5e2),\r\n"
+
+	dump, err := ParseDataDump("6_InsertData_ITEM.sql", sql)
+	if err != nil {
+		t.Fatalf("ParseDataDump() error = %v", err)
+	}
+
+	if got := dump.RowCount(); got != 4 {
+		t.Errorf("RowCount() = %d, want 4", got)
+	}
+
+	inserts := dump.Inserts()
+	if len(inserts) != 2 {
+		t.Fatalf("Inserts() returned %d inserts, want 2", len(inserts))
+	}
+	if inserts[0].Table != "[dbo].[ITEM]" || !reflect.DeepEqual(inserts[0].Columns, []string{"Num", "strName", "Data"}) || inserts[0].Line != 2 {
+		t.Errorf("Inserts()[0] = %+v", inserts[0])
+	}
+	if inserts[1].Table != "[dbo].[ZONE]" || inserts[1].Columns != nil || inserts[1].Line != 9 {
+		t.Errorf("Inserts()[1] = %+v", inserts[1])
+	}
+
+	wantKinds := []DumpRecordKind{DumpStatement, DumpRow, DumpRow, DumpRow, DumpStatement, DumpRow}
+	wantLines := []int{1, 3, 4, 6, 7, 10}
+	if len(dump.Records) != len(wantKinds) {
+		t.Fatalf("parsed %d records, want %d", len(dump.Records), len(wantKinds))
+	}
+	for i := range dump.Records {
+		if dump.Records[i].Kind != wantKinds[i] || dump.Records[i].Line != wantLines[i] {
+			t.Errorf("record %d = kind %d line %d, want kind %d line %d", i, dump.Records[i].Kind, dump.Records[i].Line, wantKinds[i], wantLines[i])
+		}
+	}
+
+	if got := dump.Records[4].Sql; got != "SET IDENTITY_INSERT [dbo].[ITEM] OFF" {
+		t.Errorf("statement Sql = %q", got)
+	}
+
+	wantValues := [][]Literal{
+		{{NumberLiteral, "1"}, {StringLiteral, "Sword"}, {BinaryLiteral, "0A0B"}},
+		{{NumberLiteral, "-2"}, {StringLiteral, "multi\r\nline 'quoted'"}, {NullLiteral, ""}},
+		{{NumberLiteral, "3"}, {ExprLiteral, "CAST(N'2024-01-02' AS DateTime)"}, {BinaryLiteral, ""}},
+	}
+	for i := range wantValues {
+		if !reflect.DeepEqual(dump.Records[i+1].Values, wantValues[i]) {
+			t.Errorf("row %d values = %#v, want %#v", i, dump.Records[i+1].Values, wantValues[i])
+		}
+	}
+	if got := dump.Records[2].Sql; got != "(-2, 'multi\r\nline ''quoted''', NULL)" {
+		t.Errorf("row Sql = %q", got)
+	}
+}
+
+func TestParseDataDumpErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		sql     string
+		wantErr string
+	}{
+		{
+			name:    "missing comma between rows",
+			sql:     "INSERT INTO T VALUES\n(1)\n(2)\n",
+			wantErr: "f.sql:3: row outside of an INSERT statement; is the previous row missing a ','?",
+		},
+		{
+			name:    "unterminated string",
+			sql:     "INSERT INTO T VALUES\n(1),\n('abc),\n(3)\n",
+			wantErr: "f.sql:3: unterminated string literal",
+		},
+		{
+			name:    "unterminated row",
+			sql:     "INSERT INTO T VALUES\n(1, 2",
+			wantErr: "f.sql:2: unterminated row",
+		},
+		{
+			name:    "column count mismatch",
+			sql:     "INSERT INTO T ([a], [b]) VALUES\n(1, 2),\n(3)\n",
+			wantErr: "f.sql:3: row has 1 values, expected 2",
+		},
+		{
+			name:    "missing VALUES",
+			sql:     "INSERT INTO T ([a])\n",
+			wantErr: "f.sql:1: INSERT statement is missing VALUES",
+		},
+		{
+			name:    "garbage in row",
+			sql:     "INSERT INTO T VALUES\n(1 2)\n",
+			wantErr: "f.sql:2: unexpected '2' in row, expected ',' or ')'",
+		},
+		{
+			name:    "no rows",
+			sql:     "INSERT INTO T VALUES\n",
+			wantErr: "f.sql:2: expected a (...) row",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseDataDump("f.sql", tt.sql)
+			if err == nil {
+				t.Fatalf("ParseDataDump() expected error %q", tt.wantErr)
+			}
+			if err.Error() != tt.wantErr {
+				t.Errorf("ParseDataDump() error = %q, want %q", err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDataDumpBatches(t *testing.T) {
+	sql := "SET IDENTITY_INSERT T ON\n" +
+		"INSERT INTO T VALUES\n(1),\n(2),\n(3),\n" +
+		"INSERT INTO U VALUES\n(4),\n(5)\n" +
+		"SET IDENTITY_INSERT T OFF\n"
+	dump, err := ParseDataDump("f.sql", sql)
+	if err != nil {
+		t.Fatalf("ParseDataDump() error = %v", err)
+	}
+
+	want := []Batch{
+		{Sql: "SET IDENTITY_INSERT T ON", Line: 1, Repeat: 1},
+		{Sql: "INSERT INTO T VALUES\n(1),\n(2)", Line: 3, Repeat: 1, Rows: 2},
+		{Sql: "INSERT INTO T VALUES\n(3)", Line: 5, Repeat: 1, Rows: 1},
+		{Sql: "INSERT INTO U VALUES\n(4),\n(5)", Line: 7, Repeat: 1, Rows: 2},
+		{Sql: "SET IDENTITY_INSERT T OFF", Line: 9, Repeat: 1},
+	}
+	if got := dump.Batches(2); !reflect.DeepEqual(got, want) {
+		t.Errorf("Batches() = %#v, want %#v", got, want)
+	}
+}
+
+func TestParseDataDumpStatements(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want []DumpRecord
+	}{
+		{
+			name: "statements end at a new line's statement keyword",
+			sql:  "SET IDENTITY_INSERT T ON\nSET NOCOUNT ON\nINSERT INTO T VALUES\n(1)\n",
+			want: []DumpRecord{
+				{Kind: DumpStatement, Sql: "SET IDENTITY_INSERT T ON", Line: 1},
+				{Kind: DumpStatement, Sql: "SET NOCOUNT ON", Line: 2},
+				{Kind: DumpRow, Sql: "(1)", Line: 4},
+			},
+		},
+		{
+			name: "multi-line statements",
+			sql: "DELETE FROM T\r\nWHERE Num IN\r\n  (SELECT Num\r\n   FROM U\r\n   UPDATE_LOG)\r\n" +
+				"UPDATE T\r\nSET strName = 'a\r\nb'\r\nWHERE Num = 1\r\n" +
+				"SET IDENTITY_INSERT T OFF\r\n",
+			want: []DumpRecord{
+				{Kind: DumpStatement, Sql: "DELETE FROM T\r\nWHERE Num IN\r\n  (SELECT Num\r\n   FROM U\r\n   UPDATE_LOG)", Line: 1},
+				{Kind: DumpStatement, Sql: "UPDATE T\r\nSET strName = 'a\r\nb'\r\nWHERE Num = 1", Line: 6},
+				{Kind: DumpStatement, Sql: "SET IDENTITY_INSERT T OFF", Line: 10},
+			},
+		},
+		{
+			name: "statements end at ';' and GO",
+			sql:  "UPDATE T SET a = 1\n  WHERE b = 2; DELETE FROM T\nWHERE c = 3 -- trailing comment\nGO\nTRUNCATE TABLE U\n",
+			want: []DumpRecord{
+				{Kind: DumpStatement, Sql: "UPDATE T SET a = 1\n  WHERE b = 2", Line: 1},
+				{Kind: DumpStatement, Sql: "DELETE FROM T\nWHERE c = 3", Line: 2},
+				{Kind: DumpStatement, Sql: "TRUNCATE TABLE U", Line: 5},
+			},
+		},
+		{
+			name: "keywords in strings, brackets, and comments don't end a statement",
+			sql:  "UPDATE T\nSET a = '\nINSERT'\n  , [\nDELETE] = 1\n/*\nSET */ WHERE b = 2\n",
+			want: []DumpRecord{
+				{Kind: DumpStatement, Sql: "UPDATE T\nSET a = '\nINSERT'\n  , [\nDELETE] = 1\n/*\nSET */ WHERE b = 2", Line: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dump, err := ParseDataDump("f.sql", tt.sql)
+			if err != nil {
+				t.Fatalf("ParseDataDump() error = %v", err)
+			}
+			if len(dump.Records) != len(tt.want) {
+				t.Fatalf("ParseDataDump() parsed %d records %+v, want %d", len(dump.Records), dump.Records, len(tt.want))
+			}
+			for i := range tt.want {
+				got := dump.Records[i]
+				if got.Kind != tt.want[i].Kind || got.Sql != tt.want[i].Sql || got.Line != tt.want[i].Line {
+					t.Errorf("record %d = kind %d line %d %q, want kind %d line %d %q", i, got.Kind, got.Line, got.Sql, tt.want[i].Kind, tt.want[i].Line, tt.want[i].Sql)
+				}
+			}
+		})
+	}
+}
+
+func TestDataDumpBatchesIdentityInsert(t *testing.T) {
+	sql := "INSERT INTO [dbo].[ITEM] ([Num], [strName]) VALUES\n(1, 'a'),\n(2, 'b'),\n(3, 'c')\n" +
+		"DELETE FROM [dbo].[ZONE]\n" +
+		"INSERT INTO [dbo].[ZONE] ([Num]) VALUES\n(4)\n"
+	dump, err := ParseDataDump("f.sql", sql)
+	if err != nil {
+		t.Fatalf("ParseDataDump() error = %v", err)
+	}
+
+	// the dump doesn't set IDENTITY_INSERT, so each statement's rows are wrapped
+	itemIdentitySql := "IF EXISTS (SELECT 1 FROM sys.identity_columns WHERE object_id = OBJECT_ID(N'[dbo].[ITEM]') AND name IN (N'Num', N'strName')) SET IDENTITY_INSERT [dbo].[ITEM] "
+	zoneIdentitySql := "IF EXISTS (SELECT 1 FROM sys.identity_columns WHERE object_id = OBJECT_ID(N'[dbo].[ZONE]') AND name IN (N'Num')) SET IDENTITY_INSERT [dbo].[ZONE] "
+	want := []Batch{
+		{Sql: itemIdentitySql + "ON", Line: 1, Repeat: 1},
+		{Sql: "INSERT INTO [dbo].[ITEM] ([Num], [strName]) VALUES\n(1, 'a'),\n(2, 'b')", Line: 2, Repeat: 1, Rows: 2},
+		{Sql: "INSERT INTO [dbo].[ITEM] ([Num], [strName]) VALUES\n(3, 'c')", Line: 4, Repeat: 1, Rows: 1},
+		{Sql: itemIdentitySql + "OFF", Line: 1, Repeat: 1},
+		{Sql: "DELETE FROM [dbo].[ZONE]", Line: 5, Repeat: 1},
+		{Sql: zoneIdentitySql + "ON", Line: 6, Repeat: 1},
+		{Sql: "INSERT INTO [dbo].[ZONE] ([Num]) VALUES\n(4)", Line: 7, Repeat: 1, Rows: 1},
+		{Sql: zoneIdentitySql + "OFF", Line: 6, Repeat: 1},
+	}
+	if got := dump.Batches(2); !reflect.DeepEqual(got, want) {
+		t.Errorf("Batches() = %#v, want %#v", got, want)
+	}
+}
+
+func TestDataDumpBatchesIdentityInsertColumns(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want []Batch
+	}{
+		{
+			// SQL Server rejects IDENTITY_INSERT ON for an insert without a column list, so it's left off
+			name: "no column list",
+			sql:  "INSERT INTO [dbo].[ITEM] VALUES\n(1, 'a')\n",
+			want: []Batch{
+				{Sql: "INSERT INTO [dbo].[ITEM] VALUES\n(1, 'a')", Line: 2, Repeat: 1, Rows: 1},
+			},
+		},
+		{
+			// the identity column is generated, so only the listed columns are checked
+			name: "column list without the identity column",
+			sql:  "INSERT INTO [dbo].[ITEM] ([strName], [it's]) VALUES\n('a', 1)\n",
+			want: []Batch{
+				{Sql: "IF EXISTS (SELECT 1 FROM sys.identity_columns WHERE object_id = OBJECT_ID(N'[dbo].[ITEM]') AND name IN (N'strName', N'it''s')) SET IDENTITY_INSERT [dbo].[ITEM] ON", Line: 1, Repeat: 1},
+				{Sql: "INSERT INTO [dbo].[ITEM] ([strName], [it's]) VALUES\n('a', 1)", Line: 2, Repeat: 1, Rows: 1},
+				{Sql: "IF EXISTS (SELECT 1 FROM sys.identity_columns WHERE object_id = OBJECT_ID(N'[dbo].[ITEM]') AND name IN (N'strName', N'it''s')) SET IDENTITY_INSERT [dbo].[ITEM] OFF", Line: 1, Repeat: 1},
+			},
+		},
+		{
+			// the dump manages IDENTITY_INSERT itself, so its statements are passed through
+			name: "identity managed by the dump",
+			sql:  "SET IDENTITY_INSERT [dbo].[ITEM] ON\nINSERT INTO [dbo].[ITEM] ([Num]) VALUES\n(1)\nSET IDENTITY_INSERT [dbo].[ITEM] OFF\n",
+			want: []Batch{
+				{Sql: "SET IDENTITY_INSERT [dbo].[ITEM] ON", Line: 1, Repeat: 1},
+				{Sql: "INSERT INTO [dbo].[ITEM] ([Num]) VALUES\n(1)", Line: 3, Repeat: 1, Rows: 1},
+				{Sql: "SET IDENTITY_INSERT [dbo].[ITEM] OFF", Line: 4, Repeat: 1},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dump, err := ParseDataDump("f.sql", test.sql)
+			if err != nil {
+				t.Fatalf("ParseDataDump() error = %v", err)
+			}
+			if got := dump.Batches(10); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Batches() = %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,293 @@
+package mssql
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// createTableRegex finds CREATE TABLE statements and captures the table name
+	createTableRegex = regexp.MustCompile(`(?i)\bCREATE\s+TABLE\s+((?:\[[^\]]+\]|"[^"]+"|\w+)(?:\s*\.\s*(?:\[[^\]]+\]|"[^"]+"|\w+))*)\s*\(`)
+
+	// tableConstraintRegex matches table elements that aren't column definitions
+	tableConstraintRegex = regexp.MustCompile(`(?i)^(CONSTRAINT|PRIMARY\s+KEY|UNIQUE|FOREIGN\s+KEY|CHECK|INDEX|PERIOD\s+FOR)\b`)
+
+	// columnRegex captures a column definition's name, type, and type arguments
+	columnRegex = regexp.MustCompile(`(?is)^(\[[^\]]+\]|"[^"]+"|\w+)\s+(?:(\[[^\]]+\]|\w+)(?:\.(\[[^\]]+\]|\w+))?)\s*(?:\(\s*([^)]*)\))?(.*)$`)
+)
+
+// ColumnDef is a column parsed from a CREATE TABLE statement or read from INFORMATION_SCHEMA
+type ColumnDef struct {
+	Name string
+	// Type is the normalized type, e.g. int, varchar(50), nvarchar(max), decimal(10,2)
+	Type       string
+	IsNullable bool
+}
+
+// TableDef is a table parsed from a CREATE TABLE statement or read from INFORMATION_SCHEMA
+type TableDef struct {
+	Schema  string
+	Name    string
+	Columns []ColumnDef
+}
+
+// FullName returns the table's schema-qualified name
+func (this TableDef) FullName() string {
+	return this.Schema + "." + this.Name
+}
+
+// ParseCreateTables returns the column definitions of every CREATE TABLE statement in a script.  Table constraints
+// and indexes are ignored; computed columns are reported with the type "computed".  Tables without a schema are
+// placed in dbo.
+func ParseCreateTables(sql string) (tables []TableDef, err error) {
+	sql = StripComments(sql)
+
+	for _, loc := range createTableRegex.FindAllStringSubmatchIndex(sql, -1) {
+		table := TableDef{Schema: "dbo"}
+		parts := splitQualifiedName(sql[loc[2]:loc[3]])
+		table.Name = parts[len(parts)-1]
+		if len(parts) > 1 {
+			table.Schema = parts[len(parts)-2]
+		}
+
+		// loc[1] is just past the opening parenthesis of the element list
+		body, ok := readParenthesized(sql, loc[1]-1)
+		if !ok {
+			return nil, fmt.Errorf("table %s: unterminated column list", table.FullName())
+		}
+
+		for _, element := range splitTopLevel(body, ',') {
+			element = strings.TrimSpace(element)
+			if element == "" || tableConstraintRegex.MatchString(element) {
+				continue
+			}
+
+			column, err := parseColumnDef(element)
+			if err != nil {
+				return nil, fmt.Errorf("table %s: %v", table.FullName(), err)
+			}
+			table.Columns = append(table.Columns, column)
+		}
+		tables = append(tables, table)
+	}
+
+	return tables, nil
+}
+
+// parseColumnDef parses a single column definition of a CREATE TABLE element list
+func parseColumnDef(element string) (column ColumnDef, err error) {
+	match := columnRegex.FindStringSubmatch(element)
+	if match == nil {
+		return column, fmt.Errorf("unrecognized column definition: %s", element)
+	}
+
+	column.Name = UnquoteIdentifier(match[1])
+	typeName := UnquoteIdentifier(match[2])
+	if match[3] != "" {
+		// schema-qualified type, e.g. [sys].[varchar]
+		typeName = UnquoteIdentifier(match[3])
+	}
+
+	if strings.EqualFold(typeName, "AS") {
+		column.Type = "computed"
+		column.IsNullable = true
+		return column, nil
+	}
+
+	column.Type = NormalizeType(typeName, match[4])
+	rest := strings.ToUpper(strings.Join(strings.Fields(match[5]), " "))
+	column.IsNullable = !strings.Contains(rest, "NOT NULL") && !strings.Contains(rest, "PRIMARY KEY")
+	return column, nil
+}
+
+// NormalizeType formats a type name and its arguments the same way regardless of source; arguments are only kept
+// for the types where they're significant (character, binary, and exact numeric types)
+func NormalizeType(typeName string, args string) string {
+	typeName = strings.ToLower(strings.TrimSpace(typeName))
+	args = strings.ToLower(strings.Join(strings.Fields(args), ""))
+
+	switch typeName {
+	case "char", "varchar", "nchar", "nvarchar", "binary", "varbinary":
+		if args == "-1" {
+			args = "max"
+		}
+		if args == "" {
+			args = "1"
+		}
+		return fmt.Sprintf("%s(%s)", typeName, args)
+	case "decimal", "numeric":
+		if args == "" {
+			args = "18,0"
+		}
+		if !strings.Contains(args, ",") {
+			args += ",0"
+		}
+		return fmt.Sprintf("%s(%s)", typeName, args)
+	}
+
+	return typeName
+}
+
+// NormalizeSql removes comments, collapses whitespace, and lower-cases everything outside of string literals and
+// quoted identifiers so two definitions of the same object can be compared.  CREATE OR ALTER/ALTER are normalized to
+// CREATE and PROC to PROCEDURE
+func NormalizeSql(sql string) string {
+	sql = StripComments(sql)
+
+	sb := strings.Builder{}
+	isSpace := false
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		if c == '\'' || c == '[' || c == '"' {
+			end := skipQuoted(sql, i)
+			if isSpace && sb.Len() > 0 {
+				sb.WriteByte(' ')
+			}
+			isSpace = false
+			sb.WriteString(sql[i:end])
+			i = end
+			continue
+		}
+		if c == ' ' || c == '\t' || c == '\r' || c == '\n' {
+			isSpace = true
+			i++
+			continue
+		}
+		if isSpace && sb.Len() > 0 {
+			sb.WriteByte(' ')
+		}
+		isSpace = false
+		if c >= 'A' && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		sb.WriteByte(c)
+		i++
+	}
+
+	normalized := sb.String()
+	for _, prefix := range []string{"create or alter ", "alter "} {
+		if strings.HasPrefix(normalized, prefix) {
+			normalized = "create " + strings.TrimPrefix(normalized, prefix)
+		}
+	}
+	if strings.HasPrefix(normalized, "create proc ") {
+		normalized = "create procedure " + strings.TrimPrefix(normalized, "create proc ")
+	}
+
+	return normalized
+}
+
+// StripComments removes -- and (nested) /* */ comments outside of string literals and quoted identifiers
+func StripComments(sql string) string {
+	sb := strings.Builder{}
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == '\'' || c == '[' || c == '"':
+			end := skipQuoted(sql, i)
+			sb.WriteString(sql[i:end])
+			i = end
+		case strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				i = len(sql)
+			} else {
+				i += end
+			}
+		case strings.HasPrefix(sql[i:], "/*"):
+			depth := 0
+			for i < len(sql) {
+				if strings.HasPrefix(sql[i:], "/*") {
+					depth++
+					i += 2
+				} else if strings.HasPrefix(sql[i:], "*/") {
+					depth--
+					i += 2
+					if depth == 0 {
+						break
+					}
+				} else {
+					i++
+				}
+			}
+			sb.WriteByte(' ')
+		default:
+			sb.WriteByte(c)
+			i++
+		}
+	}
+	return sb.String()
+}
+
+// skipQuoted returns the index just past the quoted token starting at start
+func skipQuoted(sql string, start int) int {
+	closing := sql[start]
+	if closing == '[' {
+		closing = ']'
+	}
+	for i := start + 1; i < len(sql); i++ {
+		if sql[i] == closing {
+			if i+1 < len(sql) && sql[i+1] == closing {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(sql)
+}
+
+// readParenthesized returns the contents of the parenthesized group opening at start
+func readParenthesized(sql string, start int) (body string, ok bool) {
+	depth := 0
+	for i := start; i < len(sql); {
+		c := sql[i]
+		if c == '\'' || c == '[' || c == '"' {
+			i = skipQuoted(sql, i)
+			continue
+		}
+		if c == '(' {
+			depth++
+		} else if c == ')' {
+			depth--
+			if depth == 0 {
+				return sql[start+1 : i], true
+			}
+		}
+		i++
+	}
+	return "", false
+}
+
+// splitTopLevel splits sql on sep wherever it's outside of parentheses and quotes
+func splitTopLevel(sql string, sep byte) (parts []string) {
+	depth := 0
+	start := 0
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		if c == '\'' || c == '[' || c == '"' {
+			i = skipQuoted(sql, i)
+			continue
+		}
+		switch {
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == sep && depth == 0:
+			parts = append(parts, sql[start:i])
+			start = i + 1
+		}
+		i++
+	}
+	return append(parts, sql[start:])
+}
+
+// splitQualifiedName splits a possibly quoted, dot-separated name into its unquoted parts
+func splitQualifiedName(name string) (parts []string) {
+	for _, part := range splitTopLevel(name, '.') {
+		parts = append(parts, UnquoteIdentifier(strings.TrimSpace(part)))
+	}
+	return parts
+}
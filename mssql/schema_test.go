@@ -0,0 +1,91 @@
+package mssql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCreateTables(t *testing.T) {
+	sql := "USE [KN_online]\nGO\n" +
+		"/* item table */\n" +
+		"CREATE TABLE [dbo].[ITEM](\n" +
+		"\t[Num] [int] IDENTITY(1,1) NOT NULL,\n" +
+		"\t[strName] [varchar](50) NULL, -- display name\n" +
+		"\t[strDesc] [nvarchar](max) NOT NULL,\n" +
+		"\t[Price] [decimal](10, 2) NULL,\n" +
+		"\t[Data] [varbinary](16) NULL,\n" +
+		"\t[Total] AS ([Price]*(2)),\n" +
+		" CONSTRAINT [PK_ITEM] PRIMARY KEY CLUSTERED ([Num] ASC)\n" +
+		") ON [PRIMARY]\nGO\n" +
+		"CREATE TABLE ZONE (id int PRIMARY KEY, name char)\n"
+
+	got, err := ParseCreateTables(sql)
+	if err != nil {
+		t.Fatalf("ParseCreateTables() error = %v", err)
+	}
+
+	want := []TableDef{
+		{Schema: "dbo", Name: "ITEM", Columns: []ColumnDef{
+			{Name: "Num", Type: "int", IsNullable: false},
+			{Name: "strName", Type: "varchar(50)", IsNullable: true},
+			{Name: "strDesc", Type: "nvarchar(max)", IsNullable: false},
+			{Name: "Price", Type: "decimal(10,2)", IsNullable: true},
+			{Name: "Data", Type: "varbinary(16)", IsNullable: true},
+			{Name: "Total", Type: "computed", IsNullable: true},
+		}},
+		{Schema: "dbo", Name: "ZONE", Columns: []ColumnDef{
+			{Name: "id", Type: "int", IsNullable: false},
+			{Name: "name", Type: "char(1)", IsNullable: true},
+		}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseCreateTables() = %+v, want %+v", got, want)
+	}
+}
+
+func TestNormalizeType(t *testing.T) {
+	tests := []struct {
+		typeName string
+		args     string
+		want     string
+	}{
+		{"INT", "", "int"},
+		{"varchar", "50", "varchar(50)"},
+		{"nvarchar", "-1", "nvarchar(max)"},
+		{"nvarchar", "MAX", "nvarchar(max)"},
+		{"decimal", "10, 2", "decimal(10,2)"},
+		{"numeric", "9", "numeric(9,0)"},
+		{"float", "53", "float"},
+		{"text", "2147483647", "text"},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeType(tt.typeName, tt.args); got != tt.want {
+			t.Errorf("NormalizeType(%q, %q) = %q, want %q", tt.typeName, tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeSql(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		same bool
+	}{
+		{"whitespace and case", "CREATE VIEW [dbo].[V]\nAS\n  SELECT 1", "create view [dbo].[V] as select 1", true},
+		{"comments", "-- header\nCREATE PROC P /* x */ AS SELECT 1", "CREATE PROCEDURE P AS SELECT 1", true},
+		{"create or alter", "CREATE OR ALTER VIEW V AS SELECT 1", "CREATE VIEW V AS SELECT 1", true},
+		{"string contents are significant", "SELECT 'A  b'", "SELECT 'a b'", false},
+		{"identifier case is significant", "SELECT [Num]", "SELECT [num]", false},
+		{"body changes", "CREATE VIEW V AS SELECT 1", "CREATE VIEW V AS SELECT 2", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeSql(tt.a) == NormalizeSql(tt.b); got != tt.same {
+				t.Errorf("NormalizeSql(%q) = %q, NormalizeSql(%q) = %q; same = %v, want %v", tt.a, NormalizeSql(tt.a), tt.b, NormalizeSql(tt.b), got, tt.same)
+			}
+		})
+	}
+}
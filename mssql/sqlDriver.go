@@ -1,18 +1,20 @@
 package mssql
 
 import (
+	"context"
 	"fmt"
 	"kodb-import/config"
-	"log"
+	"kodb-import/dbDriver"
+	"math"
 	"net/url"
-	"os"
-	"time"
+	"regexp"
+	"slices"
+	"strings"
 
 	"github.com/Open-KO/kodb-godef/enums/dbType"
 	_ "github.com/microsoft/go-mssqldb"
 	"gorm.io/driver/sqlserver"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
 )
 
 // mssql sql driver impl, see: https://github.com/denisenkom/go-mssqldb
@@ -37,153 +39,142 @@ const (
 	// winAuthConnStrFmt is the connection string format used when no dbuser is specified; Windows Authentication
 	winAuthConnStrFmt = "sqlserver://@%[1]s:%[2]d/%[3]s?database=%[4]s"
 
+	// dialTimeoutParamFmt is appended to the connection string when a connect timeout is configured; in seconds
+	dialTimeoutParamFmt = "&dial+timeout=%d"
+
 	// DefaultSysDbName is the name of the main system database in MSSQL Server; used for database creation queries
 	DefaultSysDbName = "master"
 
 	// SqlExtPattern is used to search the filesystem for SQL files
 	SqlExtPattern = "*.sql"
 
-	// BatchTerminator is an MS SQL specific keyword that only works when executed from SQL Server Management Studio
-	BatchTerminator = "\nGO"
+	// TemplatesDir is the OpenKO-db directory containing the T-SQL *.sqltemplate files
+	TemplatesDir = "Templates"
+
+	dropUserSqlFmt = "DROP LOGIN [%s]"
+
+	// dropDbSqlFmt sets the database to single-user mode first, rolling back and closing every other session (e.g. a
+	// running game server) so the drop doesn't fail while the database is in use.  Both statements are sent as one
+	// batch on one connection, so no other session can take the single-user slot in between.  A missing database
+	// fails the DROP with 3701
+	dropDbSqlFmt = "IF DB_ID(N'%[1]s') IS NOT NULL ALTER DATABASE [%[1]s] SET SINGLE_USER WITH ROLLBACK IMMEDIATE;\nDROP DATABASE [%[1]s]"
 )
 
+// DefaultIgnorableErrNumbers are the error numbers IsIgnorableErr accepts when databaseConfig.ignorableErrors isn't
+// set: 3701 (cannot drop an object because it doesn't exist) and 15151 (cannot drop a login or user because it doesn't
+// exist)
+var DefaultIgnorableErrNumbers = []int32{3701, 15151}
+
+// dropStatementRegex matches a batch holding a single DROP statement, optionally preceded by line comments and an IF
+// guard ending in a semicolon, like dropDbSqlFmt's
+var dropStatementRegex = regexp.MustCompile(`(?is)^(?:\s*--[^\n]*\n)*\s*(?:IF\s[^\n]*;\s*)?DROP\s+(?:VIEW|PROC|PROCEDURE|FUNCTION|TABLE|TRIGGER|TYPE|SYNONYM|SCHEMA|USER|LOGIN|ROLE|DATABASE)\s[^;]*;?\s*$`)
+
 // MssqlDbDriver contains information needed to perform our application's SQL connections
 type MssqlDbDriver struct {
-	dbConfig    config.DatabaseConfig
-	GenDbConfig config.GenDbConfig
-	DbType      dbType.DbType
-	connString  string
-	conn        *gorm.DB
-	masterConn  *gorm.DB
-	tx          *gorm.DB
+	dbDriver.Base
+	connString string
 }
 
 // NewMssqlDbDriver returns an instance of MssqlDbDriver populated with GenDbConfig for a particular database connection
 func NewMssqlDbDriver(dbConfig config.GenDbConfig, databaseType dbType.DbType) *MssqlDbDriver {
-	return &MssqlDbDriver{
-		dbConfig:    config.GetConfig().DatabaseConfig,
-		GenDbConfig: dbConfig,
-		DbType:      databaseType,
+	driver := &MssqlDbDriver{
+		Base: dbDriver.NewBase(dbConfig, databaseType, DefaultSysDbName),
+	}
+	driver.Dialector = func(dbName string) gorm.Dialector {
+		return sqlserver.Open(driver.GetConnectionString(dbName))
 	}
+
+	return driver
 }
 
 // GetConnectionString returns a formatted connection string using the configurations on MssqlDbDriver
 func (this *MssqlDbDriver) GetConnectionString(dbName string) string {
-	if this.dbConfig.User == "" {
+	if this.DbConfig.User == "" {
 		// Attempt Windows Auth
-		this.connString = fmt.Sprintf(winAuthConnStrFmt, this.dbConfig.Host, this.dbConfig.Port, this.dbConfig.Instance, dbName)
+		this.connString = fmt.Sprintf(winAuthConnStrFmt, this.DbConfig.Host, this.DbConfig.Port, this.DbConfig.Instance, dbName)
 	} else {
 		// Used Mixed Auth
-		this.connString = fmt.Sprintf(connStringFmt, this.dbConfig.User, url.QueryEscape(this.dbConfig.Password), this.dbConfig.Host, this.dbConfig.Port, this.dbConfig.Instance, dbName)
+		this.connString = fmt.Sprintf(connStringFmt, this.DbConfig.User, url.QueryEscape(this.DbConfig.Password), this.DbConfig.Host, this.DbConfig.Port, this.DbConfig.Instance, dbName)
+	}
+	if this.DbConfig.Timeouts.Connect > 0 {
+		this.connString += fmt.Sprintf(dialTimeoutParamFmt, int(math.Ceil(this.DbConfig.Timeouts.Connect.Seconds())))
 	}
 
 	return this.connString
 }
 
-// GetConnection returns a *gorm.DB instance from a connection string generated using the configuration on MssqlDbDriver
-func (this *MssqlDbDriver) GetConnection() (*gorm.DB, error) {
-	// if there's an existing connection, re-use it
-	if this.conn != nil {
-		// if there's an open session, use it
-		if this.tx != nil {
-			return this.tx, nil
-		}
-		return this.conn, nil
-	}
-
-	gormLogger := logger.New(
-		log.New(os.Stdout, "\r\n", log.LstdFlags), // io writer
-		logger.Config{
-			SlowThreshold:             time.Second,   // Slow SQL threshold
-			LogLevel:                  logger.Silent, // Log level
-			IgnoreRecordNotFoundError: true,          // Ignore ErrRecordNotFound error for logger
-			ParameterizedQueries:      true,          // Don't include params in the SQL log
-			Colorful:                  false,         // Disable color
-		},
-	)
-
-	gormConfig := &gorm.Config{
-		Logger: gormLogger,
-	}
-
-	// open a connection against the master db
-	var err error
-	this.conn, err = gorm.Open(sqlserver.Open(this.GetConnectionString(this.GenDbConfig.Name)), gormConfig)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open connection to mssql: %v", err)
-	}
-
-	return this.conn, nil
+// GetTemplatesDir returns the OpenKO-db directory containing the T-SQL templates
+func (this *MssqlDbDriver) GetTemplatesDir() string {
+	return TemplatesDir
 }
 
-func (this *MssqlDbDriver) GetMasterConnection() (*gorm.DB, error) {
-	// if there's an existing connection, re-use it
-	if this.masterConn != nil {
-		return this.masterConn, nil
-	}
+// QuoteIdentifier returns name as a [bracketed] identifier
+func (this *MssqlDbDriver) QuoteIdentifier(name string) string {
+	return "[" + strings.ReplaceAll(name, "]", "]]") + "]"
+}
 
-	gormLogger := logger.New(
-		log.New(os.Stdout, "\r\n", log.LstdFlags), // io writer
-		logger.Config{
-			SlowThreshold:             time.Second,   // Slow SQL threshold
-			LogLevel:                  logger.Silent, // Log level
-			IgnoreRecordNotFoundError: true,          // Ignore ErrRecordNotFound error for logger
-			ParameterizedQueries:      true,          // Don't include params in the SQL log
-			Colorful:                  false,         // Disable color
-		},
-	)
-
-	gormConfig := &gorm.Config{
-		Logger:                 gormLogger,
-		SkipDefaultTransaction: true,
-	}
+// SplitBatches breaks a T-SQL script into its GO-separated batches
+func (this *MssqlDbDriver) SplitBatches(sql string) ([]Batch, error) {
+	return SplitBatches(sql)
+}
 
-	// open a connection against the master db
-	var err error
-	this.masterConn, err = gorm.Open(sqlserver.Open(this.GetConnectionString(DefaultSysDbName)), gormConfig)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open connection to mssql: %v", err)
-	}
+// GetDropDatabaseSql returns the batch that closes the named database's sessions and drops it
+func (this *MssqlDbDriver) GetDropDatabaseSql(dbName string) string {
+	return fmt.Sprintf(dropDbSqlFmt, dbName)
+}
 
-	return this.masterConn, nil
+// GetDropLoginSql returns the statement that drops the named server login
+func (this *MssqlDbDriver) GetDropLoginSql(loginName string) string {
+	return fmt.Sprintf(dropUserSqlFmt, loginName)
 }
 
-func (this *MssqlDbDriver) GetDb() *gorm.DB {
-	return this.conn
+// ExecBatch executes a single batch on the given connection; server errors are returned as *SqlError
+func (this *MssqlDbDriver) ExecBatch(ctx context.Context, conn *gorm.DB, sql string) error {
+	return WrapErr(this.Base.ExecBatch(ctx, conn, sql))
 }
 
-// GetTx returns the top-level transaction fence for this driver
-func (this *MssqlDbDriver) GetTx() (tx *gorm.DB, err error) {
-	if this.conn == nil {
-		this.conn, err = this.GetConnection()
-		if err != nil {
-			return nil, err
-		}
-	}
-	if this.tx == nil {
-		this.tx = this.conn.Begin()
+// IsIgnorableErr checks an error to see if it can be ignored; These are errors related to
+// failed DROP statements after a database clean or new setup.  The batch must be a single DROP statement, and the
+// error number must be one of databaseConfig.ignorableErrors, or DefaultIgnorableErrNumbers when it isn't set; the
+// same numbers are returned when other statements reference a missing object, so those aren't ignored
+func (this *MssqlDbDriver) IsIgnorableErr(err error, sql string) bool {
+	sqlErr, ok := AsSqlError(err)
+	if !ok || !dropStatementRegex.MatchString(sql) {
+		return false
 	}
 
-	return this.tx, nil
-}
-
-// CommitTx attempts to commit the top level transaction fence for this driver
-func (this *MssqlDbDriver) CommitTx() error {
-	if this.tx != nil {
-		return this.tx.Commit().Error
+	numbers := this.DbConfig.IgnorableErrors
+	if len(numbers) == 0 {
+		numbers = DefaultIgnorableErrNumbers
 	}
-	return fmt.Errorf("no transaction to commit")
+	return slices.Contains(numbers, sqlErr.Number)
 }
 
-// RollbackTx attempts to rollback the top level transaction fence for this driver
-func (this *MssqlDbDriver) RollbackTx() error {
-	if this.tx != nil {
-		return this.tx.Rollback().Error
-	}
-	return fmt.Errorf("no transaction to rollback")
+// transientErrNumbers are the server error numbers that are expected to clear up on their own, see:
+// https://learn.microsoft.com/en-us/azure/azure-sql/database/troubleshoot-common-errors-issues
+var transientErrNumbers = map[int32]bool{
+	233:   true, // connection was terminated by the server
+	1205:  true, // chosen as the deadlock victim
+	4060:  true, // cannot open database; it's still being recovered or restored
+	10053: true, // transport-level error, connection aborted
+	10054: true, // transport-level error, connection reset by peer
+	10060: true, // network-related error, connection timed out
+	10928: true, // resource limit reached
+	10929: true, // resource limit reached
+	18401: true, // login failed; server is in script upgrade mode (still starting up)
+	40197: true, // service error processing the request
+	40501: true, // service is busy
+	40613: true, // database is unavailable
+	49918: true, // not enough resources to process the request
+	49919: true, // too many create/update operations in progress
+	49920: true, // too many operations in progress
 }
 
-// CloseConnection nulls the connection pointer pointer; gorm doesn't require manual connection closes
-func (this *MssqlDbDriver) CloseConnection() {
-	this.conn = nil
+// IsTransientErr checks an error to see if the batch that caused it can be retried; these are deadlocks, dropped
+// connections, and a server that's still starting up.  See dbDriver.Retry
+func (this *MssqlDbDriver) IsTransientErr(err error) bool {
+	if sqlErr, ok := AsSqlError(err); ok {
+		return transientErrNumbers[sqlErr.Number]
+	}
+	return dbDriver.IsTransientNetErr(err)
 }
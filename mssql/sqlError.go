@@ -0,0 +1,69 @@
+package mssql
+
+import (
+	"errors"
+	"fmt"
+
+	mssqldb "github.com/microsoft/go-mssqldb"
+)
+
+// SqlError is a SQL Server error unwrapped from the go-mssqldb/gorm error chain.  Errors are classified by Number
+// rather than by the message text, which is localized by the server and may change between driver versions
+type SqlError struct {
+	// Number is the server error number, e.g. 3701 for a DROP of an object that doesn't exist
+	Number int32
+	// State is the server error state; the same Number can be raised from several places
+	State uint8
+	// Class is the severity, 0-25; 20 and above close the connection
+	Class uint8
+	// LineNo is the line in the batch, or in ProcName, the error was raised on
+	LineNo int32
+	// ProcName is the stored procedure or trigger the error was raised in; empty for ad-hoc batches
+	ProcName string
+	// Message is the server's (localized) error message
+	Message string
+
+	err error
+}
+
+// Error returns the error in the format SQL Server tools use: "Msg [Number], Level [Class], State [State], Line [LineNo]"
+func (this *SqlError) Error() string {
+	if this.ProcName != "" {
+		return fmt.Sprintf("mssql: Msg %d, Level %d, State %d, Procedure %s, Line %d: %s", this.Number, this.Class, this.State, this.ProcName, this.LineNo, this.Message)
+	}
+	return fmt.Sprintf("mssql: Msg %d, Level %d, State %d, Line %d: %s", this.Number, this.Class, this.State, this.LineNo, this.Message)
+}
+
+// Unwrap returns the original error chain
+func (this *SqlError) Unwrap() error {
+	return this.err
+}
+
+// AsSqlError returns the SQL Server error in err's chain, if there is one
+func AsSqlError(err error) (sqlErr *SqlError, ok bool) {
+	if errors.As(err, &sqlErr) {
+		return sqlErr, true
+	}
+
+	var driverErr mssqldb.Error
+	if !errors.As(err, &driverErr) {
+		return nil, false
+	}
+	return &SqlError{
+		Number:   driverErr.Number,
+		State:    driverErr.State,
+		Class:    driverErr.Class,
+		LineNo:   driverErr.LineNo,
+		ProcName: driverErr.ProcName,
+		Message:  driverErr.Message,
+		err:      err,
+	}, true
+}
+
+// WrapErr returns err as a *SqlError when its chain contains a SQL Server error, otherwise err is returned as-is
+func WrapErr(err error) error {
+	if sqlErr, ok := AsSqlError(err); ok {
+		return sqlErr
+	}
+	return err
+}
@@ -0,0 +1,150 @@
+package mssql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kodb-import/config"
+	"testing"
+
+	mssqldb "github.com/microsoft/go-mssqldb"
+)
+
+func TestAsSqlError(t *testing.T) {
+	driverErr := mssqldb.Error{Number: 3701, State: 5, Class: 11, LineNo: 2, ProcName: "GET_ITEM", Message: "Cannot drop the view 'VIEW_ITEM', because it does not exist or you do not have permission."}
+
+	tests := []struct {
+		name    string
+		err     error
+		want    *SqlError
+		wantMsg string
+	}{
+		{
+			name:    "driver error",
+			err:     driverErr,
+			want:    &SqlError{Number: 3701, State: 5, Class: 11, LineNo: 2, ProcName: "GET_ITEM", Message: driverErr.Message},
+			wantMsg: "mssql: Msg 3701, Level 11, State 5, Procedure GET_ITEM, Line 2: " + driverErr.Message,
+		},
+		{
+			name:    "wrapped driver error",
+			err:     fmt.Errorf("6_InsertData_ITEM.sql: %w", mssqldb.Error{Number: 2627, State: 1, Class: 14, LineNo: 1, Message: "Violation of PRIMARY KEY constraint 'PK_ITEM'."}),
+			want:    &SqlError{Number: 2627, State: 1, Class: 14, LineNo: 1, Message: "Violation of PRIMARY KEY constraint 'PK_ITEM'."},
+			wantMsg: "mssql: Msg 2627, Level 14, State 1, Line 1: Violation of PRIMARY KEY constraint 'PK_ITEM'.",
+		},
+		{
+			name:    "server error",
+			err:     mssqldb.ServerError{},
+			want:    &SqlError{},
+			wantMsg: "mssql: Msg 0, Level 0, State 0, Line 0: ",
+		},
+		{
+			name: "not a server error",
+			err:  context.DeadlineExceeded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := AsSqlError(tt.err)
+			if ok != (tt.want != nil) {
+				t.Fatalf("AsSqlError() ok = %v, want %v", ok, tt.want != nil)
+			}
+			if !ok {
+				if WrapErr(tt.err) != tt.err {
+					t.Errorf("WrapErr() = %v, want the error unchanged", WrapErr(tt.err))
+				}
+				return
+			}
+			if got.Number != tt.want.Number || got.State != tt.want.State || got.Class != tt.want.Class ||
+				got.LineNo != tt.want.LineNo || got.ProcName != tt.want.ProcName || got.Message != tt.want.Message {
+				t.Errorf("AsSqlError() = %+v, want %+v", got, tt.want)
+			}
+			if got.Error() != tt.wantMsg {
+				t.Errorf("Error() = %q, want %q", got.Error(), tt.wantMsg)
+			}
+			var driverErr mssqldb.Error
+			if !errors.As(WrapErr(tt.err), &driverErr) {
+				t.Errorf("WrapErr() doesn't unwrap to the driver error")
+			}
+		})
+	}
+}
+
+func TestIsIgnorableErr(t *testing.T) {
+	tests := []struct {
+		name      string
+		ignorable []int32
+		err       error
+		sql       string
+		want      bool
+	}{
+		{
+			name: "default view/procedure not found",
+			err:  mssqldb.Error{Number: 3701, Message: "Cannot drop the procedure 'GET_ITEM', because it does not exist or you do not have permission."},
+			want: true,
+		},
+		{
+			name: "default login not found",
+			err:  &SqlError{Number: 15151},
+			want: true,
+		},
+		{
+			name: "default other error",
+			err:  mssqldb.Error{Number: 2714, Message: "There is already an object named 'GET_ITEM' in the database."},
+			want: false,
+		},
+		{
+			name: "message text alone isn't ignored",
+			err:  errors.New("mssql: Cannot drop the view 'VIEW_ITEM', because it does not exist or you do not have permission."),
+			want: false,
+		},
+		{
+			name:      "configured numbers replace the defaults",
+			ignorable: []int32{2714},
+			err:       mssqldb.Error{Number: 2714},
+			want:      true,
+		},
+		{
+			name:      "configured numbers exclude the defaults",
+			ignorable: []int32{2714},
+			err:       mssqldb.Error{Number: 3701},
+			want:      false,
+		},
+		{
+			name: "guarded drop database",
+			err:  mssqldb.Error{Number: 3701},
+			sql:  fmt.Sprintf(dropDbSqlFmt, "KN_online"),
+			want: true,
+		},
+		{
+			name: "drop login",
+			err:  mssqldb.Error{Number: 15151},
+			sql:  fmt.Sprintf(dropUserSqlFmt, "knight"),
+			want: true,
+		},
+		{
+			name: "missing object in a non-DROP batch",
+			err:  mssqldb.Error{Number: 3701, Message: "Cannot drop the table 'ITEM_OLD', because it does not exist or you do not have permission."},
+			sql:  "EXEC sp_rename 'ITEM', 'ITEM_OLD'\nDROP TABLE [ITEM_OLD]",
+			want: false,
+		},
+		{
+			name: "missing login in a CREATE USER batch",
+			err:  mssqldb.Error{Number: 15151},
+			sql:  "CREATE USER [knight] FOR LOGIN [knight]",
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driver := &MssqlDbDriver{}
+			driver.DbConfig = config.DatabaseConfig{IgnorableErrors: tt.ignorable}
+			sql := tt.sql
+			if sql == "" {
+				sql = "DROP VIEW [dbo].[VIEW_ITEM]"
+			}
+			if got := driver.IsIgnorableErr(tt.err, sql); got != tt.want {
+				t.Errorf("IsIgnorableErr() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package postgres
+
+import (
+	"errors"
+	"fmt"
+	"kodb-import/config"
+	"kodb-import/dbDriver"
+	"math"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/Open-KO/kodb-godef/enums/dbType"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// postgres sql driver impl, see: https://github.com/jackc/pgx
+//
+// PostgreSQL is clean-only: OpenKO-db's templates and scripts are T-SQL, so every job other than -clean is rejected
+// for postgres before a driver is created (see validateDbType in kodb-import.go)
+
+const (
+	// 1: Username
+	// 2: Password
+	// 3: Host
+	// 4: Port
+	// 5: Database Name
+	// connStringFmt is the connection string format used when a dbuser/dbpass are specified
+	connStringFmt = "postgres://%[1]s:%[2]s@%[3]s:%[4]d/%[5]s"
+
+	// 1: Host
+	// 2: Port
+	// 3: Database Name
+	// peerAuthConnStrFmt is the connection string format used when no dbuser is specified; the OS user and
+	// ~/.pgpass are used
+	peerAuthConnStrFmt = "postgres://%[1]s:%[2]d/%[3]s"
+
+	// connectTimeoutParamFmt is appended to the connection string when a connect timeout is configured; in seconds
+	connectTimeoutParamFmt = "?connect_timeout=%d"
+
+	// DefaultSysDbName is the name of the maintenance database in PostgreSQL; used for database creation queries
+	DefaultSysDbName = "postgres"
+
+	dropRoleSqlFmt = "DROP ROLE %s"
+	// FORCE terminates the database's sessions so the drop doesn't fail while it's in use (PostgreSQL 13+)
+	dropDbSqlFmt = "DROP DATABASE %s WITH (FORCE)"
+
+	// SQLSTATE codes returned when dropping an object that doesn't exist
+	undefinedTableCode    = "42P01"
+	undefinedFunctionCode = "42883"
+	undefinedObjectCode   = "42704"
+	invalidCatalogCode    = "3D000"
+
+	// SQLSTATE codes for errors that clear up on their own: serialization failures, deadlocks, and a server that's
+	// still starting up.  Every code in connectionExceptionClass (08xxx) is also transient
+	serializationFailureCode = "40001"
+	deadlockDetectedCode     = "40P01"
+	cannotConnectNowCode     = "57P03"
+	connectionExceptionClass = "08"
+)
+
+var (
+	// errCleanOnly is returned by the parts of the DbDriver interface only the other jobs use
+	errCleanOnly = errors.New("only -clean is supported with databaseConfig.type postgres")
+
+	// dropStatementRegex matches a batch holding a single DROP statement, optionally preceded by line comments; the
+	// first group is the kind of object dropped
+	dropStatementRegex = regexp.MustCompile(`(?i)^(?:\s*--[^\n]*\n)*\s*DROP\s+(VIEW|FUNCTION|PROCEDURE|ROLE|DATABASE)\s[^;]*;?\s*$`)
+
+	// missingObjectCodes maps the kind of object a DROP statement drops to the SQLSTATE returned when it doesn't exist
+	missingObjectCodes = map[string]string{
+		"VIEW":      undefinedTableCode,
+		"FUNCTION":  undefinedFunctionCode,
+		"PROCEDURE": undefinedFunctionCode,
+		"ROLE":      undefinedObjectCode,
+		"DATABASE":  invalidCatalogCode,
+	}
+)
+
+// PostgresDbDriver contains information needed to perform our application's PostgreSQL connections
+type PostgresDbDriver struct {
+	dbDriver.Base
+	connString string
+}
+
+// NewPostgresDbDriver returns an instance of PostgresDbDriver populated with GenDbConfig for a particular database
+// connection
+func NewPostgresDbDriver(dbConfig config.GenDbConfig, databaseType dbType.DbType) *PostgresDbDriver {
+	driver := &PostgresDbDriver{
+		Base: dbDriver.NewBase(dbConfig, databaseType, DefaultSysDbName),
+	}
+	driver.Dialector = func(dbName string) gorm.Dialector {
+		return postgres.New(postgres.Config{
+			DSN: driver.GetConnectionString(dbName),
+			// scripts are sent as-is, often with several statements per batch
+			PreferSimpleProtocol: true,
+		})
+	}
+
+	return driver
+}
+
+// GetConnectionString returns a formatted connection string using the configurations on PostgresDbDriver
+func (this *PostgresDbDriver) GetConnectionString(dbName string) string {
+	if this.DbConfig.User == "" {
+		this.connString = fmt.Sprintf(peerAuthConnStrFmt, this.DbConfig.Host, this.DbConfig.Port, url.PathEscape(dbName))
+	} else {
+		this.connString = fmt.Sprintf(connStringFmt, url.QueryEscape(this.DbConfig.User), url.QueryEscape(this.DbConfig.Password), this.DbConfig.Host, this.DbConfig.Port, url.PathEscape(dbName))
+	}
+	if this.DbConfig.Timeouts.Connect > 0 {
+		this.connString += fmt.Sprintf(connectTimeoutParamFmt, int(math.Ceil(this.DbConfig.Timeouts.Connect.Seconds())))
+	}
+
+	return this.connString
+}
+
+// GetTemplatesDir returns an empty path; OpenKO-db has no PostgreSQL templates, and -clean doesn't use any
+func (this *PostgresDbDriver) GetTemplatesDir() string {
+	return ""
+}
+
+// QuoteIdentifier returns name as a "double-quoted" identifier
+func (this *PostgresDbDriver) QuoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// SplitBatches returns an error; OpenKO-db's scripts are T-SQL, and -clean executes its statements without splitting
+func (this *PostgresDbDriver) SplitBatches(sql string) ([]dbDriver.Batch, error) {
+	return nil, errCleanOnly
+}
+
+// GetDropDatabaseSql returns the statement that drops the named database, disconnecting its sessions
+func (this *PostgresDbDriver) GetDropDatabaseSql(dbName string) string {
+	return fmt.Sprintf(dropDbSqlFmt, this.QuoteIdentifier(dbName))
+}
+
+// GetDropLoginSql returns the statement that drops the named role
+func (this *PostgresDbDriver) GetDropLoginSql(loginName string) string {
+	return fmt.Sprintf(dropRoleSqlFmt, this.QuoteIdentifier(loginName))
+}
+
+// IsIgnorableErr checks an error to see if it can be ignored; These are errors related to
+// failed DROP DATABASE/ROLE/VIEW/FUNCTION/PROCEDURE statements after a database clean or new setup.  The batch must be
+// a single DROP statement, and the error's SQLSTATE must be the one for that kind of object not existing; message text
+// is localized, so it isn't checked
+func (this *PostgresDbDriver) IsIgnorableErr(err error, sql string) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+
+	match := dropStatementRegex.FindStringSubmatch(sql)
+	if match == nil {
+		return false
+	}
+	return pgErr.Code == missingObjectCodes[strings.ToUpper(match[1])]
+}
+
+// IsTransientErr checks an error to see if the statement that caused it can be retried; see dbDriver.Retry
+func (this *PostgresDbDriver) IsTransientErr(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case serializationFailureCode, deadlockDetectedCode, cannotConnectNowCode:
+			return true
+		}
+		return strings.HasPrefix(pgErr.Code, connectionExceptionClass)
+	}
+	return dbDriver.IsTransientNetErr(err)
+}
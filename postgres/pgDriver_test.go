@@ -0,0 +1,86 @@
+package postgres
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestIsIgnorableErr(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		sql  string
+		want bool
+	}{
+		{
+			name: "view not found",
+			err:  &pgconn.PgError{Code: undefinedTableCode, Message: "view \"view_item\" does not exist"},
+			sql:  `DROP VIEW "VIEW_ITEM"`,
+			want: true,
+		},
+		{
+			name: "localized message",
+			err:  &pgconn.PgError{Code: undefinedTableCode, Message: "la vista «view_item» no existe"},
+			sql:  `DROP VIEW "VIEW_ITEM";`,
+			want: true,
+		},
+		{
+			name: "function not found",
+			err:  &pgconn.PgError{Code: undefinedFunctionCode},
+			sql:  "-- drop the old function\ndrop function get_item()",
+			want: true,
+		},
+		{
+			name: "procedure not found",
+			err:  &pgconn.PgError{Code: undefinedFunctionCode},
+			sql:  "DROP PROCEDURE get_item",
+			want: true,
+		},
+		{
+			name: "role not found",
+			err:  &pgconn.PgError{Code: undefinedObjectCode},
+			sql:  `DROP ROLE "knight"`,
+			want: true,
+		},
+		{
+			name: "database not found",
+			err:  &pgconn.PgError{Code: invalidCatalogCode},
+			sql:  `DROP DATABASE "KN_online" WITH (FORCE)`,
+			want: true,
+		},
+		{
+			name: "missing table outside a drop",
+			err:  &pgconn.PgError{Code: undefinedTableCode},
+			sql:  "SELECT * FROM item",
+			want: false,
+		},
+		{
+			name: "code doesn't match the dropped kind",
+			err:  &pgconn.PgError{Code: undefinedObjectCode},
+			sql:  `DROP VIEW "VIEW_ITEM"`,
+			want: false,
+		},
+		{
+			name: "drop followed by other statements",
+			err:  &pgconn.PgError{Code: undefinedTableCode},
+			sql:  `DROP VIEW "VIEW_ITEM"; CREATE VIEW "VIEW_ITEM" AS SELECT 1`,
+			want: false,
+		},
+		{
+			name: "not a server error",
+			err:  errors.New(`view "view_item" does not exist`),
+			sql:  `DROP VIEW "VIEW_ITEM"`,
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driver := &PostgresDbDriver{}
+			if got := driver.IsIgnorableErr(tt.err, tt.sql); got != tt.want {
+				t.Errorf("IsIgnorableErr() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}